@@ -0,0 +1,185 @@
+package kre
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// BatchMessage is one of the incoming messages given to a BatchHandler.
+type BatchMessage struct {
+	RequestID   string
+	FromNode    string
+	MessageType MessageType
+	Payload     *anypb.Any
+}
+
+// BatchResult is the outcome of processing one of the messages of a batch. The runner sends
+// the response, if any, to the node's output subject under the message's request ID, or
+// publishes the error.
+type BatchResult struct {
+	Response proto.Message
+	Err      error
+}
+
+// BatchHandler is the function executed each time a batch of messages is ready. It must return
+// exactly one result per message, in the same order.
+//
+// The given context is not bound to any request, so responses must be returned as results
+// instead of being sent through the context.
+type BatchHandler func(ctx *HandlerContext, batch []*BatchMessage) []BatchResult
+
+type batchEntry struct {
+	msg        *nats.Msg
+	requestMsg *KreNatsMessage
+}
+
+// batcher groups the incoming messages in batches of up to size messages, or whatever arrived
+// within maxWait since the first message of the batch.
+type batcher struct {
+	size    int
+	maxWait time.Duration
+	msgs    chan *nats.Msg
+	process func(msgs []*nats.Msg)
+}
+
+func newBatcher(size int, maxWait time.Duration, process func(msgs []*nats.Msg)) *batcher {
+	return &batcher{
+		size:    size,
+		maxWait: maxWait,
+		msgs:    make(chan *nats.Msg, size),
+		process: process,
+	}
+}
+
+// add blocks while the batch being processed is full, so the subscription applies backpressure.
+func (b *batcher) add(msg *nats.Msg) {
+	b.msgs <- msg
+}
+
+func (b *batcher) run() {
+	for first := range b.msgs {
+		batch := []*nats.Msg{first}
+		timer := time.NewTimer(b.maxWait)
+
+	collect:
+		for len(batch) < b.size {
+			select {
+			case msg := <-b.msgs:
+				batch = append(batch, msg)
+			case <-timer.C:
+				break collect
+			}
+		}
+
+		timer.Stop()
+		b.process(batch)
+	}
+}
+
+// EnqueueMessage adds the incoming NATS message to the next batch given to the batch handler.
+func (r *Runner) EnqueueMessage(msg *nats.Msg) {
+	if !r.startMessage(msg) {
+		return
+	}
+
+	r.batcher.add(msg)
+}
+
+// processBatch executes the batch handler and acks, publishes the result or the error of each
+// message of the batch individually.
+func (r *Runner) processBatch(msgs []*nats.Msg) {
+	start := time.Now().UTC()
+
+	entries := make([]batchEntry, 0, len(msgs))
+	batch := make([]*BatchMessage, 0, len(msgs))
+
+	for _, msg := range msgs {
+		requestMsg, err := r.newRequestMessage(msg.Data)
+		if err != nil {
+			errMsg := fmt.Sprintf("Error parsing msg.data coming from subject %s because is not a valid protobuf: %s", msg.Subject, err)
+			r.processRunnerError(msg, errMsg, requestMsg, start)
+			continue
+		}
+
+		if r.isAlreadyProcessed(requestMsg) {
+			r.logger.Infof("Skipping already processed request %q part %d from node %q",
+				requestMsg.RequestId, requestMsg.PartIndex, requestMsg.FromNode)
+			r.ackMessage(msg)
+			continue
+		}
+
+		entries = append(entries, batchEntry{msg, requestMsg})
+		batch = append(batch, &BatchMessage{
+			RequestID:   requestMsg.RequestId,
+			FromNode:    requestMsg.FromNode,
+			MessageType: requestMsg.MessageType,
+			Payload:     requestMsg.Payload,
+		})
+	}
+
+	if len(batch) == 0 {
+		return
+	}
+
+	r.logger.Infof("Processing a batch of %d messages", len(batch))
+
+	stops := make([]func(), 0, len(entries))
+	for _, entry := range entries {
+		stops = append(stops, r.keepInProgress(entry.msg, r.cfg.NATS.InProgressInterval))
+	}
+
+	hCtx, cancel := r.newMessageContext(&KreNatsMessage{})
+	results := r.batchHandler(hCtx, batch)
+	cancel()
+
+	for _, stop := range stops {
+		stop()
+	}
+	if len(results) != len(batch) {
+		for _, entry := range entries {
+			errMsg := fmt.Sprintf("Error in node %q executing batch handler: %d results returned for %d messages",
+				r.cfg.NodeName, len(results), len(batch))
+			r.processRunnerError(entry.msg, errMsg, entry.requestMsg, start)
+		}
+		return
+	}
+
+	for i, entry := range entries {
+		r.processBatchResult(entry, results[i], start)
+	}
+}
+
+func (r *Runner) processBatchResult(entry batchEntry, result BatchResult, start time.Time) {
+	requestMsg := entry.requestMsg
+
+	if result.Err != nil {
+		errMsg := fmt.Sprintf("Error in node %q executing batch handler for node %q: %s", r.cfg.NodeName, requestMsg.FromNode, result.Err)
+		r.processRunnerError(entry.msg, errMsg, requestMsg, start)
+		return
+	}
+
+	if result.Response != nil {
+		hCtx, cancel := r.newMessageContext(requestMsg)
+		defer cancel()
+
+		// the publish error, if any, is tracked and handled following the publish error policy
+		_ = hCtx.SendOutput(result.Response)
+
+		err := r.awaitPublishes(hCtx)
+		if err != nil {
+			errMsg := fmt.Sprintf("Error in node %q publishing batch result for node %q: %s", r.cfg.NodeName, requestMsg.FromNode, err)
+			r.processRunnerError(entry.msg, errMsg, requestMsg, start)
+			return
+		}
+	}
+
+	r.markAsProcessed(requestMsg)
+	r.ackMessage(entry.msg)
+
+	end := time.Now().UTC()
+	r.saveElapsedTime(start, end, requestMsg.FromNode, true)
+}
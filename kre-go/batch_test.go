@@ -0,0 +1,53 @@
+//go:build unit
+
+package kre
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/suite"
+)
+
+type BatcherTestSuite struct {
+	suite.Suite
+}
+
+func TestBatcherTestSuite(t *testing.T) {
+	suite.Run(t, new(BatcherTestSuite))
+}
+
+func (suite *BatcherTestSuite) TestBatcherFlushesFullBatches() {
+	// GIVEN a batcher of size 2 with a long max wait
+	batches := make(chan []*nats.Msg, 2)
+	b := newBatcher(2, time.Hour, func(msgs []*nats.Msg) { batches <- msgs })
+	go b.run()
+
+	// WHEN four messages arrive
+	for i := 0; i < 4; i++ {
+		b.add(&nats.Msg{})
+	}
+
+	// THEN two full batches are processed without waiting
+	suite.Len(<-batches, 2)
+	suite.Len(<-batches, 2)
+}
+
+func (suite *BatcherTestSuite) TestBatcherFlushesAfterMaxWait() {
+	// GIVEN a batcher of size 10 with a short max wait
+	batches := make(chan []*nats.Msg, 1)
+	b := newBatcher(10, 10*time.Millisecond, func(msgs []*nats.Msg) { batches <- msgs })
+	go b.run()
+
+	// WHEN a single message arrives
+	b.add(&nats.Msg{})
+
+	// THEN it is processed alone once the max wait expires
+	select {
+	case batch := <-batches:
+		suite.Len(batch, 1)
+	case <-time.After(time.Second):
+		suite.Fail("batch not processed after max wait")
+	}
+}
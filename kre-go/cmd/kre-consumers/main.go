@@ -0,0 +1,108 @@
+// kre-consumers lists, and optionally deletes, the orphaned JetStream consumers of a runtime.
+//
+// A consumer is orphaned when no node is subscribed to it, it has no messages pending delivery or
+// acknowledgement, and it has been inactive for longer than the given period, e.g. the consumers of removed nodes or of previous versions.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+func main() {
+	server := flag.String("server", os.Getenv("KRT_NATS_SERVER"), "NATS server URL.")
+	runtimeID := flag.String("runtime", os.Getenv("KRT_RUNTIME_ID"), "runtime ID whose streams are inspected.")
+	inactive := flag.Duration("inactive", time.Hour, "minimum inactivity of a consumer to be considered orphaned.")
+	deleteOrphans := flag.Bool("delete", false, "delete the orphaned consumers instead of only listing them.")
+
+	flag.Parse()
+
+	if *server == "" || *runtimeID == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	nc, err := nats.Connect(*server)
+	if err != nil {
+		log.Fatalf("[kre-consumers] error connecting to NATS: %s", err)
+	}
+	defer nc.Close()
+
+	js, err := nc.JetStream()
+	if err != nil {
+		log.Fatalf("[kre-consumers] error connecting to JetStream: %s", err)
+	}
+
+	orphans := findOrphanedConsumers(js, *runtimeID, *inactive, time.Now())
+
+	failed := 0
+	for _, info := range orphans {
+		fmt.Printf("%s\t%s\tlast active %s\n", info.Stream, info.Name, lastActive(info).Format(time.RFC3339))
+
+		if !*deleteOrphans {
+			continue
+		}
+
+		err = js.DeleteConsumer(info.Stream, info.Name)
+		if err != nil {
+			log.Printf("[kre-consumers] error deleting consumer %s: %s", info.Name, err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// findOrphanedConsumers returns the orphaned consumers of the streams of the runtime, named
+// after the runtime ID followed by an underscore.
+func findOrphanedConsumers(
+	js nats.JetStreamContext,
+	runtimeID string,
+	inactive time.Duration,
+	now time.Time,
+) []*nats.ConsumerInfo {
+	var orphans []*nats.ConsumerInfo
+
+	for stream := range js.StreamNames() {
+		if !strings.HasPrefix(stream, runtimeID+"_") {
+			continue
+		}
+
+		for info := range js.ConsumersInfo(stream) {
+			if isOrphaned(info, inactive, now) {
+				orphans = append(orphans, info)
+			}
+		}
+	}
+
+	return orphans
+}
+
+func isOrphaned(info *nats.ConsumerInfo, inactive time.Duration, now time.Time) bool {
+	// consumers with pending messages are kept, as their node may be stopped for a while
+	if info.PushBound || info.NumWaiting > 0 || info.NumAckPending > 0 || info.NumPending > 0 {
+		return false
+	}
+
+	return now.Sub(lastActive(info)) > inactive
+}
+
+func lastActive(info *nats.ConsumerInfo) time.Time {
+	last := info.Created
+
+	for _, t := range []*time.Time{info.Delivered.Last, info.AckFloor.Last} {
+		if t != nil && t.After(last) {
+			last = *t
+		}
+	}
+
+	return last
+}
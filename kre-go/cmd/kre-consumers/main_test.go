@@ -0,0 +1,100 @@
+//go:build unit
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/suite"
+)
+
+type fakeJetStream struct {
+	nats.JetStreamContext
+	consumers map[string][]*nats.ConsumerInfo
+}
+
+func (js *fakeJetStream) StreamNames(_ ...nats.JSOpt) <-chan string {
+	names := make(chan string, len(js.consumers))
+	for stream := range js.consumers {
+		names <- stream
+	}
+	close(names)
+
+	return names
+}
+
+func (js *fakeJetStream) ConsumersInfo(stream string, _ ...nats.JSOpt) <-chan *nats.ConsumerInfo {
+	infos := make(chan *nats.ConsumerInfo, len(js.consumers[stream]))
+	for _, info := range js.consumers[stream] {
+		infos <- info
+	}
+	close(infos)
+
+	return infos
+}
+
+type ConsumersTestSuite struct {
+	suite.Suite
+	now time.Time
+}
+
+func TestConsumersTestSuite(t *testing.T) {
+	suite.Run(t, new(ConsumersTestSuite))
+}
+
+func (suite *ConsumersTestSuite) SetupTest() {
+	suite.now = time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+}
+
+// consumer returns the info of an unused consumer last active the given time ago.
+func (suite *ConsumersTestSuite) consumer(stream, name string, inactive time.Duration) *nats.ConsumerInfo {
+	last := suite.now.Add(-inactive)
+
+	return &nats.ConsumerInfo{
+		Stream:    stream,
+		Name:      name,
+		Created:   last.Add(-time.Hour),
+		Delivered: nats.SequenceInfo{Last: &last},
+	}
+}
+
+func (suite *ConsumersTestSuite) TestIsOrphaned() {
+	inactive := suite.consumer("s", "c", 2*time.Hour)
+	suite.True(isOrphaned(inactive, time.Hour, suite.now))
+
+	recent := suite.consumer("s", "c", 30*time.Minute)
+	suite.False(isOrphaned(recent, time.Hour, suite.now))
+
+	cases := map[string]func(info *nats.ConsumerInfo){
+		"push bound":  func(info *nats.ConsumerInfo) { info.PushBound = true },
+		"waiting":     func(info *nats.ConsumerInfo) { info.NumWaiting = 1 },
+		"ack pending": func(info *nats.ConsumerInfo) { info.NumAckPending = 1 },
+		"pending":     func(info *nats.ConsumerInfo) { info.NumPending = 1 },
+	}
+
+	for name, inUse := range cases {
+		info := suite.consumer("s", "c", 2*time.Hour)
+		inUse(info)
+		suite.False(isOrphaned(info, time.Hour, suite.now), name)
+	}
+}
+
+func (suite *ConsumersTestSuite) TestFindOrphanedConsumers() {
+	// GIVEN the consumers of the streams of two runtimes
+	orphan := suite.consumer("runtime1_workflow", "old", 2*time.Hour)
+	pending := suite.consumer("runtime1_workflow", "stopped", 2*time.Hour)
+	pending.NumPending = 5
+
+	js := &fakeJetStream{consumers: map[string][]*nats.ConsumerInfo{
+		"runtime1_workflow":  {orphan, pending, suite.consumer("runtime1_workflow", "active", time.Minute)},
+		"runtime10_workflow": {suite.consumer("runtime10_workflow", "old", 2*time.Hour)},
+	}}
+
+	// WHEN the orphaned consumers of a runtime are found
+	orphans := findOrphanedConsumers(js, "runtime1", time.Hour, suite.now)
+
+	// THEN only its inactive consumers without pending messages are returned
+	suite.Equal([]*nats.ConsumerInfo{orphan}, orphans)
+}
@@ -3,7 +3,7 @@ package config
 import (
 	"os"
 	"strconv"
-	"strings"
+	"time"
 
 	"github.com/konstellation-io/kre/libs/simplelogger"
 )
@@ -17,93 +17,344 @@ type Config struct {
 	BasePath     string
 	NATS         ConfigNATS
 	MongoDB      MongoDB
+	Database     Database
 	InfluxDB     InfluxDB
+	Batch        Batch
+	SaveBatch    Batch
+	Limits       Limits
+	Health       Health
+	Timeouts     Timeouts
+	Secrets      Secrets
+	ObjectStore  ObjectStore
 }
 
+// MongoDB holds the MongoDB connection settings, which override the ones of the URI. Zero pool
+// sizes and server selection timeout keep the URI or driver defaults. With LazyConnect the runner
+// starts without waiting for MongoDB, which is connected in the background, retrying every
+// ConnectRetryInterval.
 type MongoDB struct {
-	Address     string
-	DataDBName  string
-	ConnTimeout int
+	Address                string
+	DataDBName             string
+	ConnTimeout            int
+	Username               string
+	Password               string
+	AuthSource             string
+	MaxPoolSize            int
+	MinPoolSize            int
+	ReadPreference         string
+	ServerSelectionTimeout time.Duration
+	RetryReads             bool
+	RetryWrites            bool
+	LazyConnect            bool
+	ConnectRetryInterval   time.Duration
+}
+
+// DefaultAckWait is the time a crashed node holds its messages before JetStream redelivers them,
+// while the messages of a running node are kept in progress.
+const DefaultAckWait = 30 * time.Second
+
+// Database backends of the handler context database.
+const (
+	MongoDBBackend = "mongodb"
+	FileBackend    = "file"
+	MemoryBackend  = "memory"
+	KVBackend      = "kv"
+)
+
+// Database holds the backend of the handler context database. Documents are kept in MongoDB, in
+// files of the Dir directory, in memory, or in the KVBucket JetStream key-value store.
+type Database struct {
+	Backend  string
+	Dir      string
+	KVBucket string
 }
 
 type ConfigNATS struct {
-	Server                    string
-	Stream                    string
-	InputSubjects             []string
-	OutputSubject             string
-	ObjectStoreName           string
-	KeyValueStoreProjectName  string
-	KeyValueStoreWorkflowName string
-	KeyValueStoreNodeName     string
-	MongoWriterSubject        string
-	MaxPendingAck             int
+	Server                       string
+	Stream                       string
+	InputSubjects                []string
+	OutputSubject                string
+	ObjectStoreName              string
+	ObjectStoreProjectName       string
+	ObjectStoreWorkflowName      string
+	KeyValueStoreProjectName     string
+	KeyValueStoreWorkflowName    string
+	KeyValueStoreNodeName        string
+	MongoWriterSubject           string
+	MongoWriterBatchSubject      string
+	MaxPendingAck                int
+	AsyncPublish                 bool
+	PublishAckTimeout            time.Duration
+	PublishErrorPolicy           string
+	KeyValueStoreIdempotencyName string
+	IdempotencyTTL               time.Duration
+	KeyValueStoreJoinName        string
+	JoinTTL                      time.Duration
+	SubscriptionMode             string
+	PullBatchSize                int
+	PullMaxWaiting               int
+	PullFetchMaxWait             time.Duration
+	AckWait                      time.Duration
+	InProgressInterval           time.Duration
+	DeliverPolicy                string
+	DeliverStartTime             time.Time
+	ReconcileConsumers           bool
+	Connection                   Connection
+}
+
+type Connection struct {
+	Name          string
+	User          string
+	Password      string
+	Token         string
+	CredsFile     string
+	TLSCertFile   string
+	TLSKeyFile    string
+	TLSCAFile     string
+	MaxReconnects int
+	ReconnectWait time.Duration
 }
 
 type InfluxDB struct {
 	URI string
 }
 
-func NewConfig(logger *simplelogger.SimpleLogger) Config {
-	maxPendingAck, err := strconv.Atoi(getOptCfgFromEnv(logger, "KRT_MAX_PENDING_ACK"))
-	if err != nil {
-		maxPendingAck = -1
+// Timeouts of the requests to the mongo writer and MongoDB made from the handler context.
+// Handler is the deadline of the context given to each handler execution, zero for none.
+type Timeouts struct {
+	SaveMetric time.Duration
+	SaveData   time.Duration
+	GetData    time.Duration
+	Handler    time.Duration
+}
+
+// Secrets holds the base64 encoded AES-256 key encrypting the configuration secrets, given
+// directly or in a file.
+type Secrets struct {
+	Key     string
+	KeyFile string
+}
+
+// ObjectStore holds the object stores settings. The objects cache is disabled when
+// CacheMaxBytes is zero, and kept in memory unless a CacheDir is given.
+type ObjectStore struct {
+	SweepInterval time.Duration
+	CacheMaxBytes int
+	CacheDir      string
+}
+
+type Health struct {
+	Address           string
+	DatabaseReadiness bool
+}
+
+type Batch struct {
+	Size    int
+	MaxWait time.Duration
+}
+
+type Limits struct {
+	RateLimit          float64
+	RateLimitBurst     int
+	MaxConcurrency     int
+	NodeRateLimits     map[string]float64
+	NodeMaxConcurrency map[string]int
+}
+
+const (
+	defaultPublishAckTimeout  = 5 * time.Second
+	defaultPublishErrorPolicy = "fail"
+	defaultIdempotencyTTL     = 24 * time.Hour
+	defaultJoinTTL            = 24 * time.Hour
+	defaultBatchSize          = 32
+	defaultBatchMaxWait       = 100 * time.Millisecond
+	defaultSaveBatchSize      = 100
+	defaultSaveBatchMaxWait   = time.Second
+	defaultPullBatchSize      = 10
+	defaultPullMaxWaiting     = 512
+	defaultMaxReconnects      = 60
+	defaultReconnectWait      = 2 * time.Second
+	defaultPullFetchMaxWait   = 5 * time.Second
+	defaultRequestTimeout     = 1 * time.Second
+	defaultMongoDataDBName    = "data"
+	defaultMongoConnTimeout   = 120
+
+	defaultMongoReadPreference       = "primary"
+	defaultMongoConnectRetryInterval = 5 * time.Second
+
+	defaultObjectStoreSweepInterval = time.Minute
+)
+
+// NewConfig reads the configuration from the config file given by KRT_CONFIG_FILE or --config-file,
+// the command line flags and the env vars, in increasing order of precedence.
+func NewConfig(logger *simplelogger.SimpleLogger) (Config, error) {
+	return LoadConfig(logger, os.Args[1:], os.LookupEnv)
+}
+
+// LoadConfig reads the configuration from the given command line arguments and env vars lookup,
+// returning an *Error listing every missing or invalid value.
+func LoadConfig(
+	logger *simplelogger.SimpleLogger,
+	args []string,
+	lookupEnv func(string) (string, bool),
+) (Config, error) {
+	l := newLoader(logger, args, lookupEnv)
+
+	ackWait := l.positiveDuration("KRT_NATS_ACK_WAIT", DefaultAckWait)
+
+	// batches have their own subject, so mongo writers without batch support never receive them
+	mongoWriterSubject := l.required("KRT_NATS_MONGO_WRITER")
+	mongoWriterBatchSubject := l.optional("KRT_NATS_MONGO_WRITER_BATCH", mongoWriterSubject+".batch")
+
+	// notify progress a few times per ack wait, so a single lost notification doesn't cause a redelivery
+	inProgressInterval := l.positiveDuration("KRT_NATS_IN_PROGRESS_INTERVAL", ackWait/3)
+	if inProgressInterval >= ackWait {
+		l.invalid("KRT_NATS_IN_PROGRESS_INTERVAL", inProgressInterval.String(), "must be shorter than the ack wait")
+	}
+
+	deliverPolicy := l.oneOf("KRT_NATS_DELIVER_POLICY", "new", "new", "all", "by_start_time")
+	deliverStartTime := l.timestamp("KRT_NATS_DELIVER_START_TIME")
+	if deliverPolicy == "by_start_time" && deliverStartTime.IsZero() {
+		l.problems = append(l.problems, "the \"KRT_NATS_DELIVER_START_TIME\" value is missing for the by_start_time deliver policy")
 	}
 
-	return Config{
-		WorkflowName: getCfgFromEnv(logger, "KRT_WORKFLOW_NAME"),
-		RuntimeID:    getCfgFromEnv(logger, "KRT_RUNTIME_ID"),
-		VersionID:    getCfgFromEnv(logger, "KRT_VERSION_ID"),
-		Version:      getCfgFromEnv(logger, "KRT_VERSION"),
-		NodeName:     getCfgFromEnv(logger, "KRT_NODE_NAME"),
-		BasePath:     getCfgFromEnv(logger, "KRT_BASE_PATH"),
+	database := Database{
+		Backend: l.oneOf("KRT_DATABASE_BACKEND", MongoDBBackend, MongoDBBackend, FileBackend, MemoryBackend, KVBackend),
+	}
+	switch database.Backend {
+	case FileBackend:
+		database.Dir = l.required("KRT_DATABASE_DIR")
+	case KVBackend:
+		database.KVBucket = l.required("KRT_DATABASE_KV_BUCKET")
+	}
+
+	// MongoDB is only required by its backend
+	var mongoURI string
+	if database.Backend == MongoDBBackend {
+		mongoURI = l.required("KRT_MONGO_URI")
+	} else {
+		mongoURI = l.optional("KRT_MONGO_URI", "")
+	}
+
+	cfg := Config{
+		WorkflowName: l.required("KRT_WORKFLOW_NAME"),
+		RuntimeID:    l.required("KRT_RUNTIME_ID"),
+		VersionID:    l.required("KRT_VERSION_ID"),
+		Version:      l.required("KRT_VERSION"),
+		NodeName:     l.required("KRT_NODE_NAME"),
+		BasePath:     l.required("KRT_BASE_PATH"),
 		NATS: ConfigNATS{
-			Server:                    getCfgFromEnv(logger, "KRT_NATS_SERVER"),
-			Stream:                    getCfgFromEnv(logger, "KRT_NATS_STREAM"),
-			InputSubjects:             getSubscriptionsFromEnv(logger, "KRT_NATS_INPUTS"),
-			OutputSubject:             getCfgFromEnv(logger, "KRT_NATS_OUTPUT"),
-			ObjectStoreName:           getOptCfgFromEnv(logger, "KRT_NATS_OBJECT_STORE"),
-			KeyValueStoreProjectName:  getCfgFromEnv(logger, "KRT_NATS_KEY_VALUE_STORE_PROJECT"),
-			KeyValueStoreWorkflowName: getCfgFromEnv(logger, "KRT_NATS_KEY_VALUE_STORE_WORKFLOW"),
-			KeyValueStoreNodeName:     getCfgFromEnv(logger, "KRT_NATS_KEY_VALUE_STORE_NODE"),
-			MongoWriterSubject:        getCfgFromEnv(logger, "KRT_NATS_MONGO_WRITER"),
-			MaxPendingAck:             maxPendingAck,
+			Server:                       l.required("KRT_NATS_SERVER"),
+			Stream:                       l.required("KRT_NATS_STREAM"),
+			InputSubjects:                l.list("KRT_NATS_INPUTS"),
+			OutputSubject:                l.required("KRT_NATS_OUTPUT"),
+			ObjectStoreName:              l.optional("KRT_NATS_OBJECT_STORE", ""),
+			ObjectStoreProjectName:       l.optional("KRT_NATS_OBJECT_STORE_PROJECT", ""),
+			ObjectStoreWorkflowName:      l.optional("KRT_NATS_OBJECT_STORE_WORKFLOW", ""),
+			KeyValueStoreProjectName:     l.required("KRT_NATS_KEY_VALUE_STORE_PROJECT"),
+			KeyValueStoreWorkflowName:    l.required("KRT_NATS_KEY_VALUE_STORE_WORKFLOW"),
+			KeyValueStoreNodeName:        l.required("KRT_NATS_KEY_VALUE_STORE_NODE"),
+			MongoWriterSubject:           mongoWriterSubject,
+			MongoWriterBatchSubject:      mongoWriterBatchSubject,
+			MaxPendingAck:                l.integer("KRT_MAX_PENDING_ACK", -1),
+			AsyncPublish:                 l.boolean("KRT_NATS_ASYNC_PUBLISH", false),
+			PublishAckTimeout:            l.positiveDuration("KRT_NATS_PUBLISH_ACK_TIMEOUT", defaultPublishAckTimeout),
+			PublishErrorPolicy:           l.oneOf("KRT_PUBLISH_ERROR_POLICY", defaultPublishErrorPolicy, "fail", "ignore"),
+			KeyValueStoreIdempotencyName: l.optional("KRT_NATS_KEY_VALUE_STORE_IDEMPOTENCY", ""),
+			IdempotencyTTL:               l.positiveDuration("KRT_IDEMPOTENCY_TTL", defaultIdempotencyTTL),
+			KeyValueStoreJoinName:        l.optional("KRT_NATS_KEY_VALUE_STORE_JOIN", ""),
+			JoinTTL:                      l.positiveDuration("KRT_JOIN_TTL", defaultJoinTTL),
+			SubscriptionMode:             l.oneOf("KRT_NATS_SUBSCRIPTION_MODE", "push", "push", "pull"),
+			PullBatchSize:                l.positiveInteger("KRT_NATS_PULL_BATCH_SIZE", defaultPullBatchSize),
+			PullMaxWaiting:               l.positiveInteger("KRT_NATS_PULL_MAX_WAITING", defaultPullMaxWaiting),
+			PullFetchMaxWait:             l.positiveDuration("KRT_NATS_PULL_FETCH_MAX_WAIT", defaultPullFetchMaxWait),
+			AckWait:                      ackWait,
+			InProgressInterval:           inProgressInterval,
+			DeliverPolicy:                deliverPolicy,
+			DeliverStartTime:             deliverStartTime,
+			ReconcileConsumers:           l.boolean("KRT_NATS_RECONCILE_CONSUMERS", false),
+			Connection: Connection{
+				Name:          l.optional("KRT_NATS_CONNECTION_NAME", ""),
+				User:          l.optional("KRT_NATS_USER", ""),
+				Password:      l.optional("KRT_NATS_PASSWORD", ""),
+				Token:         l.optional("KRT_NATS_TOKEN", ""),
+				CredsFile:     l.optional("KRT_NATS_CREDS_FILE", ""),
+				TLSCertFile:   l.optional("KRT_NATS_TLS_CERT_FILE", ""),
+				TLSKeyFile:    l.optional("KRT_NATS_TLS_KEY_FILE", ""),
+				TLSCAFile:     l.optional("KRT_NATS_TLS_CA_FILE", ""),
+				MaxReconnects: l.integer("KRT_NATS_MAX_RECONNECTS", defaultMaxReconnects),
+				ReconnectWait: l.positiveDuration("KRT_NATS_RECONNECT_WAIT", defaultReconnectWait),
+			},
 		},
 		MongoDB: MongoDB{
-			Address:     getCfgFromEnv(logger, "KRT_MONGO_URI"),
-			DataDBName:  "data",
-			ConnTimeout: 120,
+			Address:     mongoURI,
+			DataDBName:  l.optional("KRT_MONGO_DATA_DB_NAME", defaultMongoDataDBName),
+			ConnTimeout: l.positiveInteger("KRT_MONGO_CONN_TIMEOUT", defaultMongoConnTimeout),
+			Username:    l.optional("KRT_MONGO_USERNAME", ""),
+			Password:    l.optional("KRT_MONGO_PASSWORD", ""),
+			AuthSource:  l.optional("KRT_MONGO_AUTH_SOURCE", ""),
+			MaxPoolSize: l.integer("KRT_MONGO_MAX_POOL_SIZE", 0),
+			MinPoolSize: l.integer("KRT_MONGO_MIN_POOL_SIZE", 0),
+			ReadPreference: l.oneOf("KRT_MONGO_READ_PREFERENCE", defaultMongoReadPreference,
+				"primary", "primaryPreferred", "secondary", "secondaryPreferred", "nearest"),
+			ServerSelectionTimeout: l.duration("KRT_MONGO_SERVER_SELECTION_TIMEOUT", 0),
+			RetryReads:             l.boolean("KRT_MONGO_RETRY_READS", true),
+			RetryWrites:            l.boolean("KRT_MONGO_RETRY_WRITES", true),
+			LazyConnect:            l.boolean("KRT_MONGO_LAZY_CONNECT", false),
+			ConnectRetryInterval:   l.positiveDuration("KRT_MONGO_CONNECT_RETRY_INTERVAL", defaultMongoConnectRetryInterval),
 		},
+		Database: database,
 		InfluxDB: InfluxDB{
-			URI: getCfgFromEnv(logger, "KRT_INFLUX_URI"),
+			URI: l.required("KRT_INFLUX_URI"),
+		},
+		Batch: Batch{
+			Size:    l.positiveInteger("KRT_BATCH_SIZE", defaultBatchSize),
+			MaxWait: l.positiveDuration("KRT_BATCH_MAX_WAIT", defaultBatchMaxWait),
+		},
+		SaveBatch: Batch{
+			Size:    l.positiveInteger("KRT_SAVE_BATCH_SIZE", defaultSaveBatchSize),
+			MaxWait: l.positiveDuration("KRT_SAVE_BATCH_MAX_WAIT", defaultSaveBatchMaxWait),
+		},
+		Limits: Limits{
+			RateLimit:          l.float("KRT_RATE_LIMIT", 0),
+			RateLimitBurst:     l.integer("KRT_RATE_LIMIT_BURST", 1),
+			MaxConcurrency:     l.integer("KRT_MAX_CONCURRENCY", 0),
+			NodeRateLimits:     l.nodeRateLimits("KRT_RATE_LIMIT_NODES"),
+			NodeMaxConcurrency: l.nodeMaxConcurrency("KRT_MAX_CONCURRENCY_NODES"),
+		},
+		Health: Health{
+			Address:           l.optional("KRT_HEALTH_ADDRESS", ""),
+			DatabaseReadiness: l.boolean("KRT_HEALTH_DATABASE_READINESS", false),
+		},
+		Secrets: Secrets{
+			Key:     l.optional("KRT_CONFIGURATION_SECRET_KEY", ""),
+			KeyFile: l.optional("KRT_CONFIGURATION_SECRET_KEY_FILE", ""),
+		},
+		ObjectStore: ObjectStore{
+			SweepInterval: l.duration("KRT_OBJECT_STORE_SWEEP_INTERVAL", defaultObjectStoreSweepInterval),
+			CacheMaxBytes: l.integer("KRT_OBJECT_STORE_CACHE_MAX_BYTES", 0),
+			CacheDir:      l.optional("KRT_OBJECT_STORE_CACHE_DIR", ""),
+		},
+		Timeouts: Timeouts{
+			SaveMetric: l.positiveDuration("KRT_SAVE_METRIC_TIMEOUT", defaultRequestTimeout),
+			SaveData:   l.positiveDuration("KRT_SAVE_DATA_TIMEOUT", defaultRequestTimeout),
+			GetData:    l.positiveDuration("KRT_GET_DATA_TIMEOUT", defaultRequestTimeout),
+			Handler:    l.duration("KRT_HANDLER_TIMEOUT", 0),
 		},
 	}
-}
 
-func getCfgFromEnv(logger *simplelogger.SimpleLogger, name string) string {
-	val, ok := os.LookupEnv(name)
-	if !ok {
-		logger.Errorf("Error reading config: the %q env var is missing", name)
-		os.Exit(1)
+	if cfg.MongoDB.MaxPoolSize < 0 {
+		l.invalid("KRT_MONGO_MAX_POOL_SIZE", strconv.Itoa(cfg.MongoDB.MaxPoolSize), "can't be negative")
 	}
-	return val
-}
-
-func getOptCfgFromEnv(logger *simplelogger.SimpleLogger, name string) string {
-	val, ok := os.LookupEnv(name)
-	if !ok {
-		logger.Infof("The %q env var is missing", name)
-		return ""
+	if cfg.MongoDB.MinPoolSize < 0 {
+		l.invalid("KRT_MONGO_MIN_POOL_SIZE", strconv.Itoa(cfg.MongoDB.MinPoolSize), "can't be negative")
+	} else if cfg.MongoDB.MaxPoolSize > 0 && cfg.MongoDB.MinPoolSize > cfg.MongoDB.MaxPoolSize {
+		l.invalid("KRT_MONGO_MIN_POOL_SIZE", strconv.Itoa(cfg.MongoDB.MinPoolSize), "exceeds the max pool size")
 	}
 
-	return val
-}
-
-func getSubscriptionsFromEnv(logger *simplelogger.SimpleLogger, name string) []string {
-	val, ok := os.LookupEnv(name)
-	if !ok {
-		logger.Errorf("Error reading config: the %q env var is missing", name)
-		os.Exit(1)
+	if err := l.err(); err != nil {
+		return Config{}, err
 	}
 
-	return strings.Split(val, ",")
+	return cfg, nil
 }
@@ -0,0 +1,204 @@
+//go:build unit
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/konstellation-io/kre/libs/simplelogger"
+	"github.com/stretchr/testify/suite"
+)
+
+type ConfigTestSuite struct {
+	suite.Suite
+	logger *simplelogger.SimpleLogger
+	env    map[string]string
+}
+
+func TestConfigTestSuite(t *testing.T) {
+	suite.Run(t, new(ConfigTestSuite))
+}
+
+func (suite *ConfigTestSuite) SetupTest() {
+	suite.logger = simplelogger.New(simplelogger.LevelInfo)
+	suite.env = map[string]string{
+		"KRT_WORKFLOW_NAME":                 "workflow",
+		"KRT_RUNTIME_ID":                    "runtime1",
+		"KRT_VERSION_ID":                    "version-id",
+		"KRT_VERSION":                       "v1",
+		"KRT_NODE_NAME":                     "nodeA",
+		"KRT_BASE_PATH":                     "/krt-files",
+		"KRT_NATS_SERVER":                   "nats://localhost:4222",
+		"KRT_NATS_STREAM":                   "runtime1_v1_workflow",
+		"KRT_NATS_INPUTS":                   "runtime1_v1_workflow.entrypoint",
+		"KRT_NATS_OUTPUT":                   "runtime1_v1_workflow.nodeA",
+		"KRT_NATS_KEY_VALUE_STORE_PROJECT":  "project",
+		"KRT_NATS_KEY_VALUE_STORE_WORKFLOW": "workflow",
+		"KRT_NATS_KEY_VALUE_STORE_NODE":     "node",
+		"KRT_NATS_MONGO_WRITER":             "mongo_writer",
+		"KRT_MONGO_URI":                     "mongodb://localhost:27017",
+		"KRT_INFLUX_URI":                    "http://localhost:8086",
+	}
+}
+
+func (suite *ConfigTestSuite) lookupEnv(name string) (string, bool) {
+	val, ok := suite.env[name]
+	return val, ok
+}
+
+func (suite *ConfigTestSuite) TestLoadConfigDefaults() {
+	cfg, err := LoadConfig(suite.logger, nil, suite.lookupEnv)
+	suite.Require().NoError(err)
+
+	suite.Equal("nodeA", cfg.NodeName)
+	suite.Equal([]string{"runtime1_v1_workflow.entrypoint"}, cfg.NATS.InputSubjects)
+	suite.Equal(-1, cfg.NATS.MaxPendingAck)
+	suite.Equal(DefaultAckWait, cfg.NATS.AckWait)
+	suite.Equal(DefaultAckWait/3, cfg.NATS.InProgressInterval)
+	suite.Equal("mongo_writer.batch", cfg.NATS.MongoWriterBatchSubject)
+	suite.Equal(defaultMongoDataDBName, cfg.MongoDB.DataDBName)
+	suite.Equal(defaultMongoConnTimeout, cfg.MongoDB.ConnTimeout)
+	suite.Equal(time.Second, cfg.Timeouts.GetData)
+}
+
+func (suite *ConfigTestSuite) TestLoadConfigListsEveryProblem() {
+	// GIVEN missing and invalid values
+	delete(suite.env, "KRT_NODE_NAME")
+	delete(suite.env, "KRT_NATS_SERVER")
+	suite.env["KRT_BATCH_SIZE"] = "many"
+
+	// WHEN the config is loaded
+	_, err := LoadConfig(suite.logger, nil, suite.lookupEnv)
+
+	// THEN all of them are reported
+	var cfgErr *Error
+	suite.Require().ErrorAs(err, &cfgErr)
+	suite.Len(cfgErr.Problems, 3)
+	suite.Contains(err.Error(), "KRT_NODE_NAME")
+	suite.Contains(err.Error(), "KRT_NATS_SERVER")
+	suite.Contains(err.Error(), "KRT_BATCH_SIZE")
+}
+
+func (suite *ConfigTestSuite) TestLoadConfigSourcesPrecedence() {
+	// GIVEN a config file, flags and env vars setting the same values
+	configFile := filepath.Join(suite.T().TempDir(), "config.yaml")
+	err := os.WriteFile(configFile, []byte(`
+node_name: fileNode
+nats_inputs:
+  - subjectA
+  - subjectB
+mongo_data_db_name: fileDB
+max_concurrency_nodes:
+  nodeB: 2
+batch_size: 8
+`), 0o600)
+	suite.Require().NoError(err)
+
+	delete(suite.env, "KRT_NODE_NAME")
+	delete(suite.env, "KRT_NATS_INPUTS")
+	suite.env["KRT_BATCH_SIZE"] = "16"
+
+	args := []string{"--config-file=" + configFile, "--mongo-data-db-name=flagDB", "--batch-size=4", "--unknown"}
+
+	// WHEN the config is loaded
+	cfg, err := LoadConfig(suite.logger, args, suite.lookupEnv)
+	suite.Require().NoError(err)
+
+	// THEN env vars take precedence over flags, and flags over the config file
+	suite.Equal("fileNode", cfg.NodeName)
+	suite.Equal([]string{"subjectA", "subjectB"}, cfg.NATS.InputSubjects)
+	suite.Equal(map[string]int{"nodeB": 2}, cfg.Limits.NodeMaxConcurrency)
+	suite.Equal("flagDB", cfg.MongoDB.DataDBName)
+	suite.Equal(16, cfg.Batch.Size)
+}
+
+func (suite *ConfigTestSuite) TestParseFlagsOnlyTakesValuesAfterEquals() {
+	// GIVEN flags mixed with positional arguments, negative numbers and the arguments after --
+	args := []string{"--reconcile-consumers", "input.csv", "--batch-size=-1", "-3", "--", "--node-name=ignored"}
+
+	// WHEN they are parsed
+	flags := parseFlags(args)
+
+	// THEN flags without value are true, and no other argument is taken as a value
+	suite.Equal(map[string]string{
+		"KRT_RECONCILE_CONSUMERS": "true",
+		"KRT_BATCH_SIZE":          "-1",
+	}, flags)
+}
+
+func (suite *ConfigTestSuite) TestLoadConfigDatabaseBackend() {
+	// GIVEN the kv database backend without MongoDB
+	delete(suite.env, "KRT_MONGO_URI")
+	suite.env["KRT_DATABASE_BACKEND"] = KVBackend
+	suite.env["KRT_DATABASE_KV_BUCKET"] = "documents"
+
+	// WHEN the config is loaded
+	cfg, err := LoadConfig(suite.logger, nil, suite.lookupEnv)
+
+	// THEN the MongoDB URI is not required
+	suite.Require().NoError(err)
+	suite.Equal(Database{Backend: KVBackend, KVBucket: "documents"}, cfg.Database)
+	suite.Empty(cfg.MongoDB.Address)
+}
+
+func (suite *ConfigTestSuite) TestLoadConfigDatabaseBackendRequirements() {
+	// GIVEN the default mongodb backend without MongoDB, the kv backend without bucket, and the
+	// file backend without directory
+	delete(suite.env, "KRT_MONGO_URI")
+
+	_, mongoErr := LoadConfig(suite.logger, nil, suite.lookupEnv)
+
+	suite.env["KRT_DATABASE_BACKEND"] = KVBackend
+	_, kvErr := LoadConfig(suite.logger, nil, suite.lookupEnv)
+
+	suite.env["KRT_DATABASE_BACKEND"] = FileBackend
+	_, fileErr := LoadConfig(suite.logger, nil, suite.lookupEnv)
+
+	suite.env["KRT_DATABASE_BACKEND"] = "sqlite"
+	_, unknownErr := LoadConfig(suite.logger, nil, suite.lookupEnv)
+
+	// THEN the missing and invalid values are reported
+	suite.ErrorContains(mongoErr, "KRT_MONGO_URI")
+	suite.ErrorContains(kvErr, "KRT_DATABASE_KV_BUCKET")
+	suite.ErrorContains(fileErr, "KRT_DATABASE_DIR")
+	suite.ErrorContains(unknownErr, "KRT_DATABASE_BACKEND")
+}
+
+func (suite *ConfigTestSuite) TestLoadConfigMongoDBConnection() {
+	// GIVEN the MongoDB connection settings
+	suite.env["KRT_MONGO_MAX_POOL_SIZE"] = "20"
+	suite.env["KRT_MONGO_MIN_POOL_SIZE"] = "2"
+	suite.env["KRT_MONGO_READ_PREFERENCE"] = "secondaryPreferred"
+	suite.env["KRT_MONGO_RETRY_WRITES"] = "false"
+	suite.env["KRT_MONGO_LAZY_CONNECT"] = "true"
+
+	// WHEN the config is loaded
+	cfg, err := LoadConfig(suite.logger, nil, suite.lookupEnv)
+
+	// THEN they are read along with the defaults
+	suite.Require().NoError(err)
+	suite.Equal(20, cfg.MongoDB.MaxPoolSize)
+	suite.Equal(2, cfg.MongoDB.MinPoolSize)
+	suite.Equal("secondaryPreferred", cfg.MongoDB.ReadPreference)
+	suite.True(cfg.MongoDB.RetryReads)
+	suite.False(cfg.MongoDB.RetryWrites)
+	suite.True(cfg.MongoDB.LazyConnect)
+	suite.Equal(defaultMongoConnectRetryInterval, cfg.MongoDB.ConnectRetryInterval)
+}
+
+func (suite *ConfigTestSuite) TestLoadConfigInvalidMongoDBConnection() {
+	// GIVEN an unknown read preference and a min pool size exceeding the max one
+	suite.env["KRT_MONGO_READ_PREFERENCE"] = "fastest"
+	suite.env["KRT_MONGO_MAX_POOL_SIZE"] = "2"
+	suite.env["KRT_MONGO_MIN_POOL_SIZE"] = "5"
+
+	// WHEN the config is loaded
+	_, err := LoadConfig(suite.logger, nil, suite.lookupEnv)
+
+	// THEN both are reported
+	suite.ErrorContains(err, "KRT_MONGO_READ_PREFERENCE")
+	suite.ErrorContains(err, "KRT_MONGO_MIN_POOL_SIZE")
+}
@@ -0,0 +1,361 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/konstellation-io/kre/libs/simplelogger"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	configFileName = "KRT_CONFIG_FILE"
+	envPrefix      = "KRT_"
+)
+
+// Error lists every missing or invalid configuration value.
+type Error struct {
+	Problems []string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("invalid configuration: %s", strings.Join(e.Problems, "; "))
+}
+
+// loader reads each configuration value from the env vars, the command line flags or the
+// config file, in decreasing order of precedence, collecting every problem found.
+//
+// Values are named after their env var. Flags and config file keys can omit the KRT_ prefix
+// and use lowercase and dashes, e.g. --nats-server or nats_server for KRT_NATS_SERVER.
+type loader struct {
+	logger    *simplelogger.SimpleLogger
+	lookupEnv func(string) (string, bool)
+	flags     map[string]string
+	file      map[string]string
+	problems  []string
+}
+
+func newLoader(logger *simplelogger.SimpleLogger, args []string, lookupEnv func(string) (string, bool)) *loader {
+	l := &loader{
+		logger:    logger,
+		lookupEnv: lookupEnv,
+		flags:     parseFlags(args),
+		file:      make(map[string]string),
+	}
+
+	if path, ok := l.lookup(configFileName); ok && path != "" {
+		file, err := readConfigFile(path)
+		if err != nil {
+			l.problems = append(l.problems, err.Error())
+		} else {
+			l.file = file
+		}
+	}
+
+	return l
+}
+
+// normalizeName returns the env var name of a flag or config file key.
+func normalizeName(name string) string {
+	name = strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+	if !strings.HasPrefix(name, envPrefix) {
+		name = envPrefix + name
+	}
+
+	return name
+}
+
+// parseFlags reads the --name=value flags, a flag without value being true as the boolean flags
+// of the flag package. Values are never taken from the next argument, so positional arguments
+// and negative numbers are left alone. Unknown flags are ignored, so they can be used by the node
+// itself, and the arguments after -- aren't flags.
+func parseFlags(args []string) map[string]string {
+	flags := make(map[string]string)
+
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+
+		name, value, found := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+
+		// flag names start with a letter, so negative numbers aren't flags
+		if !strings.HasPrefix(arg, "-") || name == "" || !unicode.IsLetter(rune(name[0])) {
+			continue
+		}
+
+		if !found {
+			value = "true"
+		}
+
+		flags[normalizeName(name)] = value
+	}
+
+	return flags
+}
+
+// readConfigFile reads a YAML or JSON file of values. Lists are read as comma separated
+// values and maps as comma separated key=value pairs.
+func readConfigFile(path string) (map[string]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file %q: %w", path, err)
+	}
+
+	var raw map[string]interface{}
+
+	err = yaml.Unmarshal(content, &raw)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing config file %q: %w", path, err)
+	}
+
+	values := make(map[string]string, len(raw))
+
+	for key, val := range raw {
+		switch v := val.(type) {
+		case []interface{}:
+			items := make([]string, 0, len(v))
+			for _, item := range v {
+				items = append(items, fmt.Sprint(item))
+			}
+			values[normalizeName(key)] = strings.Join(items, ",")
+		case map[string]interface{}:
+			pairs := make([]string, 0, len(v))
+			for k, item := range v {
+				pairs = append(pairs, fmt.Sprintf("%s=%v", k, item))
+			}
+			sort.Strings(pairs)
+			values[normalizeName(key)] = strings.Join(pairs, ",")
+		case nil:
+			values[normalizeName(key)] = ""
+		default:
+			values[normalizeName(key)] = fmt.Sprint(v)
+		}
+	}
+
+	return values, nil
+}
+
+func (l *loader) lookup(name string) (string, bool) {
+	if val, ok := l.lookupEnv(name); ok {
+		return val, true
+	}
+
+	if val, ok := l.flags[name]; ok {
+		return val, true
+	}
+
+	val, ok := l.file[name]
+
+	return val, ok
+}
+
+func (l *loader) invalid(name, val, reason string) {
+	l.problems = append(l.problems, fmt.Sprintf("the %q value %q is invalid: %s", name, val, reason))
+}
+
+func (l *loader) err() error {
+	if len(l.problems) == 0 {
+		return nil
+	}
+
+	return &Error{Problems: l.problems}
+}
+
+func (l *loader) required(name string) string {
+	val, ok := l.lookup(name)
+	if !ok {
+		l.problems = append(l.problems, fmt.Sprintf("the %q value is missing", name))
+	}
+
+	return val
+}
+
+// optional returns the value, or the default value when it is missing or empty.
+func (l *loader) optional(name, defaultValue string) string {
+	val, ok := l.lookup(name)
+	if !ok {
+		l.logger.Infof("The %q config value is missing", name)
+		return defaultValue
+	}
+
+	if val == "" {
+		return defaultValue
+	}
+
+	return val
+}
+
+func (l *loader) oneOf(name, defaultValue string, allowed ...string) string {
+	val := l.optional(name, defaultValue)
+
+	for _, a := range allowed {
+		if val == a {
+			return val
+		}
+	}
+
+	l.invalid(name, val, fmt.Sprintf("must be one of %s", strings.Join(allowed, ", ")))
+
+	return defaultValue
+}
+
+func (l *loader) list(name string) []string {
+	val := l.required(name)
+	if val == "" {
+		return nil
+	}
+
+	return strings.Split(val, ",")
+}
+
+func (l *loader) integer(name string, defaultValue int) int {
+	val := l.optional(name, "")
+	if val == "" {
+		return defaultValue
+	}
+
+	i, err := strconv.Atoi(val)
+	if err != nil {
+		l.invalid(name, val, "not an integer")
+		return defaultValue
+	}
+
+	return i
+}
+
+func (l *loader) positiveInteger(name string, defaultValue int) int {
+	i := l.integer(name, defaultValue)
+	if i < 1 {
+		l.invalid(name, strconv.Itoa(i), "must be positive")
+		return defaultValue
+	}
+
+	return i
+}
+
+func (l *loader) float(name string, defaultValue float64) float64 {
+	val := l.optional(name, "")
+	if val == "" {
+		return defaultValue
+	}
+
+	f, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		l.invalid(name, val, "not a number")
+		return defaultValue
+	}
+
+	return f
+}
+
+func (l *loader) boolean(name string, defaultValue bool) bool {
+	val := l.optional(name, "")
+	if val == "" {
+		return defaultValue
+	}
+
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		l.invalid(name, val, "not a boolean")
+		return defaultValue
+	}
+
+	return b
+}
+
+func (l *loader) duration(name string, defaultValue time.Duration) time.Duration {
+	val := l.optional(name, "")
+	if val == "" {
+		return defaultValue
+	}
+
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		l.invalid(name, val, "not a duration")
+		return defaultValue
+	}
+
+	return d
+}
+
+func (l *loader) positiveDuration(name string, defaultValue time.Duration) time.Duration {
+	d := l.duration(name, defaultValue)
+	if d <= 0 {
+		l.invalid(name, d.String(), "must be positive")
+		return defaultValue
+	}
+
+	return d
+}
+
+func (l *loader) timestamp(name string) time.Time {
+	val := l.optional(name, "")
+	if val == "" {
+		return time.Time{}
+	}
+
+	t, err := time.Parse(time.RFC3339, val)
+	if err != nil {
+		l.invalid(name, val, "not a RFC3339 time")
+		return time.Time{}
+	}
+
+	return t
+}
+
+// nodeValues reads a comma separated list of node=value pairs.
+func (l *loader) nodeValues(name string) map[string]string {
+	values := make(map[string]string)
+
+	val := l.optional(name, "")
+	if val == "" {
+		return values
+	}
+
+	for _, pair := range strings.Split(val, ",") {
+		node, value, found := strings.Cut(pair, "=")
+		if !found {
+			l.invalid(name, pair, "must be a node=value pair")
+			continue
+		}
+		values[strings.TrimSpace(node)] = strings.TrimSpace(value)
+	}
+
+	return values
+}
+
+func (l *loader) nodeRateLimits(name string) map[string]float64 {
+	limits := make(map[string]float64)
+
+	for node, value := range l.nodeValues(name) {
+		limit, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			l.invalid(name, value, fmt.Sprintf("the rate limit for node %q is not a number", node))
+			continue
+		}
+		limits[node] = limit
+	}
+
+	return limits
+}
+
+func (l *loader) nodeMaxConcurrency(name string) map[string]int {
+	limits := make(map[string]int)
+
+	for node, value := range l.nodeValues(name) {
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			l.invalid(name, value, fmt.Sprintf("the max concurrency for node %q is not an integer", node))
+			continue
+		}
+		limits[node] = limit
+	}
+
+	return limits
+}
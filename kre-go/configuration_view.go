@@ -0,0 +1,161 @@
+package kre
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	utilErrors "github.com/konstellation-io/kre-runners/kre-go/v4/internal/errors"
+)
+
+// ConfigurationView is a local copy of every scope's configuration, kept up to date watching
+// the key-value stores, so values can be read on every message without a request to NATS.
+//
+// As Get does, when no scope is given values are searched starting by Node then upwards.
+type ConfigurationView struct {
+	watcher *ConfigurationWatcher
+	release func()
+	mu      sync.RWMutex
+	values  map[Scope]map[string]string
+}
+
+// View returns the configuration view shared by all the handlers, starting it on first use, so
+// calling it on every message doesn't start new watchers. Once stopped, the next call starts a
+// new view.
+func (cc *contextConfiguration) View() (*ConfigurationView, error) {
+	cc.viewMu.Lock()
+	defer cc.viewMu.Unlock()
+
+	if cc.view != nil {
+		return cc.view, nil
+	}
+
+	view := &ConfigurationView{
+		values: make(map[Scope]map[string]string, len(allScopesInOrder)),
+	}
+	for _, scope := range allScopesInOrder {
+		view.values[scope] = make(map[string]string)
+	}
+
+	watcher, err := cc.newConfigurationWatcher(nats.AllKeys, allScopesInOrder, view.apply)
+	if err != nil {
+		return nil, utilErrors.Wrapper("configuration view: %w")(err)
+	}
+
+	<-watcher.initialized
+
+	view.watcher = watcher
+	view.release = func() {
+		cc.viewMu.Lock()
+		defer cc.viewMu.Unlock()
+
+		if cc.view == view {
+			cc.view = nil
+		}
+	}
+	cc.view = view
+
+	return view, nil
+}
+
+// Stop stops watching the configuration, after which the view keeps its last values.
+func (v *ConfigurationView) Stop() error {
+	v.release()
+
+	return v.watcher.Stop()
+}
+
+func (v *ConfigurationView) apply(update ConfigurationUpdate) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if update.Deleted {
+		delete(v.values[update.Scope], update.Key)
+		return
+	}
+
+	v.values[update.Scope][update.Key] = update.Value
+}
+
+// Get returns the cached value of the key.
+func (v *ConfigurationView) Get(key string, scopeOpt ...Scope) (string, error) {
+	scopes := allScopesInOrder
+	if len(scopeOpt) > 0 {
+		scopes = scopeOpt[:1]
+	}
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	for _, scope := range scopes {
+		if value, ok := v.values[scope][key]; ok {
+			return value, nil
+		}
+	}
+
+	return "", fmt.Errorf("configuration view: error retrieving config with key %q: %w", key, nats.ErrKeyNotFound)
+}
+
+// GetInt returns the cached value of the key as an int.
+func (v *ConfigurationView) GetInt(key string, scopeOpt ...Scope) (int, error) {
+	value, err := v.Get(key, scopeOpt...)
+	if err != nil {
+		return 0, err
+	}
+
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("configuration view: config with key %q is not an int: %w", key, err)
+	}
+
+	return i, nil
+}
+
+// GetBool returns the cached value of the key as a bool.
+func (v *ConfigurationView) GetBool(key string, scopeOpt ...Scope) (bool, error) {
+	value, err := v.Get(key, scopeOpt...)
+	if err != nil {
+		return false, err
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("configuration view: config with key %q is not a bool: %w", key, err)
+	}
+
+	return b, nil
+}
+
+// GetDuration returns the cached value of the key as a duration, e.g. "1m30s".
+func (v *ConfigurationView) GetDuration(key string, scopeOpt ...Scope) (time.Duration, error) {
+	value, err := v.Get(key, scopeOpt...)
+	if err != nil {
+		return 0, err
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("configuration view: config with key %q is not a duration: %w", key, err)
+	}
+
+	return d, nil
+}
+
+// GetJSON decodes the cached JSON value of the key into the value pointed to by target.
+func (v *ConfigurationView) GetJSON(key string, target interface{}, scopeOpt ...Scope) error {
+	value, err := v.Get(key, scopeOpt...)
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal([]byte(value), target)
+	if err != nil {
+		return fmt.Errorf("configuration view: config with key %q is not a valid JSON: %w", key, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,226 @@
+package kre
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/nats-io/nats.go"
+
+	utilErrors "github.com/konstellation-io/kre-runners/kre-go/v4/internal/errors"
+)
+
+// ConfigurationUpdate is a change of a configuration value. Deleted is true when the key was
+// deleted or purged, in which case Value is empty. Secret values are given decrypted, and
+// redacted when the update is formatted.
+type ConfigurationUpdate struct {
+	Scope    Scope
+	Key      string
+	Value    string
+	Revision uint64
+	Deleted  bool
+	Secret   bool
+}
+
+func (u ConfigurationUpdate) String() string {
+	value := u.Value
+	if u.Secret {
+		value = redactedSecret
+	}
+
+	return fmt.Sprintf("{Scope:%s Key:%s Value:%s Revision:%d Deleted:%t Secret:%t}",
+		u.Scope, u.Key, value, u.Revision, u.Deleted, u.Secret)
+}
+
+// newConfigurationUpdate returns the update of a key-value entry, decrypting secret values.
+func (cc *contextConfiguration) newConfigurationUpdate(scope Scope, entry nats.KeyValueEntry) ConfigurationUpdate {
+	update := ConfigurationUpdate{
+		Scope:    scope,
+		Key:      entry.Key(),
+		Revision: entry.Revision(),
+		Deleted:  entry.Operation() != nats.KeyValuePut,
+	}
+
+	value, secret, err := cc.secrets.decode(string(entry.Value()), scope, update.Key)
+	if err != nil {
+		cc.logger.Errorf("Error decrypting secret config with key %q: %s", update.Key, err)
+	}
+
+	update.Value = value
+	update.Secret = secret
+
+	return update
+}
+
+// ConfigurationWatcher delivers the updates of the watched configuration keys until stopped.
+type ConfigurationWatcher struct {
+	watchers    []nats.KeyWatcher
+	newUpdate   func(scope Scope, entry nats.KeyValueEntry) ConfigurationUpdate
+	handle      func(update ConfigurationUpdate)
+	updates     chan ConfigurationUpdate
+	done        chan struct{}
+	initialized chan struct{}
+	stopOnce    sync.Once
+}
+
+// allScopesInOrder is the lookup order of the configuration scopes when none is given.
+var allScopesInOrder = []Scope{NodeScope, WorkflowScope, ProjectScope}
+
+// Watch delivers the updates of the given key to the returned watcher's Updates channel,
+// starting with the current value. The key can use NATS wildcards to watch a prefix, e.g.
+// "model.>" watches every key starting with "model.". Without scope all scopes are watched.
+func (cc *contextConfiguration) Watch(key string, scopeOpt ...Scope) (*ConfigurationWatcher, error) {
+	wrapErr := utilErrors.Wrapper("configuration watch: %w")
+
+	scopes := allScopesInOrder
+	if len(scopeOpt) > 0 {
+		scopes = scopeOpt[:1]
+	}
+
+	w, err := cc.newConfigurationWatcher(key, scopes, nil)
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+
+	return w, nil
+}
+
+// WatchFunc works as Watch, but calls the given callback with each update. Callbacks are
+// called sequentially in a separate goroutine.
+func (cc *contextConfiguration) WatchFunc(
+	key string,
+	callback func(update ConfigurationUpdate),
+	scopeOpt ...Scope,
+) (*ConfigurationWatcher, error) {
+	w, err := cc.Watch(key, scopeOpt...)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		for update := range w.Updates() {
+			callback(update)
+		}
+	}()
+
+	return w, nil
+}
+
+// newConfigurationWatcher starts watching the key in the given scopes. Updates are given to
+// handle, when not nil, instead of being sent to the updates channel.
+func (cc *contextConfiguration) newConfigurationWatcher(
+	key string,
+	scopes []Scope,
+	handle func(update ConfigurationUpdate),
+) (*ConfigurationWatcher, error) {
+	w := &ConfigurationWatcher{
+		newUpdate:   cc.newConfigurationUpdate,
+		handle:      handle,
+		updates:     make(chan ConfigurationUpdate),
+		done:        make(chan struct{}),
+		initialized: make(chan struct{}),
+	}
+
+	var forwarders, pending sync.WaitGroup
+
+	for _, scope := range scopes {
+		kvStore, ok := cc.kvStoresMap[scope]
+		if !ok {
+			_ = w.Stop()
+			return nil, fmt.Errorf("could not find key value store given scope %q", scope)
+		}
+
+		kvWatcher, err := kvStore.Watch(key)
+		if err != nil {
+			_ = w.Stop()
+			return nil, err
+		}
+
+		w.watchers = append(w.watchers, kvWatcher)
+
+		forwarders.Add(1)
+		pending.Add(1)
+
+		go func(scope Scope, kvWatcher nats.KeyWatcher) {
+			defer forwarders.Done()
+			w.forward(scope, kvWatcher, pending.Done)
+		}(scope, kvWatcher)
+	}
+
+	go func() {
+		pending.Wait()
+		close(w.initialized)
+	}()
+
+	go func() {
+		forwarders.Wait()
+		close(w.updates)
+	}()
+
+	return w, nil
+}
+
+// forward sends the entries of a key-value watcher to the updates channel, calling
+// initialized once the current values have been delivered.
+func (w *ConfigurationWatcher) forward(scope Scope, kvWatcher nats.KeyWatcher, initialized func()) {
+	initPending := true
+	defer func() {
+		if initPending {
+			initialized()
+		}
+	}()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case entry, ok := <-kvWatcher.Updates():
+			// the key-value watcher closes its updates once stopped, or its subscription closed
+			if !ok {
+				return
+			}
+
+			if entry == nil {
+				if initPending {
+					initPending = false
+					initialized()
+				}
+				continue
+			}
+
+			update := w.newUpdate(scope, entry)
+
+			if w.handle != nil {
+				w.handle(update)
+				continue
+			}
+
+			select {
+			case w.updates <- update:
+			case <-w.done:
+				return
+			}
+		}
+	}
+}
+
+// Updates returns the channel of updates, closed once the watcher is stopped.
+func (w *ConfigurationWatcher) Updates() <-chan ConfigurationUpdate {
+	return w.updates
+}
+
+// Stop stops watching the configuration.
+func (w *ConfigurationWatcher) Stop() error {
+	var err error
+
+	w.stopOnce.Do(func() {
+		close(w.done)
+
+		for _, kvWatcher := range w.watchers {
+			if stopErr := kvWatcher.Stop(); stopErr != nil {
+				err = stopErr
+			}
+		}
+	})
+
+	return err
+}
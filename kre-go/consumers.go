@@ -0,0 +1,135 @@
+package kre
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/konstellation-io/kre/libs/simplelogger"
+	"github.com/nats-io/nats.go"
+
+	"github.com/konstellation-io/kre-runners/kre-go/v4/config"
+)
+
+// reconcileConsumers makes the existing durable consumers of the node match the current
+// configuration before subscribing. Consumers are updated in place when only the ack wait or
+// the max ack pending changed, and deleted so the subscription creates them again otherwise.
+// Consumers with pending messages are never deleted, as the recreated consumer would start
+// delivering following the deliver policy, losing them.
+func reconcileConsumers(
+	cfg config.Config,
+	logger *simplelogger.SimpleLogger,
+	js nats.JetStreamContext,
+	ackPending int,
+) error {
+	deliverPolicy, startTime, err := consumerDeliverPolicy(cfg)
+	if err != nil {
+		return err
+	}
+
+	for _, subject := range cfg.NATS.InputSubjects {
+		consumerName := getConsumerName(subject, cfg.NodeName)
+
+		info, err := js.ConsumerInfo(cfg.NATS.Stream, consumerName)
+		if errors.Is(err, nats.ErrConsumerNotFound) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("error getting consumer %s info: %w", consumerName, err)
+		}
+
+		current := info.Config
+		if !isConsumerCompatible(cfg, current, deliverPolicy, startTime) {
+			if info.NumPending > 0 || info.NumAckPending > 0 {
+				return fmt.Errorf("consumer %s can't be recreated with %d pending and %d unacknowledged messages, "+
+					"revert its configuration changes until they are processed", consumerName, info.NumPending, info.NumAckPending)
+			}
+
+			logger.Infof("Recreating consumer %s due to incompatible configuration changes", consumerName)
+
+			err = js.DeleteConsumer(cfg.NATS.Stream, consumerName)
+			if err != nil && !errors.Is(err, nats.ErrConsumerNotFound) {
+				return fmt.Errorf("error deleting consumer %s: %w", consumerName, err)
+			}
+
+			continue
+		}
+
+		updated := current
+		updated.AckWait = cfg.NATS.AckWait
+		if ackPending > 0 {
+			updated.MaxAckPending = ackPending
+		}
+
+		if updated.AckWait == current.AckWait && updated.MaxAckPending == current.MaxAckPending {
+			continue
+		}
+
+		logger.Infof("Updating consumer %s: ack wait %s, max ack pending %d", consumerName, updated.AckWait, updated.MaxAckPending)
+
+		_, err = js.UpdateConsumer(cfg.NATS.Stream, &updated)
+		if err != nil {
+			return fmt.Errorf("error updating consumer %s: %w", consumerName, err)
+		}
+	}
+
+	return nil
+}
+
+// consumerAckSettings returns the ack wait and max ack pending to subscribe with. Unless consumers
+// are reconciled, an existing consumer keeps its own, as subscribing with different ones fails.
+func consumerAckSettings(
+	cfg config.Config,
+	logger *simplelogger.SimpleLogger,
+	js nats.JetStreamContext,
+	consumerName string,
+	ackPending int,
+) (time.Duration, int, error) {
+	if cfg.NATS.ReconcileConsumers {
+		return cfg.NATS.AckWait, ackPending, nil
+	}
+
+	info, err := js.ConsumerInfo(cfg.NATS.Stream, consumerName)
+	if errors.Is(err, nats.ErrConsumerNotFound) {
+		return cfg.NATS.AckWait, ackPending, nil
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("error getting consumer %s info: %w", consumerName, err)
+	}
+
+	current := info.Config
+	if current.AckWait != cfg.NATS.AckWait || (ackPending > 0 && current.MaxAckPending != ackPending) {
+		logger.Warnf("Consumer %s keeps its ack wait %s and max ack pending %d, "+
+			"enable KRT_NATS_RECONCILE_CONSUMERS to apply the configured ones", consumerName, current.AckWait, current.MaxAckPending)
+	}
+
+	return current.AckWait, current.MaxAckPending, nil
+}
+
+// isConsumerCompatible reports whether the existing consumer can be updated to the current
+// configuration, as JetStream doesn't allow changing the delivery of an existing consumer.
+func isConsumerCompatible(
+	cfg config.Config,
+	current nats.ConsumerConfig,
+	deliverPolicy nats.DeliverPolicy,
+	startTime *time.Time,
+) bool {
+	isPull := cfg.NATS.SubscriptionMode == PullSubscriptionMode
+	if isPull != (current.DeliverSubject == "") {
+		return false
+	}
+
+	if isPull && current.MaxWaiting != cfg.NATS.PullMaxWaiting {
+		return false
+	}
+
+	if current.DeliverPolicy != deliverPolicy {
+		return false
+	}
+
+	if startTime != nil && (current.OptStartTime == nil || !current.OptStartTime.Equal(*startTime)) {
+		return false
+	}
+
+	return true
+}
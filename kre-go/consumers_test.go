@@ -0,0 +1,95 @@
+//go:build unit
+
+package kre
+
+import (
+	"testing"
+	"time"
+
+	"github.com/konstellation-io/kre/libs/simplelogger"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/konstellation-io/kre-runners/kre-go/v4/config"
+)
+
+type fakeConsumersJetStream struct {
+	nats.JetStreamContext
+	info    *nats.ConsumerInfo
+	deleted bool
+}
+
+func (js *fakeConsumersJetStream) ConsumerInfo(_, _ string, _ ...nats.JSOpt) (*nats.ConsumerInfo, error) {
+	return js.info, nil
+}
+
+func (js *fakeConsumersJetStream) DeleteConsumer(_, _ string, _ ...nats.JSOpt) error {
+	js.deleted = true
+	return nil
+}
+
+type ConsumersTestSuite struct {
+	suite.Suite
+}
+
+func TestConsumersTestSuite(t *testing.T) {
+	suite.Run(t, new(ConsumersTestSuite))
+}
+
+func (suite *ConsumersTestSuite) TestIsConsumerCompatible() {
+	cfg := config.Config{}
+	cfg.NATS.AckWait = time.Minute
+
+	pushConsumer := nats.ConsumerConfig{
+		DeliverSubject: "_INBOX.test",
+		DeliverPolicy:  nats.DeliverNewPolicy,
+		AckWait:        22 * time.Hour,
+	}
+
+	// an ack wait change is applied updating the consumer
+	suite.True(isConsumerCompatible(cfg, pushConsumer, nats.DeliverNewPolicy, nil))
+
+	// a delivery change requires recreating the consumer
+	suite.False(isConsumerCompatible(cfg, pushConsumer, nats.DeliverAllPolicy, nil))
+
+	startTime := time.Now()
+	suite.False(isConsumerCompatible(cfg, pushConsumer, nats.DeliverNewPolicy, &startTime))
+
+	cfg.NATS.SubscriptionMode = PullSubscriptionMode
+	cfg.NATS.PullMaxWaiting = 512
+	suite.False(isConsumerCompatible(cfg, pushConsumer, nats.DeliverNewPolicy, nil))
+
+	pullConsumer := nats.ConsumerConfig{
+		DeliverPolicy: nats.DeliverNewPolicy,
+		MaxWaiting:    512,
+	}
+	suite.True(isConsumerCompatible(cfg, pullConsumer, nats.DeliverNewPolicy, nil))
+
+	cfg.NATS.PullMaxWaiting = 128
+	suite.False(isConsumerCompatible(cfg, pullConsumer, nats.DeliverNewPolicy, nil))
+}
+
+func (suite *ConsumersTestSuite) TestReconcileKeepsConsumersWithPendingMessages() {
+	// GIVEN an existing consumer delivering all messages, with messages pending
+	cfg := config.Config{}
+	cfg.NATS.InputSubjects = []string{"input"}
+	cfg.NATS.DeliverPolicy = DeliverNewPolicy
+
+	js := &fakeConsumersJetStream{info: &nats.ConsumerInfo{
+		Config:     nats.ConsumerConfig{DeliverSubject: "_INBOX.test", DeliverPolicy: nats.DeliverAllPolicy},
+		NumPending: 3,
+	}}
+	logger := simplelogger.New(simplelogger.LevelInfo)
+
+	// WHEN the consumers are reconciled with another deliver policy
+	err := reconcileConsumers(cfg, logger, js, -1)
+
+	// THEN the consumer is kept
+	suite.Error(err)
+	suite.False(js.deleted)
+
+	// THEN the consumer is recreated once its messages are processed
+	js.info.NumPending = 0
+	suite.Require().NoError(reconcileConsumers(cfg, logger, js, -1))
+	suite.True(js.deleted)
+}
@@ -1,30 +1,30 @@
 package kre
 
 import (
+	"context"
+	"fmt"
 	"path"
-	"time"
 
 	"github.com/nats-io/nats.go"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/anypb"
 
 	"github.com/konstellation-io/kre-runners/kre-go/v4/config"
+	"github.com/konstellation-io/kre-runners/kre-go/v4/internal/errors"
 	"github.com/konstellation-io/kre-runners/kre-go/v4/mongodb"
 	"github.com/konstellation-io/kre/libs/simplelogger"
 )
 
-var (
-	saveMetricTimeout = 1 * time.Second
-	saveDataTimeout   = 1 * time.Second
-	getDataTimeout    = 1 * time.Second
-)
-
 const (
 	defaultValue = ""
 )
 
-type PublishMsgFunc = func(response proto.Message, reqMsg *KreNatsMessage, msgType MessageType, channel string) error
-type PublishAnyFunc = func(response *anypb.Any, reqMsg *KreNatsMessage, msgType MessageType, channel string)
+type PublishMsgFunc = func(
+	response proto.Message, reqMsg *KreNatsMessage, msgType MessageType, channel string, opts ...PublishOpt,
+) (nats.PubAckFuture, error)
+type PublishAnyFunc = func(
+	response *anypb.Any, reqMsg *KreNatsMessage, msgType MessageType, channel string, opts ...PublishOpt,
+) (nats.PubAckFuture, error)
 
 type HandlerContextParams struct {
 	Cfg                  config.Config
@@ -38,30 +38,52 @@ type HandlerContextParams struct {
 }
 
 type HandlerContext struct {
-	cfg           config.Config
-	publishMsg    PublishMsgFunc
-	publishAny    PublishAnyFunc
-	reqMsg        *KreNatsMessage
-	Logger        *simplelogger.SimpleLogger
-	Prediction    ContextPrediction
-	Measurement   ContextMeasurement
-	DB            ContextDatabase
-	ObjectStore   ContextObjectStore
-	Configuration ContextConfiguration
+	cfg                config.Config
+	ctx                context.Context
+	publishMsg         PublishMsgFunc
+	publishAny         PublishAnyFunc
+	publishes          *publishTracker
+	publishErrorPolicy PublishErrorPolicy
+	joins              *JoinStore
+	reqMsg             *KreNatsMessage
+	Logger             *simplelogger.SimpleLogger
+	Prediction         ContextPrediction
+	Measurement        ContextMeasurement
+	DB                 ContextDatabase
+	ObjectStore        ContextObjectStore
+	Configuration      ContextConfiguration
 }
 
 func NewHandlerContext(params *HandlerContextParams) *HandlerContext {
+	publishErrorPolicy := PublishErrorPolicy(params.Cfg.NATS.PublishErrorPolicy)
+	if err := publishErrorPolicy.IsValid(); err != nil {
+		params.Logger.Errorf("%s, using %q instead", err, FailOnPublishError)
+		publishErrorPolicy = FailOnPublishError
+	}
+
 	return &HandlerContext{
-		cfg:           params.Cfg,
-		publishMsg:    params.PublishMsg,
-		publishAny:    params.PublishAny,
-		Logger:        params.Logger,
-		Prediction:    NewContextPrediction(params.Cfg, params.NC, params.Logger),
-		Measurement:   NewContextMeasurement(params.Cfg, params.Logger),
-		DB:            NewContextDatabase(params.Cfg, params.NC, params.MongoManager, params.Logger),
-		ObjectStore:   params.ContextObjectStore,
-		Configuration: params.ContextConfiguration,
+		cfg:                params.Cfg,
+		publishMsg:         params.PublishMsg,
+		publishAny:         params.PublishAny,
+		publishes:          newPublishTracker(),
+		publishErrorPolicy: publishErrorPolicy,
+		Logger:             params.Logger,
+		Prediction:         NewContextPrediction(params.Cfg, params.NC, params.Logger),
+		Measurement:        NewContextMeasurement(params.Cfg, params.Logger),
+		DB:                 NewContextDatabase(params.Cfg, params.NC, params.MongoManager, params.Logger),
+		ObjectStore:        params.ContextObjectStore,
+		Configuration:      params.ContextConfiguration,
+	}
+}
+
+// Context returns the context of the current handler execution, which is canceled once the
+// handler returns, or when KRT_HANDLER_TIMEOUT expires. Pass it to the ContextDatabase queries
+// so they are bound by the handler's deadline.
+func (c *HandlerContext) Context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
 	}
+	return c.ctx
 }
 
 // Path will return the relative path given as an argument as a full path.
@@ -82,8 +104,11 @@ func (c *HandlerContext) GetRequestID() string {
 //
 // GRPC requests can only be answered once. So once the entrypoint has been replied by the exitpoint,
 // all following replies to the entrypoint from the same request will be ignored.
+//
+// When async publishing is enabled, the returned error only covers failures detected before
+// sending the message, JetStream acknowledgements are awaited once the handler returns.
 func (c *HandlerContext) SendOutput(response proto.Message, channelOpt ...string) error {
-	return c.publishMsg(response, c.reqMsg, MessageType_OK, c.getOptionalString(channelOpt))
+	return c.trackPublish(c.publishMsg(response, c.reqMsg, MessageType_OK, c.getOptionalString(channelOpt), c.publishOpts()...))
 }
 
 // SendAny will send any type of proto payload to the node's subject.
@@ -93,20 +118,99 @@ func (c *HandlerContext) SendOutput(response proto.Message, channelOpt ...string
 //
 // Use this function when you wish to simply redirect your node's payload without unpackaging.
 // Once the entrypoint has been replied, all following replies to the entrypoint will be ignored.
-func (c *HandlerContext) SendAny(response *anypb.Any, channelOpt ...string) {
-	c.publishAny(response, c.reqMsg, MessageType_OK, c.getOptionalString(channelOpt))
+func (c *HandlerContext) SendAny(response *anypb.Any, channelOpt ...string) error {
+	return c.trackPublish(c.publishAny(response, c.reqMsg, MessageType_OK, c.getOptionalString(channelOpt), c.publishOpts()...))
 }
 
 // SendEarlyReply works as the SendOutput functionality
 // with the addition of typing this message as an early reply.
 func (c *HandlerContext) SendEarlyReply(response proto.Message, channelOpt ...string) error {
-	return c.publishMsg(response, c.reqMsg, MessageType_EARLY_REPLY, c.getOptionalString(channelOpt))
+	return c.trackPublish(c.publishMsg(response, c.reqMsg, MessageType_EARLY_REPLY, c.getOptionalString(channelOpt), c.publishOpts()...))
 }
 
 // SendEarlyExit works as the SendOutput functionality
 // with the addition of typing this message as an early exit.
 func (c *HandlerContext) SendEarlyExit(response proto.Message, channelOpt ...string) error {
-	return c.publishMsg(response, c.reqMsg, MessageType_EARLY_EXIT, c.getOptionalString(channelOpt))
+	return c.trackPublish(c.publishMsg(response, c.reqMsg, MessageType_EARLY_EXIT, c.getOptionalString(channelOpt), c.publishOpts()...))
+}
+
+// Scatter sends each response as a part of the current request, tagged with its index and the
+// total number of parts, so that a Gather in the following node can reassemble them in order.
+// Sending stops at the first part that fails to be published.
+func (c *HandlerContext) Scatter(responses []proto.Message, channelOpt ...string) error {
+	if len(responses) == 0 {
+		return errors.ErrEmptyPayload
+	}
+
+	channel := c.getOptionalString(channelOpt)
+
+	for i, response := range responses {
+		opts := c.publishOpts(withPart(i, len(responses)))
+
+		err := c.trackPublish(c.publishMsg(response, c.reqMsg, MessageType_OK, channel, opts...))
+		if err != nil {
+			return fmt.Errorf("error sending part %d of %d: %w", i, len(responses), err)
+		}
+	}
+
+	return nil
+}
+
+// IsMessagePart returns true if the incoming message is one of the parts sent by a Scatter.
+func (c *HandlerContext) IsMessagePart() bool {
+	return c.reqMsg.PartCount > 0
+}
+
+// GetPartIndex returns the zero-based index of the incoming part within its request.
+func (c *HandlerContext) GetPartIndex() int {
+	return int(c.reqMsg.PartIndex)
+}
+
+// GetPartCount returns the total number of parts sent for the incoming message's request,
+// or zero if the incoming message is not a part.
+func (c *HandlerContext) GetPartCount() int {
+	return int(c.reqMsg.PartCount)
+}
+
+// SetPublishErrorPolicy sets whether a failed publish fails the message being handled.
+// Called within HandlerInit it changes the default policy for all the handlers, called within
+// a handler it only applies to the current message.
+func (c *HandlerContext) SetPublishErrorPolicy(policy PublishErrorPolicy) error {
+	if err := policy.IsValid(); err != nil {
+		return err
+	}
+
+	c.publishErrorPolicy = policy
+
+	return nil
+}
+
+// RegisterJoin makes the runner check the join's timeouts from startup. Otherwise timeouts of
+// requests buffered before a restart are only checked once the join receives a new message.
+func (c *HandlerContext) RegisterJoin(join *Join) error {
+	if c.joins == nil {
+		return errors.ErrUndefinedJoinStore
+	}
+
+	c.joins.register(join)
+
+	return nil
+}
+
+// trackPublish records the publish result so the runner can decide, once the handler returns,
+// if the message was processed successfully.
+func (c *HandlerContext) trackPublish(future nats.PubAckFuture, err error) error {
+	c.publishes.track(future, err)
+	return err
+}
+
+// publishOpts adds a deterministic message ID to the outputs when idempotency is enabled.
+func (c *HandlerContext) publishOpts(opts ...PublishOpt) []PublishOpt {
+	if c.cfg.NATS.KeyValueStoreIdempotencyName == "" {
+		return opts
+	}
+
+	return append(opts, withMsgID(c.publishes.nextMsgID(c.reqMsg, c.cfg.NodeName)))
 }
 
 func (c *HandlerContext) getOptionalString(values []string) string {
@@ -3,6 +3,9 @@ package kre
 import (
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/konstellation-io/kre-runners/kre-go/v4/config"
 	utilErrors "github.com/konstellation-io/kre-runners/kre-go/v4/internal/errors"
@@ -22,10 +25,26 @@ type ContextConfiguration interface {
 	Set(key, value string, scopeOpt ...Scope) error
 	Get(key string, scopeOpt ...Scope) (string, error)
 	Delete(key string, scopeOpt ...Scope) error
+	Watch(key string, scopeOpt ...Scope) (*ConfigurationWatcher, error)
+	WatchFunc(key string, callback func(update ConfigurationUpdate), scopeOpt ...Scope) (*ConfigurationWatcher, error)
+	View() (*ConfigurationView, error)
+	ListKeys(prefix string, scopeOpt ...Scope) ([]string, error)
+	GetWithRevision(key string, scopeOpt ...Scope) (string, uint64, error)
+	History(key string, scopeOpt ...Scope) ([]ConfigurationUpdate, error)
+	Create(key, value string, scopeOpt ...Scope) (uint64, error)
+	Update(key, value string, expectedRevision uint64, scopeOpt ...Scope) (uint64, error)
+	Purge(key string, scopeOpt ...Scope) error
+	SetSecret(key, value string, scopeOpt ...Scope) error
+	GetSecret(key string, scopeOpt ...Scope) (Secret, error)
+	ListSecrets(prefix string, scopeOpt ...Scope) ([]string, error)
 }
 
 type contextConfiguration struct {
+	logger      *simplelogger.SimpleLogger
 	kvStoresMap map[Scope]nats.KeyValue
+	secrets     *secretCipher
+	viewMu      sync.Mutex
+	view        *ConfigurationView
 }
 
 func NewContextConfiguration(
@@ -38,8 +57,15 @@ func NewContextConfiguration(
 		return nil, err
 	}
 
+	secrets, err := newSecretCipher(cfg.Secrets)
+	if err != nil {
+		return nil, utilErrors.Wrapper("configuration init: %w")(err)
+	}
+
 	return &contextConfiguration{
+		logger:      logger,
 		kvStoresMap: kvStoresMap,
+		secrets:     secrets,
 	}, nil
 }
 
@@ -73,7 +99,8 @@ func initKVStoresMap(
 }
 
 // Set set the given key and value to an optional scoped key-value storage,
-// or the default key-value storage (Node) if not given any.
+// or the default key-value storage (Node) if not given any. Secrets can only be replaced by
+// SetSecret.
 func (cc *contextConfiguration) Set(key, value string, scopeOpt ...Scope) error {
 	wrapErr := utilErrors.Wrapper("configuration set: %w")
 	scope := cc.getOptionalScope(scopeOpt)
@@ -83,7 +110,12 @@ func (cc *contextConfiguration) Set(key, value string, scopeOpt ...Scope) error
 		return wrapErr(fmt.Errorf("could not find key value store given scope %q", scope))
 	}
 
-	_, err := kvStore.PutString(key, value)
+	err := checkPlainValue(kvStore, key, value)
+	if err != nil {
+		return wrapErr(err)
+	}
+
+	_, err = kvStore.PutString(key, value)
 	if err != nil {
 		return wrapErr(fmt.Errorf("error storing value with key %q to the key-value store: %w", key, err))
 	}
@@ -93,6 +125,7 @@ func (cc *contextConfiguration) Set(key, value string, scopeOpt ...Scope) error
 
 // Get retrieves the configuration given a key from an optional scoped key-value storage,
 // if no scoped key-value storage is given it will search in all the scopes starting by Node then upwards.
+// Secrets are returned decrypted as plain strings, use GetSecret to have them redacted when logged.
 func (cc *contextConfiguration) Get(key string, scopeOpt ...Scope) (string, error) {
 	wrapErr := utilErrors.Wrapper("configuration get: %w")
 
@@ -104,7 +137,6 @@ func (cc *contextConfiguration) Get(key string, scopeOpt ...Scope) (string, erro
 		return config, nil
 
 	} else {
-		allScopesInOrder := []Scope{NodeScope, WorkflowScope, ProjectScope}
 		for _, scope := range allScopesInOrder {
 			config, err := cc.getConfigFromScope(key, scope)
 
@@ -128,7 +160,12 @@ func (cc *contextConfiguration) getConfigFromScope(key string, scope Scope) (str
 		return "", fmt.Errorf("error retrieving config with key %q from the configuration: %w", key, err)
 	}
 
-	return string(value.Value()), nil
+	config, _, err := cc.secrets.decode(string(value.Value()), scope, key)
+	if err != nil {
+		return "", fmt.Errorf("error retrieving config with key %q from the configuration: %w", key, err)
+	}
+
+	return config, nil
 }
 
 // Delete retrieves the configuration given a key from an optional scoped key-value storage,
@@ -156,3 +193,249 @@ func (cc *contextConfiguration) getOptionalScope(scopes []Scope) Scope {
 	}
 	return NodeScope
 }
+
+func (cc *contextConfiguration) getKVStore(scopeOpt []Scope) (nats.KeyValue, error) {
+	scope := cc.getOptionalScope(scopeOpt)
+
+	kvStore, ok := cc.kvStoresMap[scope]
+	if !ok {
+		return nil, fmt.Errorf("could not find key value store given scope %q", scope)
+	}
+
+	return kvStore, nil
+}
+
+// ListKeys returns the keys starting with the given prefix from an optional scoped key-value storage,
+// or the default key-value storage (Node) if not given any. An empty prefix lists all the keys.
+func (cc *contextConfiguration) ListKeys(prefix string, scopeOpt ...Scope) ([]string, error) {
+	wrapErr := utilErrors.Wrapper("configuration list keys: %w")
+
+	kvStore, err := cc.getKVStore(scopeOpt)
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+
+	keys, err := kvStore.Keys()
+	if errors.Is(err, nats.ErrNoKeysFound) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, wrapErr(fmt.Errorf("error listing keys from the key-value store: %w", err))
+	}
+
+	filtered := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if strings.HasPrefix(key, prefix) {
+			filtered = append(filtered, key)
+		}
+	}
+
+	sort.Strings(filtered)
+
+	return filtered, nil
+}
+
+// GetWithRevision retrieves the configuration and its revision given a key from an optional scoped
+// key-value storage. Unlike Get, it uses the default key-value storage (Node) if not given any,
+// so the revision can be given to Update in the same scope.
+func (cc *contextConfiguration) GetWithRevision(key string, scopeOpt ...Scope) (string, uint64, error) {
+	wrapErr := utilErrors.Wrapper("configuration get with revision: %w")
+
+	kvStore, err := cc.getKVStore(scopeOpt)
+	if err != nil {
+		return "", 0, wrapErr(err)
+	}
+
+	entry, err := kvStore.Get(key)
+	if err != nil {
+		return "", 0, wrapErr(fmt.Errorf("error retrieving config with key %q from the configuration: %w", key, err))
+	}
+
+	value, _, err := cc.secrets.decode(string(entry.Value()), cc.getOptionalScope(scopeOpt), key)
+	if err != nil {
+		return "", 0, wrapErr(fmt.Errorf("error retrieving config with key %q from the configuration: %w", key, err))
+	}
+
+	return value, entry.Revision(), nil
+}
+
+// History returns the updates of the given key kept by an optional scoped key-value storage,
+// or the default key-value storage (Node) if not given any, from the oldest to the latest.
+func (cc *contextConfiguration) History(key string, scopeOpt ...Scope) ([]ConfigurationUpdate, error) {
+	wrapErr := utilErrors.Wrapper("configuration history: %w")
+	scope := cc.getOptionalScope(scopeOpt)
+
+	kvStore, err := cc.getKVStore(scopeOpt)
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+
+	entries, err := kvStore.History(key)
+	if err != nil {
+		return nil, wrapErr(fmt.Errorf("error retrieving history of config with key %q: %w", key, err))
+	}
+
+	history := make([]ConfigurationUpdate, 0, len(entries))
+	for _, entry := range entries {
+		history = append(history, cc.newConfigurationUpdate(scope, entry))
+	}
+
+	return history, nil
+}
+
+// Create sets the given key and value only if the key does not exist, or was deleted, in an
+// optional scoped key-value storage, or the default key-value storage (Node) if not given any.
+// The returned error matches nats.ErrKeyExists when the key already exists.
+func (cc *contextConfiguration) Create(key, value string, scopeOpt ...Scope) (uint64, error) {
+	wrapErr := utilErrors.Wrapper("configuration create: %w")
+
+	kvStore, err := cc.getKVStore(scopeOpt)
+	if err != nil {
+		return 0, wrapErr(err)
+	}
+
+	err = checkPlainValue(kvStore, key, value)
+	if err != nil {
+		return 0, wrapErr(err)
+	}
+
+	revision, err := kvStore.Create(key, []byte(value))
+	if err != nil {
+		return 0, wrapErr(fmt.Errorf("error creating value with key %q in the key-value store: %w", key, err))
+	}
+
+	return revision, nil
+}
+
+// Update sets the given key and value only if the key's latest revision is the expected one,
+// in an optional scoped key-value storage, or the default key-value storage (Node) if not given any.
+// The returned error matches nats.ErrKeyExists when the key was modified since that revision.
+// Secrets can only be replaced by SetSecret.
+func (cc *contextConfiguration) Update(key, value string, expectedRevision uint64, scopeOpt ...Scope) (uint64, error) {
+	wrapErr := utilErrors.Wrapper("configuration update: %w")
+
+	kvStore, err := cc.getKVStore(scopeOpt)
+	if err != nil {
+		return 0, wrapErr(err)
+	}
+
+	err = checkPlainValue(kvStore, key, value)
+	if err != nil {
+		return 0, wrapErr(err)
+	}
+
+	revision, err := kvStore.Update(key, []byte(value), expectedRevision)
+	if err != nil {
+		return 0, wrapErr(fmt.Errorf("error updating value with key %q in the key-value store: %w", key, err))
+	}
+
+	return revision, nil
+}
+
+// Purge deletes the given key and all its history from an optional scoped key-value storage,
+// or the default key-value storage (Node) if not given any.
+func (cc *contextConfiguration) Purge(key string, scopeOpt ...Scope) error {
+	wrapErr := utilErrors.Wrapper("configuration purge: %w")
+
+	kvStore, err := cc.getKVStore(scopeOpt)
+	if err != nil {
+		return wrapErr(err)
+	}
+
+	err = kvStore.Purge(key)
+	if err != nil {
+		return wrapErr(fmt.Errorf("error purging value with key %q from the key-value store: %w", key, err))
+	}
+
+	return nil
+}
+
+// SetSecret encrypts the given value with the configured secret key and sets it to an optional scoped
+// key-value storage, or the default key-value storage (Node) if not given any. The encrypted value
+// can only be decrypted under the same scope and key. Secrets are decrypted by Get like any other
+// value, which returns them as plain strings, so only GetSecret and ConfigurationUpdate redact them.
+func (cc *contextConfiguration) SetSecret(key, value string, scopeOpt ...Scope) error {
+	wrapErr := utilErrors.Wrapper("configuration set secret: %w")
+
+	kvStore, err := cc.getKVStore(scopeOpt)
+	if err != nil {
+		return wrapErr(err)
+	}
+
+	encrypted, err := cc.secrets.encrypt(value, cc.getOptionalScope(scopeOpt), key)
+	if err != nil {
+		return wrapErr(err)
+	}
+
+	_, err = kvStore.PutString(key, encrypted)
+	if err != nil {
+		return wrapErr(fmt.Errorf("error storing secret with key %q to the key-value store: %w", key, err))
+	}
+
+	return nil
+}
+
+// checkPlainValue rejects the values written by Set, Create and Update that would be taken as
+// secrets, or that would replace a secret with a plain value.
+func checkPlainValue(kvStore nats.KeyValue, key, value string) error {
+	if isSecretValue(value) {
+		return fmt.Errorf("the value of key %q can't start with %q, reserved for secrets", key, secretPrefix)
+	}
+
+	entry, err := kvStore.Get(key)
+	if errors.Is(err, nats.ErrKeyNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error retrieving config with key %q from the configuration: %w", key, err)
+	}
+
+	if isSecretValue(string(entry.Value())) {
+		return fmt.Errorf("the key %q holds a secret, which can only be replaced by SetSecret", key)
+	}
+
+	return nil
+}
+
+// GetSecret works as Get, but returns the value as a Secret, redacted when formatted.
+func (cc *contextConfiguration) GetSecret(key string, scopeOpt ...Scope) (Secret, error) {
+	value, err := cc.Get(key, scopeOpt...)
+	if err != nil {
+		return "", err
+	}
+
+	return Secret(value), nil
+}
+
+// ListSecrets returns the keys of the secrets starting with the given prefix from an optional
+// scoped key-value storage, or the default key-value storage (Node) if not given any.
+func (cc *contextConfiguration) ListSecrets(prefix string, scopeOpt ...Scope) ([]string, error) {
+	wrapErr := utilErrors.Wrapper("configuration list secrets: %w")
+
+	keys, err := cc.ListKeys(prefix, scopeOpt...)
+	if err != nil {
+		return nil, err
+	}
+
+	kvStore, err := cc.getKVStore(scopeOpt)
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+
+	secrets := make([]string, 0, len(keys))
+	for _, key := range keys {
+		entry, err := kvStore.Get(key)
+		if errors.Is(err, nats.ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, wrapErr(fmt.Errorf("error retrieving config with key %q from the configuration: %w", key, err))
+		}
+
+		if isSecretValue(string(entry.Value())) {
+			secrets = append(secrets, key)
+		}
+	}
+
+	return secrets, nil
+}
@@ -3,8 +3,10 @@
 package kre
 
 import (
+	"encoding/base64"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/nats-io/nats-server/v2/server"
 	"github.com/nats-io/nats.go"
@@ -44,6 +46,9 @@ func (suite *ContextConfigurationTestSuite) SetupSuite() {
 			KeyValueStoreWorkflowName: "kv_workflow",
 			KeyValueStoreNodeName:     "kv_node",
 		},
+		Secrets: config.Secrets{
+			Key: base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef")),
+		},
 	}
 
 	allKVStores = []string{
@@ -89,6 +94,7 @@ func (suite *ContextConfigurationTestSuite) createKVStores() {
 		cfg := nats.KeyValueConfig{
 			Bucket:  kvStore,
 			Storage: nats.FileStorage,
+			History: 5,
 		}
 		_, err := suite.js.CreateKeyValue(&cfg)
 		suite.Require().NoError(err)
@@ -230,3 +236,207 @@ func (suite *ContextConfigurationTestSuite) TestDeleteConfigScopeDefault() {
 	_, err = suite.ctxConfiguration.Get(testKey)
 	suite.Require().Error(err)
 }
+
+func (suite *ContextConfigurationTestSuite) TestWatchConfig() {
+	err := suite.ctxConfiguration.Set("model.threshold", "0.5", WorkflowScope)
+	suite.Require().NoError(err)
+
+	watcher, err := suite.ctxConfiguration.Watch("model.>")
+	suite.Require().NoError(err)
+	defer watcher.Stop()
+
+	update := suite.nextUpdate(watcher)
+	suite.Assert().Equal(ConfigurationUpdate{Scope: WorkflowScope, Key: "model.threshold", Value: "0.5", Revision: 1}, update)
+
+	err = suite.ctxConfiguration.Set("model.threshold", "0.7")
+	suite.Require().NoError(err)
+
+	update = suite.nextUpdate(watcher)
+	suite.Assert().Equal(NodeScope, update.Scope)
+	suite.Assert().Equal("0.7", update.Value)
+
+	err = suite.ctxConfiguration.Delete("model.threshold")
+	suite.Require().NoError(err)
+
+	update = suite.nextUpdate(watcher)
+	suite.Assert().True(update.Deleted)
+}
+
+func (suite *ContextConfigurationTestSuite) TestWatchConfigClosedWhenKeyValueWatcherStops() {
+	watcher, err := suite.ctxConfiguration.Watch("model.>")
+	suite.Require().NoError(err)
+	defer watcher.Stop()
+
+	// GIVEN the underlying key-value watchers stopped, as when their subscription is closed
+	for _, kvWatcher := range watcher.watchers {
+		suite.Require().NoError(kvWatcher.Stop())
+	}
+
+	// THEN the watcher's updates channel is closed
+	select {
+	case _, ok := <-watcher.Updates():
+		suite.Assert().False(ok)
+	case <-time.After(5 * time.Second):
+		suite.FailNow("configuration updates channel not closed")
+	}
+}
+
+func (suite *ContextConfigurationTestSuite) nextUpdate(watcher *ConfigurationWatcher) ConfigurationUpdate {
+	select {
+	case update := <-watcher.Updates():
+		return update
+	case <-time.After(5 * time.Second):
+		suite.FailNow("configuration update not received")
+	}
+
+	return ConfigurationUpdate{}
+}
+
+func (suite *ContextConfigurationTestSuite) TestConfigurationView() {
+	err := suite.ctxConfiguration.Set("batch", "8", ProjectScope)
+	suite.Require().NoError(err)
+
+	view, err := suite.ctxConfiguration.View()
+	suite.Require().NoError(err)
+
+	batch, err := view.GetInt("batch")
+	suite.Require().NoError(err)
+	suite.Assert().Equal(8, batch)
+
+	err = suite.ctxConfiguration.Set("batch", "16")
+	suite.Require().NoError(err)
+
+	suite.Require().Eventually(func() bool {
+		batch, err = view.GetInt("batch")
+		return err == nil && batch == 16
+	}, 5*time.Second, 10*time.Millisecond)
+
+	err = suite.ctxConfiguration.Set("params", `{"timeout": "1s"}`, WorkflowScope)
+	suite.Require().NoError(err)
+
+	var params struct {
+		Timeout string `json:"timeout"`
+	}
+	suite.Require().Eventually(func() bool {
+		return view.GetJSON("params", &params) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	suite.Assert().Equal("1s", params.Timeout)
+
+	_, err = view.GetDuration("missing")
+	suite.Assert().ErrorIs(err, nats.ErrKeyNotFound)
+
+	// the view is shared until stopped
+	shared, err := suite.ctxConfiguration.View()
+	suite.Require().NoError(err)
+	suite.Assert().Same(view, shared)
+
+	suite.Require().NoError(view.Stop())
+
+	restarted, err := suite.ctxConfiguration.View()
+	suite.Require().NoError(err)
+	suite.Assert().NotSame(view, restarted)
+	suite.Require().NoError(restarted.Stop())
+}
+
+func (suite *ContextConfigurationTestSuite) TestListKeys() {
+	keys, err := suite.ctxConfiguration.ListKeys("")
+	suite.Require().NoError(err)
+	suite.Assert().Empty(keys)
+
+	for _, key := range []string{"model.b", "model.a", "other"} {
+		err = suite.ctxConfiguration.Set(key, testValue, WorkflowScope)
+		suite.Require().NoError(err)
+	}
+
+	keys, err = suite.ctxConfiguration.ListKeys("model.", WorkflowScope)
+	suite.Require().NoError(err)
+	suite.Assert().Equal([]string{"model.a", "model.b"}, keys)
+}
+
+func (suite *ContextConfigurationTestSuite) TestCreateAndUpdateWithRevision() {
+	// GIVEN a key created by a node
+	revision, err := suite.ctxConfiguration.Create("leader", "node-1")
+	suite.Require().NoError(err)
+
+	_, err = suite.ctxConfiguration.Create("leader", "node-2")
+	suite.Require().ErrorIs(err, nats.ErrKeyExists)
+
+	value, gotRevision, err := suite.ctxConfiguration.GetWithRevision("leader")
+	suite.Require().NoError(err)
+	suite.Assert().Equal("node-1", value)
+	suite.Assert().Equal(revision, gotRevision)
+
+	// WHEN it is updated with its latest revision
+	newRevision, err := suite.ctxConfiguration.Update("leader", "node-2", revision)
+	suite.Require().NoError(err)
+	suite.Assert().Greater(newRevision, revision)
+
+	// THEN updating with an outdated revision fails
+	_, err = suite.ctxConfiguration.Update("leader", "node-3", revision)
+	suite.Require().ErrorIs(err, nats.ErrKeyExists)
+
+	history, err := suite.ctxConfiguration.History("leader")
+	suite.Require().NoError(err)
+	suite.Require().Len(history, 2)
+	suite.Assert().Equal("node-1", history[0].Value)
+	suite.Assert().Equal("node-2", history[1].Value)
+}
+
+func (suite *ContextConfigurationTestSuite) TestPurge() {
+	err := suite.ctxConfiguration.Set(testKey, testValue, ProjectScope)
+	suite.Require().NoError(err)
+
+	err = suite.ctxConfiguration.Purge(testKey, ProjectScope)
+	suite.Require().NoError(err)
+
+	_, err = suite.ctxConfiguration.Get(testKey, ProjectScope)
+	suite.Require().ErrorIs(err, nats.ErrKeyNotFound)
+}
+
+func (suite *ContextConfigurationTestSuite) TestSecrets() {
+	err := suite.ctxConfiguration.SetSecret("api_key", "s3cr3t", WorkflowScope)
+	suite.Require().NoError(err)
+	err = suite.ctxConfiguration.Set("endpoint", "http://model", WorkflowScope)
+	suite.Require().NoError(err)
+
+	storedValue := suite.getValueFromKVStore(suite.cfg.NATS.KeyValueStoreWorkflowName, "api_key")
+	suite.Assert().NotContains(storedValue, "s3cr3t")
+
+	value, err := suite.ctxConfiguration.Get("api_key")
+	suite.Require().NoError(err)
+	suite.Assert().Equal("s3cr3t", value)
+
+	secret, err := suite.ctxConfiguration.GetSecret("api_key")
+	suite.Require().NoError(err)
+	suite.Assert().Equal("s3cr3t", secret.Reveal())
+	suite.Assert().NotContains(fmt.Sprint(secret), "s3cr3t")
+
+	secrets, err := suite.ctxConfiguration.ListSecrets("", WorkflowScope)
+	suite.Require().NoError(err)
+	suite.Assert().Equal([]string{"api_key"}, secrets)
+}
+
+func (suite *ContextConfigurationTestSuite) TestSecretsCantBeReplacedOrCopied() {
+	err := suite.ctxConfiguration.SetSecret("api_key", "s3cr3t", WorkflowScope)
+	suite.Require().NoError(err)
+
+	// plain values can't replace secrets, nor look like them
+	_, revision, err := suite.ctxConfiguration.GetWithRevision("api_key", WorkflowScope)
+	suite.Require().NoError(err)
+	_, err = suite.ctxConfiguration.Update("api_key", "plain", revision, WorkflowScope)
+	suite.Assert().Error(err)
+	suite.Assert().Error(suite.ctxConfiguration.Set("api_key", "plain", WorkflowScope))
+	suite.Assert().Error(suite.ctxConfiguration.Set("other", secretPrefix+"AAAA", WorkflowScope))
+	_, err = suite.ctxConfiguration.Create("new", secretPrefix+"AAAA", WorkflowScope)
+	suite.Assert().Error(err)
+
+	// an encrypted value copied to another key can't be decrypted
+	storedValue := suite.getValueFromKVStore(suite.cfg.NATS.KeyValueStoreWorkflowName, "api_key")
+	kvStore, err := suite.js.KeyValue(suite.cfg.NATS.KeyValueStoreWorkflowName)
+	suite.Require().NoError(err)
+	_, err = kvStore.PutString("copy", storedValue)
+	suite.Require().NoError(err)
+
+	_, err = suite.ctxConfiguration.Get("copy", WorkflowScope)
+	suite.Assert().Error(err)
+}
@@ -3,9 +3,10 @@ package kre
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 
 	"github.com/nats-io/nats.go"
-
 	"go.mongodb.org/mongo-driver/bson"
 
 	"github.com/konstellation-io/kre-runners/kre-go/v4/config"
@@ -23,6 +24,22 @@ type SaveDataMsg struct {
 type ContextDatabase interface {
 	Find(collection string, query QueryData, res interface{}) error
 	Save(collection string, data interface{}) error
+	SaveAsync(collection string, data interface{}) error
+	Flush() error
+	OnSaveFailure(callback func(failure SaveFailure))
+	FindOne(ctx context.Context, collection string, filter QueryData, result interface{}, optsOpt ...FindOptions) error
+	FindWithOptions(ctx context.Context, collection string, filter QueryData, opts FindOptions, results interface{}) error
+	Iterate(ctx context.Context, collection string, filter QueryData, optsOpt ...FindOptions) (*Cursor, error)
+	Count(ctx context.Context, collection string, filter QueryData) (int64, error)
+	Distinct(ctx context.Context, collection, field string, filter QueryData) ([]interface{}, error)
+	Aggregate(ctx context.Context, collection string, pipeline []QueryData, results interface{}) error
+	Insert(ctx context.Context, collection string, docs ...interface{}) ([]interface{}, error)
+	Update(ctx context.Context, collection string, filter, update QueryData) (*WriteResult, error)
+	Upsert(ctx context.Context, collection string, filter, update QueryData) (*WriteResult, error)
+	DeleteOne(ctx context.Context, collection string, filter QueryData) (int64, error)
+	DeleteMany(ctx context.Context, collection string, filter QueryData) (int64, error)
+	BulkWrite(ctx context.Context, collection string, operations []WriteOperation, ordered bool) (*WriteResult, error)
+	EnsureIndexes(ctx context.Context, collection string, indexes ...Index) error
 }
 
 type contextDatabase struct {
@@ -30,6 +47,7 @@ type contextDatabase struct {
 	nc     *nats.Conn
 	mongoM mongodb.Manager
 	logger *simplelogger.SimpleLogger
+	saver  *saveBatcher
 }
 
 func NewContextDatabase(
@@ -38,37 +56,136 @@ func NewContextDatabase(
 	mongoM mongodb.Manager,
 	logger *simplelogger.SimpleLogger,
 ) *contextDatabase {
-	return &contextDatabase{
+	c := &contextDatabase{
 		cfg:    cfg,
 		nc:     nc,
 		mongoM: mongoM,
 		logger: logger,
 	}
+
+	maxBytes := MessageThreshold
+	if nc != nil && nc.MaxPayload() > 0 {
+		maxBytes = int(nc.MaxPayload())
+	}
+	c.saver = newSaveBatcher(cfg.SaveBatch.Size, cfg.SaveBatch.MaxWait, maxBytes-saveBatchMsgOverhead, c.sendBatch, logger)
+
+	return c
 }
 
 // Find data from a collection of mongoDB
 func (c *contextDatabase) Find(collection string, query QueryData, res interface{}) error {
-	ctx, cancel := context.WithTimeout(context.Background(), getDataTimeout)
+	ctx, cancel := c.queryContext(context.Background())
 	defer cancel()
 
-	criteria := bson.M{}
-	for k, v := range query {
-		criteria[k] = v
-	}
-
-	return c.mongoM.Find(ctx, collection, criteria, res)
+	return c.mongoM.Find(ctx, collection, query.bson(), res)
 }
 
 // Save data inside a bson struct to a collection of your choice in mongoDB
 func (c *contextDatabase) Save(collection string, data interface{}) error {
+	if !c.usesMongoWriter() {
+		doc, err := json.Marshal(data)
+		if err != nil {
+			return fmt.Errorf("error generating JSON of the document to save: %w", err)
+		}
+
+		return c.insertJSON(collection, []json.RawMessage{doc})
+	}
+
 	msg, err := json.Marshal(SaveDataMsg{
 		Coll: collection,
 		Doc:  data,
 	})
 	if err != nil {
-		c.logger.Infof("Error generating SaveDataMsg JSON: %s", err)
+		return fmt.Errorf("error generating SaveDataMsg JSON: %w", err)
 	}
 
-	_, err = c.nc.Request(c.cfg.NATS.MongoWriterSubject, msg, saveDataTimeout)
+	_, err = c.nc.Request(c.cfg.NATS.MongoWriterSubject, msg, c.cfg.Timeouts.SaveData)
+	return err
+}
+
+// SaveAsync queues the data to be saved to the collection along with other documents of the same
+// collection, in a single message to the mongo writer sent once KRT_SAVE_BATCH_SIZE documents are
+// queued or KRT_SAVE_BATCH_MAX_WAIT expires. Data that can't be marshaled is never queued and its
+// error is returned, as is the error of data saved once the runner is shutting down, while failures
+// saving the batch are given to the OnSaveFailure callback.
+func (c *contextDatabase) SaveAsync(collection string, data interface{}) error {
+	doc, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("error generating JSON of the document to save: %w", err)
+	}
+
+	return c.saver.add(collection, doc)
+}
+
+// Flush sends the documents queued by SaveAsync and waits until the mongo writer answers, returning
+// the first error of the batches sent since the previous Flush, including the ones sent once full
+// or expired. The runner flushes them on shutdown.
+func (c *contextDatabase) Flush() error {
+	return c.saver.flush()
+}
+
+// close sends the documents queued by SaveAsync on shutdown, rejecting the ones saved afterwards.
+func (c *contextDatabase) close() error {
+	return c.saver.close()
+}
+
+// OnSaveFailure sets the callback notified of the batches that failed to be saved, which are
+// logged by default.
+func (c *contextDatabase) OnSaveFailure(callback func(failure SaveFailure)) {
+	c.saver.setOnFailure(callback)
+}
+
+func (c *contextDatabase) sendBatch(collection string, docs []json.RawMessage) error {
+	if !c.usesMongoWriter() {
+		return c.insertJSON(collection, docs)
+	}
+
+	msg, err := json.Marshal(SaveDataBatchMsg{
+		Coll: collection,
+		Docs: docs,
+	})
+	if err != nil {
+		return fmt.Errorf("error generating SaveDataBatchMsg JSON: %w", err)
+	}
+
+	res, err := c.nc.Request(c.cfg.NATS.MongoWriterBatchSubject, msg, c.cfg.Timeouts.SaveData)
+	if err != nil {
+		return err
+	}
+
+	var reply struct {
+		Success bool `json:"success"`
+	}
+	if err := json.Unmarshal(res.Data, &reply); err != nil {
+		return fmt.Errorf("invalid reply of the mongo writer: %w", err)
+	}
+
+	if !reply.Success {
+		return errors.New("the mongo writer failed saving the documents")
+	}
+
+	return nil
+}
+
+// usesMongoWriter reports whether saved documents are sent to the mongo writer, which only
+// writes to MongoDB. Other database backends store them directly.
+func (c *contextDatabase) usesMongoWriter() bool {
+	return c.cfg.Database.Backend == "" || c.cfg.Database.Backend == config.MongoDBBackend
+}
+
+// insertJSON stores the JSON documents as the mongo writer does, so they are read back the same
+// whatever the database backend.
+func (c *contextDatabase) insertJSON(collection string, docs []json.RawMessage) error {
+	values := make([]interface{}, 0, len(docs))
+	for _, doc := range docs {
+		var value bson.M
+		if err := bson.UnmarshalExtJSON(doc, false, &value); err != nil {
+			return fmt.Errorf("error decoding the document to save: %w", err)
+		}
+		values = append(values, value)
+	}
+
+	_, err := c.Insert(context.Background(), collection, values...)
+
 	return err
 }
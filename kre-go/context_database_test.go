@@ -16,6 +16,8 @@ import (
 	"github.com/stretchr/testify/suite"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 
 	"github.com/konstellation-io/kre-runners/kre-go/v4/config"
 	"github.com/konstellation-io/kre-runners/kre-go/v4/mocks"
@@ -38,7 +40,10 @@ type ContextDataTestSuite struct {
 	ctxData ContextDatabase
 }
 
-const mongoWriterSubject = "mongo_writer"
+const (
+	mongoWriterSubject      = "mongo_writer"
+	mongoWriterBatchSubject = "mongo_writer.batch"
+)
 
 func TestContextDataTestSuite(t *testing.T) {
 	suite.Run(t, new(ContextDataTestSuite))
@@ -51,11 +56,20 @@ func (suite *ContextDataTestSuite) SetupSuite() {
 	logger := simplelogger.New(simplelogger.LevelInfo)
 	cfg := config.Config{
 		NATS: config.ConfigNATS{
-			MongoWriterSubject: mongoWriterSubject,
+			MongoWriterSubject:      mongoWriterSubject,
+			MongoWriterBatchSubject: mongoWriterBatchSubject,
 		},
 		MongoDB: config.MongoDB{
 			Address: "mongodb://localhost:27017",
 		},
+		Timeouts: config.Timeouts{
+			SaveData: time.Second,
+			GetData:  time.Second,
+		},
+		SaveBatch: config.Batch{
+			Size:    10,
+			MaxWait: time.Minute,
+		},
 	}
 
 	testPort := 8331
@@ -174,3 +188,236 @@ func (suite *ContextDataTestSuite) TestContextDataSave() {
 	suite.Equal(sentMsg.TicketID, receivedDoc["TicketID"])
 	suite.Equal(sentMsg.Asset, receivedDoc["Asset"])
 }
+
+func (suite *ContextDataTestSuite) TestContextDataFindWithOptions() {
+	// GIVEN a query with options
+	var results []*TestData
+	opts := FindOptions{Sort: []SortField{{Field: "Time", Descending: true}}, Limit: 5}
+
+	// WHEN the find method is called
+	// THEN the filter and the options are given to the mongo manager
+	suite.mongoM.EXPECT().
+		FindWithOptions(gomock.Any(), "test_data", bson.M{"Asset": "A5678"}, opts.findOptions(), &results).
+		Return(nil)
+
+	err := suite.ctxData.FindWithOptions(context.Background(), "test_data", QueryData{"Asset": "A5678"}, opts, &results)
+	suite.Require().NoError(err)
+}
+
+func (suite *ContextDataTestSuite) TestContextDataFindOneNotFound() {
+	// GIVEN no document matches the filter
+	var result TestData
+	suite.mongoM.EXPECT().
+		FindOne(gomock.Any(), "test_data", bson.M{"TicketID": "none"}, gomock.Any(), &result).
+		Return(ErrDocumentNotFound)
+
+	// WHEN the find one method is called
+	err := suite.ctxData.FindOne(context.Background(), "test_data", QueryData{"TicketID": "none"}, &result)
+
+	// THEN the error tells no document was found
+	suite.ErrorIs(err, ErrDocumentNotFound)
+}
+
+func (suite *ContextDataTestSuite) TestContextDataCountAndDistinct() {
+	suite.mongoM.EXPECT().Count(gomock.Any(), "test_data", bson.M{"Result": "Tested"}).Return(int64(3), nil)
+	suite.mongoM.EXPECT().
+		Distinct(gomock.Any(), "test_data", "Asset", bson.M{}).
+		Return([]interface{}{"A1", "A2"}, nil)
+
+	count, err := suite.ctxData.Count(context.Background(), "test_data", QueryData{"Result": "Tested"})
+	suite.Require().NoError(err)
+	suite.Equal(int64(3), count)
+
+	assets, err := suite.ctxData.Distinct(context.Background(), "test_data", "Asset", QueryData{})
+	suite.Require().NoError(err)
+	suite.Equal([]interface{}{"A1", "A2"}, assets)
+}
+
+func (suite *ContextDataTestSuite) TestContextDataAggregate() {
+	// GIVEN an aggregation pipeline
+	pipeline := []QueryData{
+		{"$match": QueryData{"Result": "Tested"}},
+		{"$group": QueryData{"_id": "$Asset", "count": QueryData{"$sum": 1}}},
+	}
+	var results []bson.M
+
+	// WHEN the aggregate method is called
+	// THEN every stage is given to the mongo manager in order
+	suite.mongoM.EXPECT().
+		Aggregate(gomock.Any(), "test_data", []bson.M{
+			{"$match": QueryData{"Result": "Tested"}},
+			{"$group": QueryData{"_id": "$Asset", "count": QueryData{"$sum": 1}}},
+		}, &results).
+		Return(nil)
+
+	err := suite.ctxData.Aggregate(context.Background(), "test_data", pipeline, &results)
+	suite.Require().NoError(err)
+}
+
+func (suite *ContextDataTestSuite) TestContextDataAggregateSortFields() {
+	// GIVEN a pipeline sorting by several fields
+	pipeline := []QueryData{
+		{"$sort": []SortField{{Field: "Score", Descending: true}, {Field: "Asset"}}},
+	}
+	var results []bson.M
+
+	// WHEN the aggregate method is called
+	// THEN the sort fields are given in order
+	suite.mongoM.EXPECT().
+		Aggregate(gomock.Any(), "test_data", []bson.M{
+			{"$sort": bson.D{{Key: "Score", Value: -1}, {Key: "Asset", Value: 1}}},
+		}, &results).
+		Return(nil)
+
+	err := suite.ctxData.Aggregate(context.Background(), "test_data", pipeline, &results)
+	suite.Require().NoError(err)
+
+	// THEN sorting by several unordered fields fails
+	pipeline = []QueryData{{"$sort": QueryData{"Score": -1, "Asset": 1}}}
+	err = suite.ctxData.Aggregate(context.Background(), "test_data", pipeline, &results)
+	suite.Error(err)
+}
+
+func (suite *ContextDataTestSuite) TestContextDataUpsert() {
+	// GIVEN a feature row to upsert
+	filter := QueryData{"Asset": "A5678"}
+	update := QueryData{"Result": "Repaired"}
+
+	// WHEN the upsert method is called
+	// THEN the fields are set in a single document, inserting it when missing
+	suite.mongoM.EXPECT().
+		UpdateOne(gomock.Any(), "test_data", bson.M{"Asset": "A5678"}, bson.M{"$set": bson.M{"Result": "Repaired"}}, gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ string, _, _ bson.M, opts *options.UpdateOptions) (*mongo.UpdateResult, error) {
+			suite.True(*opts.Upsert)
+			return &mongo.UpdateResult{UpsertedCount: 1}, nil
+		})
+
+	result, err := suite.ctxData.Upsert(context.Background(), "test_data", filter, update)
+	suite.Require().NoError(err)
+	suite.Equal(&WriteResult{Upserted: 1}, result)
+}
+
+func (suite *ContextDataTestSuite) TestContextDataDeleteMany() {
+	suite.mongoM.EXPECT().
+		DeleteMany(gomock.Any(), "test_data", bson.M{"Result": "Stale"}).
+		Return(&mongo.DeleteResult{DeletedCount: 4}, nil)
+
+	deleted, err := suite.ctxData.DeleteMany(context.Background(), "test_data", QueryData{"Result": "Stale"})
+	suite.Require().NoError(err)
+	suite.Equal(int64(4), deleted)
+}
+
+func (suite *ContextDataTestSuite) TestContextDataBulkWriteReturnsPartialResult() {
+	// GIVEN a bulk write failing after the first operation
+	operations := []WriteOperation{
+		{Type: InsertOperation, Document: TestData{TicketID: "1"}},
+		{Type: DeleteOneOperation, Filter: QueryData{"TicketID": "2"}},
+	}
+	suite.mongoM.EXPECT().
+		BulkWrite(gomock.Any(), "test_data", gomock.Len(2), gomock.Any()).
+		Return(&mongo.BulkWriteResult{InsertedCount: 1}, mongo.BulkWriteException{})
+
+	// WHEN the bulk write is sent
+	result, err := suite.ctxData.BulkWrite(context.Background(), "test_data", operations, true)
+
+	// THEN the error is returned along with the documents written
+	suite.Error(err)
+	suite.Equal(int64(1), result.Inserted)
+}
+
+func (suite *ContextDataTestSuite) TestContextDataSaveAsyncRejectsInvalidDocuments() {
+	// GIVEN a document that can't be marshaled
+	invalid := map[string]interface{}{"value": make(chan int)}
+
+	// WHEN it is saved
+	err := suite.ctxData.SaveAsync("test_data", invalid)
+
+	// THEN it is rejected without being queued
+	suite.Error(err)
+	suite.NoError(suite.ctxData.Flush())
+}
+
+func (suite *ContextDataTestSuite) TestContextDataSaveAsync() {
+	// GIVEN a mongo writer supporting batches
+	msgCh := make(chan *nats.Msg, 64)
+	sub, err := suite.nc.ChanSubscribe(mongoWriterBatchSubject, msgCh)
+	suite.Require().NoError(err)
+	defer sub.Unsubscribe()
+
+	go func() {
+		msg := <-msgCh
+		_ = msg.Respond([]byte(`{"success": true}`))
+		msgCh <- msg
+	}()
+
+	// WHEN two documents are saved and flushed
+	suite.Require().NoError(suite.ctxData.SaveAsync("test_data", TestData{TicketID: "1"}))
+	suite.Require().NoError(suite.ctxData.SaveAsync("test_data", TestData{TicketID: "2"}))
+	suite.Require().NoError(suite.ctxData.Flush())
+
+	// THEN they are sent in a single message
+	msg := <-msgCh
+	receivedMsg := SaveDataBatchMsg{}
+	suite.Require().NoError(json.Unmarshal(msg.Data, &receivedMsg))
+	suite.Equal("test_data", receivedMsg.Coll)
+	suite.Len(receivedMsg.Docs, 2)
+}
+
+func (suite *ContextDataTestSuite) TestContextDataSaveAsyncInvalidReply() {
+	// GIVEN a mongo writer answering batches with an unexpected reply
+	sub, err := suite.nc.Subscribe(mongoWriterBatchSubject, func(msg *nats.Msg) {
+		_ = msg.Respond([]byte("ok"))
+	})
+	suite.Require().NoError(err)
+	defer sub.Unsubscribe()
+
+	// WHEN a document is saved and flushed
+	suite.Require().NoError(suite.ctxData.SaveAsync("test_data", TestData{TicketID: "1"}))
+	err = suite.ctxData.Flush()
+
+	// THEN the batch is considered failed
+	suite.Error(err)
+}
+
+type TestPrediction struct {
+	RequestID string    `bson:"request_id"`
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+func (suite *ContextDataTestSuite) TestCollectionInsertAndFind() {
+	// GIVEN a typed collection
+	predictions := NewCollection[TestPrediction](&HandlerContext{DB: suite.ctxData}, "predictions")
+	prediction := TestPrediction{RequestID: "1", CreatedAt: time.Now().UTC()}
+
+	// WHEN a document is inserted
+	// THEN it is given to the mongo manager as is, to be encoded as BSON
+	suite.mongoM.EXPECT().
+		InsertMany(gomock.Any(), "predictions", []interface{}{prediction}).
+		Return([]interface{}{"id"}, nil)
+
+	ids, err := predictions.Insert(context.Background(), prediction)
+	suite.Require().NoError(err)
+	suite.Equal([]interface{}{"id"}, ids)
+
+	// WHEN documents are found
+	// THEN they are decoded as the collection's type
+	suite.mongoM.EXPECT().
+		FindWithOptions(gomock.Any(), "predictions", bson.M{"request_id": "1"}, gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ string, _ bson.M, _ *options.FindOptions, results interface{}) error {
+			*results.(*[]TestPrediction) = append(*results.(*[]TestPrediction), prediction)
+			return nil
+		})
+
+	found, err := predictions.Find(context.Background(), QueryData{"request_id": "1"})
+	suite.Require().NoError(err)
+	suite.Equal([]TestPrediction{prediction}, found)
+}
+
+func (suite *ContextDataTestSuite) TestCollectionEnsureIndexes() {
+	predictions := NewCollection[TestPrediction](&HandlerContext{DB: suite.ctxData}, "predictions")
+
+	suite.mongoM.EXPECT().CreateIndexes(gomock.Any(), "predictions", gomock.Len(1)).Return(nil)
+
+	err := predictions.EnsureIndexes(context.Background(), Index{Keys: []SortField{{Field: "request_id"}}, Unique: true})
+	suite.Require().NoError(err)
+}
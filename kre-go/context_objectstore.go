@@ -2,6 +2,7 @@ package kre
 
 import (
 	"fmt"
+	"io"
 	regexp2 "regexp"
 
 	"github.com/nats-io/nats.go"
@@ -15,14 +16,31 @@ type ContextObjectStore interface {
 	Save(key string, payload []byte) error
 	Get(key string) ([]byte, error)
 	Purge(regexp ...string) error
+	PurgeWithOptions(opts PurgeOptions) ([]string, error)
 	List(regexp ...string) ([]string, error)
 	Delete(key string) error
+	Put(key string, reader io.Reader, progressOpt ...ProgressFunc) error
+	GetTo(key string, writer io.Writer, progressOpt ...ProgressFunc) error
+	SaveFile(key, relativePath string, progressOpt ...ProgressFunc) error
+	GetToFile(key, relativePath string, progressOpt ...ProgressFunc) error
+	SaveWithOptions(key string, payload []byte, opts ObjectOptions) error
+	GetInfo(key string) (*ObjectInfo, error)
+	ListInfo(regexp ...string) ([]*ObjectInfo, error)
+	InScope(scope Scope) ContextObjectStore
+	CacheStats() ObjectCacheStats
 }
 
+// contextObjectStore works with the object store of a scope. The store returned by
+// NewContextObjectStore writes to the Node scope and reads searching the key starting by Node
+// then upwards, while the stores returned by InScope only work with the given scope.
 type contextObjectStore struct {
 	cfg      config.Config
 	logger   *simplelogger.SimpleLogger
 	objStore nats.ObjectStore
+	bucket   string
+	scoped   bool
+	stores   map[Scope]*contextObjectStore
+	cache    *objectCache
 }
 
 func NewContextObjectStore(
@@ -31,37 +49,159 @@ func NewContextObjectStore(
 	js nats.JetStreamContext,
 ) (*contextObjectStore, error) {
 
-	objStore, err := initObjectStore(cfg, logger, js)
+	stores, err := initObjectStoresMap(cfg, logger, js)
 	if err != nil {
 		return nil, err
 	}
 
-	return &contextObjectStore{
+	cache, err := newObjectCache(cfg.ObjectStore, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	if cache != nil {
+		for _, store := range stores {
+			if store.objStore == nil {
+				continue
+			}
+
+			err = cache.watch(store.bucket, store.objStore)
+			if err != nil {
+				return nil, err
+			}
+			store.cache = cache
+		}
+	}
+
+	nodeStore := stores[NodeScope]
+	objectStore := &contextObjectStore{
 		cfg:      cfg,
 		logger:   logger,
-		objStore: objStore,
-	}, nil
+		objStore: nodeStore.objStore,
+		bucket:   nodeStore.bucket,
+		stores:   stores,
+		cache:    cache,
+	}
+
+	if cfg.ObjectStore.SweepInterval > 0 {
+		for _, store := range stores {
+			if store.objStore != nil {
+				go store.sweepExpiredObjects(cfg.ObjectStore.SweepInterval)
+			}
+		}
+	}
+
+	return objectStore, nil
 }
 
-func initObjectStore(cfg config.Config,
+func initObjectStoresMap(
+	cfg config.Config,
 	logger *simplelogger.SimpleLogger,
 	js nats.JetStreamContext,
-) (nats.ObjectStore, error) {
-	var objStore nats.ObjectStore
-	var err error
+) (map[Scope]*contextObjectStore, error) {
+	buckets := map[Scope]string{
+		ProjectScope:  cfg.NATS.ObjectStoreProjectName,
+		WorkflowScope: cfg.NATS.ObjectStoreWorkflowName,
+		NodeScope:     cfg.NATS.ObjectStoreName,
+	}
 
-	// Connect to ObjectStore (optional)
-	if cfg.NATS.ObjectStoreName != "" {
-		objStore, err = js.ObjectStore(cfg.NATS.ObjectStoreName)
+	stores := make(map[Scope]*contextObjectStore, len(buckets))
+
+	for scope, bucket := range buckets {
+		objStore, err := initObjectStore(bucket, scope, logger, js)
 		if err != nil {
-			return nil, fmt.Errorf("error initializing object store: %w", err)
+			return nil, err
+		}
+
+		stores[scope] = &contextObjectStore{
+			cfg:      cfg,
+			logger:   logger,
+			objStore: objStore,
+			bucket:   bucket,
+			scoped:   true,
+			stores:   stores,
 		}
-		return objStore, nil
+	}
+
+	return stores, nil
+}
 
-	} else {
-		logger.Info("Object store not defined. Skipping object store initialization.")
+func initObjectStore(
+	bucket string,
+	scope Scope,
+	logger *simplelogger.SimpleLogger,
+	js nats.JetStreamContext,
+) (nats.ObjectStore, error) {
+	// Connect to ObjectStore (optional)
+	if bucket == "" {
+		logger.Infof("Object store not defined for scope %q. Skipping object store initialization.", scope)
 		return nil, nil
 	}
+
+	objStore, err := js.ObjectStore(bucket)
+	if err != nil {
+		return nil, fmt.Errorf("error initializing %s object store: %w", scope, err)
+	}
+
+	return objStore, nil
+}
+
+// InScope returns the object store of the given scope. Objects are only saved to and
+// retrieved from the given scope's bucket.
+func (c *contextObjectStore) InScope(scope Scope) ContextObjectStore {
+	if store, ok := c.stores[scope]; ok {
+		return store
+	}
+
+	return &contextObjectStore{cfg: c.cfg, logger: c.logger, scoped: true, stores: c.stores, cache: c.cache}
+}
+
+// CacheStats returns the counters of the objects cache, shared by every scope.
+func (c *contextObjectStore) CacheStats() ObjectCacheStats {
+	return c.cache.statistics()
+}
+
+// lookup returns the store holding the given key. Unless the store is bound to a scope,
+// the key is searched starting by Node then upwards, in the objects known by the cache when
+// enabled.
+func (c *contextObjectStore) lookup(key string) (*contextObjectStore, error) {
+	if c.scoped {
+		if c.objStore == nil {
+			return nil, errors.ErrUndefinedObjectStore
+		}
+		return c, nil
+	}
+
+	defined := false
+
+	for _, scope := range allScopesInOrder {
+		store := c.stores[scope]
+		if store == nil || store.objStore == nil {
+			continue
+		}
+		defined = true
+
+		if exists, known := c.cache.exists(store.bucket, key); known {
+			if exists {
+				return store, nil
+			}
+			continue
+		}
+
+		_, err := store.objStore.GetInfo(key)
+		if err == nil {
+			return store, nil
+		}
+		if err != nats.ErrObjectNotFound {
+			return nil, fmt.Errorf("error retrieving object with key %s from the object store: %w", key, err)
+		}
+	}
+
+	if !defined {
+		return nil, errors.ErrUndefinedObjectStore
+	}
+
+	return nil, fmt.Errorf("error retrieving object with key %s from the object store: %w", key, nats.ErrObjectNotFound)
 }
 
 // Save stores the given payload in the Object Store with the given key as identifier
@@ -73,67 +213,62 @@ func (c *contextObjectStore) Save(key string, payload []byte) error {
 		return errors.ErrEmptyPayload
 	}
 
-	_, err := c.objStore.PutBytes(key, payload)
+	info, err := c.objStore.PutBytes(key, payload)
 	if err != nil {
 		return fmt.Errorf("error storing object to the object store: %w", err)
 	}
 
-	c.logger.Debugf("File with key %q successfully stored in object store %q", key, c.cfg.NATS.ObjectStoreName)
+	c.cache.update(c.bucket, info)
+
+	c.logger.Debugf("File with key %q successfully stored in object store %q", key, c.bucket)
 
 	return nil
 }
 
-// Get retrieves the object stored in the node's object store
+// Get retrieves the object stored in the node's object store, or in the workflow's and the
+// project's ones if not found
 func (c *contextObjectStore) Get(key string) ([]byte, error) {
-	if c.objStore == nil {
-		return nil, errors.ErrUndefinedObjectStore
+	store, err := c.lookup(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if response, ok := c.cache.get(store.bucket, key); ok {
+		c.logger.Debugf("File with key %q retrieved from the objects cache", key)
+		return response, nil
 	}
 
-	response, err := c.objStore.GetBytes(key)
+	result, err := store.objStore.Get(key)
 	if err != nil {
 		return nil, fmt.Errorf("error retrieving object with key %s from the object store: %w", key, err)
 	}
+	defer result.Close()
 
-	c.logger.Debugf("File with key %q successfully retrieved from object store %q", key, c.cfg.NATS.ObjectStoreName)
-
-	return response, nil
-}
+	response, err := io.ReadAll(result)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving object with key %s from the object store: %w", key, err)
+	}
 
-func (c *contextObjectStore) Purge(regexp ...string) error {
-	if c.objStore == nil {
-		return errors.ErrUndefinedObjectStore
+	if info, err := result.Info(); err == nil {
+		c.cache.add(store.bucket, key, info.Digest, response)
 	}
 
-	var pattern *regexp2.Regexp
+	c.logger.Debugf("File with key %q successfully retrieved from object store %q", key, store.bucket)
 
-	if len(regexp) > 0 && regexp[0] != "" {
-		pat, err := regexp2.Compile(regexp[0])
-		if err != nil {
-			return fmt.Errorf("error compiling regexp: %w", err)
-		}
+	return response, nil
+}
 
-		pattern = pat
+func compileOptionalRegexp(regexp []string) (*regexp2.Regexp, error) {
+	if len(regexp) == 0 || regexp[0] == "" {
+		return nil, nil
 	}
 
-	objects, err := c.List()
+	pattern, err := regexp2.Compile(regexp[0])
 	if err != nil {
-		return fmt.Errorf("error listing objects from the object store: %w", err)
+		return nil, fmt.Errorf("error compiling regexp: %w", err)
 	}
 
-	for _, objectName := range objects {
-		if pattern == nil || pattern.MatchString(objectName) {
-			err := c.objStore.Delete(objectName)
-
-			c.logger.Debugf("Deleting object %q", objectName)
-			if err != nil {
-				return fmt.Errorf("error purging objects from the object store: %w", err)
-			}
-		}
-	}
-
-	c.logger.Debugf("Files successfully purged from object store %q", c.cfg.NATS.ObjectStoreName)
-
-	return nil
+	return pattern, nil
 }
 
 func (c *contextObjectStore) List(regexp ...string) ([]string, error) {
@@ -142,19 +277,13 @@ func (c *contextObjectStore) List(regexp ...string) ([]string, error) {
 	}
 
 	objStoreList, err := c.objStore.List()
-	if err != nil {
+	if err != nil && err != nats.ErrNoObjectsFound {
 		return nil, fmt.Errorf("error listing objects from the object store: %w", err)
 	}
 
-	var pattern *regexp2.Regexp
-
-	if len(regexp) > 0 && regexp[0] != "" {
-		pat, err := regexp2.Compile(regexp[0])
-		if err != nil {
-			return nil, fmt.Errorf("error compiling regexp: %w", err)
-		}
-
-		pattern = pat
+	pattern, err := compileOptionalRegexp(regexp)
+	if err != nil {
+		return nil, err
 	}
 
 	response := []string{}
@@ -165,7 +294,7 @@ func (c *contextObjectStore) List(regexp ...string) ([]string, error) {
 		}
 	}
 
-	c.logger.Debugf("Files successfully listed from object store %q", c.cfg.NATS.ObjectStoreName)
+	c.logger.Debugf("Files successfully listed from object store %q", c.bucket)
 
 	return response, nil
 }
@@ -181,7 +310,9 @@ func (c *contextObjectStore) Delete(key string) error {
 		return fmt.Errorf("error retrieving object with key %s from the object store: %w", key, err)
 	}
 
-	c.logger.Debugf("File with key %q successfully deleted in object store %q", key, c.cfg.NATS.ObjectStoreName)
+	c.cache.deleted(c.bucket, key)
+
+	c.logger.Debugf("File with key %q successfully deleted in object store %q", key, c.bucket)
 
 	return nil
 }
@@ -3,8 +3,12 @@
 package kre
 
 import (
+	"bytes"
 	"context"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/nats-io/nats.go"
 	"github.com/testcontainers/testcontainers-go"
@@ -13,6 +17,7 @@ import (
 	"github.com/testcontainers/testcontainers-go/wait"
 
 	"github.com/konstellation-io/kre-runners/kre-go/v4/config"
+	"github.com/konstellation-io/kre-runners/kre-go/v4/internal/errors"
 	"github.com/konstellation-io/kre/libs/simplelogger"
 )
 
@@ -186,7 +191,7 @@ func (s *ContextObjectStoreTestSuite) TestObjectStorePurge() {
 	s.Require().NoError(err)
 
 	buckets, err := s.ctxObjectStore.List()
-	s.Require().Error(err)
+	s.Require().NoError(err)
 	s.Require().Empty(buckets)
 }
 
@@ -341,3 +346,232 @@ func (s *ContextObjectStoreTestSuite) TestObjectStoreDeleteWithNonExistingKey()
 	// then
 	s.Require().Error(err)
 }
+
+func (s *ContextObjectStoreTestSuite) TestObjectStorePutAndGetTo() {
+	// given
+	key := "model"
+	value := bytes.Repeat([]byte("weights"), 100000)
+
+	var lastTransferred, lastTotal int64
+	progress := func(transferred, total int64) {
+		lastTransferred, lastTotal = transferred, total
+	}
+
+	// when
+	err := s.ctxObjectStore.Put(key, bytes.NewReader(value))
+	s.Require().NoError(err)
+
+	var buf bytes.Buffer
+	err = s.ctxObjectStore.GetTo(key, &buf, progress)
+	s.Require().NoError(err)
+
+	// then
+	s.Assert().Equal(value, buf.Bytes())
+	s.Assert().Equal(int64(len(value)), lastTransferred)
+	s.Assert().Equal(int64(len(value)), lastTotal)
+}
+
+func (s *ContextObjectStoreTestSuite) TestObjectStoreSaveFileAndGetToFile() {
+	// given
+	s.ctxObjectStore.cfg.BasePath = s.T().TempDir()
+	value := []byte("lookup table")
+	err := os.WriteFile(filepath.Join(s.ctxObjectStore.cfg.BasePath, "table.csv"), value, 0o600)
+	s.Require().NoError(err)
+
+	// when
+	err = s.ctxObjectStore.SaveFile("table", "table.csv")
+	s.Require().NoError(err)
+
+	err = s.ctxObjectStore.GetToFile("table", "downloads/table.csv")
+	s.Require().NoError(err)
+
+	// then
+	content, err := os.ReadFile(filepath.Join(s.ctxObjectStore.cfg.BasePath, "downloads", "table.csv"))
+	s.Require().NoError(err)
+	s.Assert().Equal(value, content)
+}
+
+func (s *ContextObjectStoreTestSuite) TestObjectStoreSaveWithOptionsAndGetInfo() {
+	// given
+	opts := ObjectOptions{
+		ContentType: "application/json",
+		Description: "model params",
+		Headers:     map[string]string{"Model-Version": "3"},
+		TTL:         time.Hour,
+	}
+
+	// when
+	err := s.ctxObjectStore.SaveWithOptions("params", []byte(`{"k": 1}`), opts)
+	s.Require().NoError(err)
+
+	info, err := s.ctxObjectStore.GetInfo("params")
+	s.Require().NoError(err)
+
+	// then
+	s.Assert().Equal("application/json", info.ContentType)
+	s.Assert().Equal("model params", info.Description)
+	s.Assert().Equal("3", info.Headers["Model-Version"])
+	s.Assert().Equal(uint64(8), info.Size)
+	s.Assert().NotEmpty(info.Digest)
+	s.Assert().False(info.ExpiresAt.IsZero())
+
+	infos, err := s.ctxObjectStore.ListInfo("^par")
+	s.Require().NoError(err)
+	s.Require().Len(infos, 1)
+	s.Assert().Equal("params", infos[0].Name)
+}
+
+func (s *ContextObjectStoreTestSuite) TestObjectStoreDeleteExpiredObjects() {
+	// given
+	err := s.ctxObjectStore.SaveWithOptions("expiring", []byte("value"), ObjectOptions{TTL: time.Minute})
+	s.Require().NoError(err)
+	err = s.ctxObjectStore.Save("permanent", []byte("value"))
+	s.Require().NoError(err)
+
+	// when
+	s.ctxObjectStore.deleteExpiredObjects(time.Now().Add(time.Hour))
+
+	// then
+	keys, err := s.ctxObjectStore.List()
+	s.Require().NoError(err)
+	s.Assert().Equal([]string{"permanent"}, keys)
+}
+
+func (s *ContextObjectStoreTestSuite) TestObjectStoreScopes() {
+	// given
+	cfg := s.cfg
+	cfg.NATS.ObjectStoreWorkflowName = "workflow_object_store"
+	_, err := s.js.CreateObjectStore(&nats.ObjectStoreConfig{Bucket: cfg.NATS.ObjectStoreWorkflowName})
+	s.Require().NoError(err)
+	defer s.js.DeleteObjectStore(cfg.NATS.ObjectStoreWorkflowName)
+
+	ctxObjectStore, err := NewContextObjectStore(cfg, s.logger, s.js)
+	s.Require().NoError(err)
+
+	// when
+	err = ctxObjectStore.InScope(WorkflowScope).Save("model", []byte("workflow model"))
+	s.Require().NoError(err)
+	err = ctxObjectStore.InScope(WorkflowScope).Save("shared", []byte("workflow value"))
+	s.Require().NoError(err)
+	err = ctxObjectStore.Save("shared", []byte("node value"))
+	s.Require().NoError(err)
+
+	// then
+	model, err := ctxObjectStore.Get("model")
+	s.Require().NoError(err)
+	s.Assert().Equal([]byte("workflow model"), model)
+
+	shared, err := ctxObjectStore.Get("shared")
+	s.Require().NoError(err)
+	s.Assert().Equal([]byte("node value"), shared)
+
+	shared, err = ctxObjectStore.InScope(WorkflowScope).Get("shared")
+	s.Require().NoError(err)
+	s.Assert().Equal([]byte("workflow value"), shared)
+
+	_, err = ctxObjectStore.InScope(NodeScope).Get("model")
+	s.Assert().ErrorIs(err, nats.ErrObjectNotFound)
+
+	_, err = ctxObjectStore.InScope(ProjectScope).Get("model")
+	s.Assert().ErrorIs(err, errors.ErrUndefinedObjectStore)
+}
+
+func (s *ContextObjectStoreTestSuite) TestObjectStoreCache() {
+	// given
+	cfg := s.cfg
+	cfg.ObjectStore.CacheMaxBytes = 1024
+	ctxObjectStore, err := NewContextObjectStore(cfg, s.logger, s.js)
+	s.Require().NoError(err)
+
+	err = ctxObjectStore.Save("model", []byte("model v1"))
+	s.Require().NoError(err)
+
+	// when
+	s.Require().Eventually(func() bool {
+		_, err := ctxObjectStore.Get("model")
+		s.Require().NoError(err)
+		return ctxObjectStore.CacheStats().Objects == 1
+	}, 5*time.Second, 50*time.Millisecond)
+
+	value, err := ctxObjectStore.Get("model")
+	s.Require().NoError(err)
+	s.Assert().Equal([]byte("model v1"), value)
+	s.Assert().NotZero(ctxObjectStore.CacheStats().Hits)
+
+	err = ctxObjectStore.Save("model", []byte("model v2"))
+	s.Require().NoError(err)
+
+	// then
+	s.Require().Eventually(func() bool {
+		value, err := ctxObjectStore.Get("model")
+		s.Require().NoError(err)
+		return string(value) == "model v2"
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+func (s *ContextObjectStoreTestSuite) TestObjectStoreCacheReadAfterWrite() {
+	// given an object store whose cache already knows the bucket's objects
+	cfg := s.cfg
+	cfg.ObjectStore.CacheMaxBytes = 1024
+	ctxObjectStore, err := NewContextObjectStore(cfg, s.logger, s.js)
+	s.Require().NoError(err)
+
+	s.Require().Eventually(func() bool {
+		_, known := ctxObjectStore.cache.exists(ctxObjectStore.bucket, "model")
+		return known
+	}, 5*time.Second, 50*time.Millisecond)
+
+	// when the object is saved
+	err = ctxObjectStore.Save("model", []byte("model v1"))
+	s.Require().NoError(err)
+
+	// then it is found right away, without waiting for the watcher
+	value, err := ctxObjectStore.Get("model")
+	s.Require().NoError(err)
+	s.Assert().Equal([]byte("model v1"), value)
+
+	err = ctxObjectStore.Delete("model")
+	s.Require().NoError(err)
+
+	_, err = ctxObjectStore.Get("model")
+	s.Assert().ErrorIs(err, nats.ErrObjectNotFound)
+}
+
+func (s *ContextObjectStoreTestSuite) TestObjectStorePurgeDryRun() {
+	// given
+	for _, key := range []string{"key1", "key2", "test1"} {
+		err := s.ctxObjectStore.Save(key, []byte("value"))
+		s.Require().NoError(err)
+	}
+
+	// when
+	purged, err := s.ctxObjectStore.PurgeWithOptions(PurgeOptions{Regexp: "^key", DryRun: true})
+	s.Require().NoError(err)
+
+	// then
+	s.Assert().ElementsMatch([]string{"key1", "key2"}, purged)
+
+	keys, err := s.ctxObjectStore.List()
+	s.Require().NoError(err)
+	s.Assert().Len(keys, 3)
+}
+
+func (s *ContextObjectStoreTestSuite) TestObjectStorePurgeOlderThan() {
+	// given
+	err := s.ctxObjectStore.Save("old", []byte("value"))
+	s.Require().NoError(err)
+	time.Sleep(time.Second)
+	err = s.ctxObjectStore.Save("new", []byte("value"))
+	s.Require().NoError(err)
+
+	// when
+	purged, err := s.ctxObjectStore.PurgeWithOptions(PurgeOptions{OlderThan: 500 * time.Millisecond, Concurrency: 1})
+	s.Require().NoError(err)
+
+	// then
+	s.Assert().Equal([]string{"old"}, purged)
+
+	keys, err := s.ctxObjectStore.List()
+	s.Require().NoError(err)
+	s.Assert().Equal([]string{"new"}, keys)
+}
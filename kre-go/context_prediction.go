@@ -81,7 +81,7 @@ func (c *contextPrediction) Save(date time.Time, predictedValue, trueValue strin
 		return
 	}
 
-	_, err = c.nc.Request(c.cfg.NATS.MongoWriterSubject, msg, saveMetricTimeout)
+	_, err = c.nc.Request(c.cfg.NATS.MongoWriterSubject, msg, c.cfg.Timeouts.SaveMetric)
 	if err != nil {
 		c.logger.Infof("Error sending metric to NATS: %s", err)
 	}
@@ -105,7 +105,7 @@ func (c *contextPrediction) SaveError(saveMetricErr SaveMetricErr) {
 		c.logger.Infof("Error generating SaveMetricMsg JSON: %s", err)
 	}
 
-	_, err = c.nc.Request(c.cfg.NATS.MongoWriterSubject, msg, saveMetricTimeout)
+	_, err = c.nc.Request(c.cfg.NATS.MongoWriterSubject, msg, c.cfg.Timeouts.SaveMetric)
 	if err != nil {
 		c.logger.Infof("Error sending error metric to NATS: %s", err)
 	}
@@ -0,0 +1,139 @@
+package kre
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Index is a MongoDB index on the given keys. A TTL makes MongoDB delete the documents once the
+// time of its single date key is older than the TTL.
+type Index struct {
+	Name   string
+	Keys   []SortField
+	Unique bool
+	TTL    time.Duration
+}
+
+func (i Index) model() mongo.IndexModel {
+	keys := FindOptions{Sort: i.Keys}.sort()
+	if keys == nil {
+		keys = bson.D{}
+	}
+
+	opts := options.Index()
+	if i.Name != "" {
+		opts.SetName(i.Name)
+	}
+	if i.Unique {
+		opts.SetUnique(true)
+	}
+	if i.TTL > 0 {
+		opts.SetExpireAfterSeconds(int32(i.TTL.Seconds()))
+	}
+
+	return mongo.IndexModel{Keys: keys, Options: opts}
+}
+
+// EnsureIndexes creates the indexes in the collection, unless they already exist.
+func (c *contextDatabase) EnsureIndexes(ctx context.Context, collection string, indexes ...Index) error {
+	if len(indexes) == 0 {
+		return nil
+	}
+
+	models := make([]mongo.IndexModel, 0, len(indexes))
+	for _, index := range indexes {
+		if len(index.Keys) == 0 {
+			return fmt.Errorf("error creating index %q of collection %q: no keys given", index.Name, collection)
+		}
+		models = append(models, index.model())
+	}
+
+	ctx, cancel := c.writeContext(ctx)
+	defer cancel()
+
+	err := c.mongoM.CreateIndexes(ctx, collection, models)
+	if err != nil {
+		return fmt.Errorf("error creating indexes of collection %q: %w", collection, err)
+	}
+
+	return nil
+}
+
+// Collection reads and writes documents of type T, usually a struct with bson tags, in a
+// MongoDB collection. Documents are encoded and decoded as BSON in both ways, so they are read as
+// written, except for times, which MongoDB stores with millisecond precision and are read in UTC.
+//
+// A collection is usually created and its indexes ensured in the HandlerInit:
+//
+//	predictions = kre.NewCollection[Prediction](ctx, "predictions")
+//	err := predictions.EnsureIndexes(ctx.Context(), kre.Index{Keys: []kre.SortField{{Field: "request_id"}}})
+type Collection[T any] struct {
+	db   ContextDatabase
+	name string
+}
+
+// NewCollection returns the collection with the given name of the handler context's database.
+func NewCollection[T any](ctx *HandlerContext, name string) *Collection[T] {
+	return &Collection[T]{db: ctx.DB, name: name}
+}
+
+// Name returns the collection's name.
+func (c *Collection[T]) Name() string {
+	return c.name
+}
+
+// EnsureIndexes creates the indexes in the collection, unless they already exist.
+func (c *Collection[T]) EnsureIndexes(ctx context.Context, indexes ...Index) error {
+	return c.db.EnsureIndexes(ctx, c.name, indexes...)
+}
+
+// Insert stores the documents in the collection, returning their ids.
+func (c *Collection[T]) Insert(ctx context.Context, docs ...T) ([]interface{}, error) {
+	values := make([]interface{}, 0, len(docs))
+	for _, doc := range docs {
+		values = append(values, doc)
+	}
+
+	return c.db.Insert(ctx, c.name, values...)
+}
+
+// Find returns the documents matching the filter, sorted, paginated and projected as given by
+// the optional FindOptions.
+func (c *Collection[T]) Find(ctx context.Context, filter QueryData, optsOpt ...FindOptions) ([]T, error) {
+	results := []T{}
+
+	err := c.db.FindWithOptions(ctx, c.name, filter, optionalFindOptions(optsOpt), &results)
+	if err != nil {
+		return nil, fmt.Errorf("error finding documents of collection %q: %w", c.name, err)
+	}
+
+	return results, nil
+}
+
+// FindOne returns the first document matching the filter, failing with ErrDocumentNotFound
+// when none matches.
+func (c *Collection[T]) FindOne(ctx context.Context, filter QueryData, optsOpt ...FindOptions) (*T, error) {
+	result := new(T)
+
+	err := c.db.FindOne(ctx, c.name, filter, result, optsOpt...)
+	if err != nil {
+		return nil, fmt.Errorf("error finding document of collection %q: %w", c.name, err)
+	}
+
+	return result, nil
+}
+
+// Update applies the update to every document matching the filter, as ContextDatabase.Update does.
+func (c *Collection[T]) Update(ctx context.Context, filter, update QueryData) (*WriteResult, error) {
+	return c.db.Update(ctx, c.name, filter, update)
+}
+
+// Delete deletes every document matching the filter, returning the number of deleted documents.
+func (c *Collection[T]) Delete(ctx context.Context, filter QueryData) (int64, error) {
+	return c.db.DeleteMany(ctx, c.name, filter)
+}
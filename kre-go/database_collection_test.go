@@ -0,0 +1,47 @@
+//go:build unit
+
+package kre
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type CollectionTestSuite struct {
+	suite.Suite
+}
+
+func TestCollectionTestSuite(t *testing.T) {
+	suite.Run(t, new(CollectionTestSuite))
+}
+
+func (suite *CollectionTestSuite) TestIndexModel() {
+	// GIVEN a unique TTL index
+	index := Index{
+		Name:   "created_at_ttl",
+		Keys:   []SortField{{Field: "created_at", Descending: true}},
+		Unique: true,
+		TTL:    time.Hour,
+	}
+
+	// WHEN it is converted to the driver model
+	model := index.model()
+
+	// THEN the keys and options are kept
+	suite.Equal(bson.D{{Key: "created_at", Value: -1}}, model.Keys)
+	suite.Equal("created_at_ttl", *model.Options.Name)
+	suite.True(*model.Options.Unique)
+	suite.Equal(int32(3600), *model.Options.ExpireAfterSeconds)
+}
+
+func (suite *CollectionTestSuite) TestEnsureIndexesWithoutKeys() {
+	db := &contextDatabase{}
+
+	err := db.EnsureIndexes(context.Background(), "predictions", Index{Name: "empty"})
+
+	suite.Error(err)
+}
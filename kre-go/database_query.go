@@ -0,0 +1,265 @@
+package kre
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/konstellation-io/kre-runners/kre-go/v4/mongodb"
+)
+
+// ErrDocumentNotFound is returned by FindOne when no document matches the filter.
+var ErrDocumentNotFound = mongo.ErrNoDocuments
+
+// SortField sorts the documents by the field, in ascending order unless Descending.
+type SortField struct {
+	Field      string
+	Descending bool
+}
+
+// FindOptions are the optional settings of a query. Projection selects the fields returned,
+// e.g. QueryData{"_id": 0, "result": 1}.
+type FindOptions struct {
+	Sort       []SortField
+	Limit      int64
+	Skip       int64
+	Projection QueryData
+}
+
+func (q QueryData) bson() bson.M {
+	criteria := bson.M{}
+	for k, v := range q {
+		criteria[k] = v
+	}
+
+	return criteria
+}
+
+func (o FindOptions) sort() bson.D {
+	if len(o.Sort) == 0 {
+		return nil
+	}
+
+	sort := make(bson.D, 0, len(o.Sort))
+	for _, field := range o.Sort {
+		order := 1
+		if field.Descending {
+			order = -1
+		}
+		sort = append(sort, bson.E{Key: field.Field, Value: order})
+	}
+
+	return sort
+}
+
+func (o FindOptions) findOptions() *options.FindOptions {
+	opts := options.Find()
+
+	if sort := o.sort(); sort != nil {
+		opts.SetSort(sort)
+	}
+	if o.Limit > 0 {
+		opts.SetLimit(o.Limit)
+	}
+	if o.Skip > 0 {
+		opts.SetSkip(o.Skip)
+	}
+	if o.Projection != nil {
+		opts.SetProjection(o.Projection.bson())
+	}
+
+	return opts
+}
+
+func (o FindOptions) findOneOptions() *options.FindOneOptions {
+	opts := options.FindOne()
+
+	if sort := o.sort(); sort != nil {
+		opts.SetSort(sort)
+	}
+	if o.Skip > 0 {
+		opts.SetSkip(o.Skip)
+	}
+	if o.Projection != nil {
+		opts.SetProjection(o.Projection.bson())
+	}
+
+	return opts
+}
+
+func optionalFindOptions(optsOpt []FindOptions) FindOptions {
+	if len(optsOpt) > 0 {
+		return optsOpt[0]
+	}
+	return FindOptions{}
+}
+
+// queryContext bounds a query by the deadline of the given context, usually the handler's one
+// from HandlerContext.Context, or by the KRT_GET_DATA_TIMEOUT when it has none.
+func (c *contextDatabase) queryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return boundContext(ctx, c.cfg.Timeouts.GetData)
+}
+
+func boundContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
+// FindOne decodes into result the first document matching the filter, sorted and projected
+// as given by the optional FindOptions. It fails with ErrDocumentNotFound when none matches.
+func (c *contextDatabase) FindOne(
+	ctx context.Context,
+	collection string,
+	filter QueryData,
+	result interface{},
+	optsOpt ...FindOptions,
+) error {
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
+	return c.mongoM.FindOne(ctx, collection, filter.bson(), optionalFindOptions(optsOpt).findOneOptions(), result)
+}
+
+// FindWithOptions works as Find, sorting, paginating and projecting the documents as given.
+func (c *contextDatabase) FindWithOptions(
+	ctx context.Context,
+	collection string,
+	filter QueryData,
+	opts FindOptions,
+	results interface{},
+) error {
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
+	return c.mongoM.FindWithOptions(ctx, collection, filter.bson(), opts.findOptions(), results)
+}
+
+// Iterate returns a cursor over the documents matching the filter, to decode large results one
+// by one instead of loading them all in memory. The cursor is only bound by the given context,
+// and must be closed once done.
+func (c *contextDatabase) Iterate(
+	ctx context.Context,
+	collection string,
+	filter QueryData,
+	optsOpt ...FindOptions,
+) (*Cursor, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	cursor, err := c.mongoM.Cursor(ctx, collection, filter.bson(), optionalFindOptions(optsOpt).findOptions())
+	if err != nil {
+		return nil, err
+	}
+
+	return &Cursor{ctx: ctx, cursor: cursor}, nil
+}
+
+// Count returns the number of documents matching the filter.
+func (c *contextDatabase) Count(ctx context.Context, collection string, filter QueryData) (int64, error) {
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
+	return c.mongoM.Count(ctx, collection, filter.bson())
+}
+
+// Distinct returns the distinct values of the field in the documents matching the filter.
+func (c *contextDatabase) Distinct(
+	ctx context.Context,
+	collection, field string,
+	filter QueryData,
+) ([]interface{}, error) {
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
+	return c.mongoM.Distinct(ctx, collection, field, filter.bson())
+}
+
+// Aggregate runs the aggregation pipeline on the collection, decoding the documents returned
+// into results. As the keys of a QueryData have no order, $sort stages sorting by several fields
+// take them as a []SortField, or an ordered bson.D.
+func (c *contextDatabase) Aggregate(
+	ctx context.Context,
+	collection string,
+	pipeline []QueryData,
+	results interface{},
+) error {
+	stages := make([]bson.M, 0, len(pipeline))
+	for _, stage := range pipeline {
+		bsonStage, err := aggregationStage(stage)
+		if err != nil {
+			return err
+		}
+
+		stages = append(stages, bsonStage)
+	}
+
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
+	return c.mongoM.Aggregate(ctx, collection, stages, results)
+}
+
+// aggregationStage converts the fields of a $sort stage given as a []SortField into an ordered
+// document, failing when they are given unordered.
+func aggregationStage(stage QueryData) (bson.M, error) {
+	criteria := stage.bson()
+
+	switch sort := criteria["$sort"].(type) {
+	case []SortField:
+		criteria["$sort"] = FindOptions{Sort: sort}.sort()
+	case QueryData:
+		if len(sort) > 1 {
+			return nil, fmt.Errorf("the $sort stage fields must be given as a []SortField to keep their order")
+		}
+	case bson.M:
+		if len(sort) > 1 {
+			return nil, fmt.Errorf("the $sort stage fields must be given as a []SortField to keep their order")
+		}
+	}
+
+	return criteria, nil
+}
+
+// Cursor iterates over the documents returned by Iterate:
+//
+//	for cursor.Next() {
+//		err := cursor.Decode(&doc)
+//	}
+//	err := cursor.Err()
+type Cursor struct {
+	ctx    context.Context
+	cursor mongodb.Cursor
+}
+
+// Next moves the cursor to the next document, returning false once there are no more documents
+// or an error happened.
+func (c *Cursor) Next() bool {
+	return c.cursor.Next(c.ctx)
+}
+
+// Decode decodes the current document into val.
+func (c *Cursor) Decode(val interface{}) error {
+	return c.cursor.Decode(val)
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (c *Cursor) Err() error {
+	return c.cursor.Err()
+}
+
+// Close closes the cursor.
+func (c *Cursor) Close() error {
+	return c.cursor.Close(context.Background())
+}
@@ -0,0 +1,81 @@
+//go:build unit
+
+package kre
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/konstellation-io/kre-runners/kre-go/v4/config"
+)
+
+type DatabaseQueryTestSuite struct {
+	suite.Suite
+	ctxData *contextDatabase
+}
+
+func TestDatabaseQueryTestSuite(t *testing.T) {
+	suite.Run(t, new(DatabaseQueryTestSuite))
+}
+
+func (suite *DatabaseQueryTestSuite) SetupTest() {
+	suite.ctxData = &contextDatabase{cfg: config.Config{Timeouts: config.Timeouts{GetData: time.Second}}}
+}
+
+func (suite *DatabaseQueryTestSuite) TestFindOptions() {
+	// GIVEN find options
+	opts := FindOptions{
+		Sort:       []SortField{{Field: "time", Descending: true}, {Field: "asset"}},
+		Limit:      10,
+		Skip:       20,
+		Projection: QueryData{"_id": 0},
+	}
+
+	// WHEN they are converted to the driver options
+	findOpts := opts.findOptions()
+
+	// THEN the sort order is kept
+	suite.Equal(bson.D{{Key: "time", Value: -1}, {Key: "asset", Value: 1}}, findOpts.Sort)
+	suite.Equal(int64(10), *findOpts.Limit)
+	suite.Equal(int64(20), *findOpts.Skip)
+	suite.Equal(bson.M{"_id": 0}, findOpts.Projection)
+}
+
+func (suite *DatabaseQueryTestSuite) TestEmptyFindOptions() {
+	findOpts := FindOptions{}.findOptions()
+
+	suite.Nil(findOpts.Sort)
+	suite.Nil(findOpts.Limit)
+	suite.Nil(findOpts.Skip)
+	suite.Nil(findOpts.Projection)
+}
+
+func (suite *DatabaseQueryTestSuite) TestQueryContextUsesGetDataTimeout() {
+	// WHEN the given context has no deadline
+	ctx, cancel := suite.ctxData.queryContext(context.Background())
+	defer cancel()
+
+	// THEN the query is bound by the get data timeout
+	deadline, ok := ctx.Deadline()
+	suite.Require().True(ok)
+	suite.WithinDuration(time.Now().Add(time.Second), deadline, 100*time.Millisecond)
+}
+
+func (suite *DatabaseQueryTestSuite) TestQueryContextUsesHandlerDeadline() {
+	// GIVEN a handler context with a deadline longer than the get data timeout
+	handlerCtx, cancelHandler := context.WithTimeout(context.Background(), time.Minute)
+	defer cancelHandler()
+
+	// WHEN a query context is created
+	ctx, cancel := suite.ctxData.queryContext(handlerCtx)
+	defer cancel()
+
+	// THEN the query is bound by the handler's deadline
+	deadline, _ := ctx.Deadline()
+	handlerDeadline, _ := handlerCtx.Deadline()
+	suite.Equal(handlerDeadline, deadline)
+}
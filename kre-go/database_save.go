@@ -0,0 +1,228 @@
+package kre
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/konstellation-io/kre/libs/simplelogger"
+)
+
+var errSaveBatcherClosed = errors.New("the runner is shutting down, documents can't be saved")
+
+// saveBatchMsgOverhead is the room left in a NATS message for the batch envelope.
+const saveBatchMsgOverhead = 1024
+
+// SaveDataBatchMsg is the message sent to the mongo writer with the documents saved with
+// SaveAsync to a collection.
+type SaveDataBatchMsg struct {
+	Coll string            `json:"coll"`
+	Docs []json.RawMessage `json:"docs"`
+}
+
+// SaveFailure describes a batch of documents saved with SaveAsync that the mongo writer didn't
+// store.
+type SaveFailure struct {
+	Collection string
+	Documents  int
+	Err        error
+}
+
+// saveBatcher buffers the documents of each collection, sending them to the mongo writer in a
+// single message once the batch is full, its max wait expires, or it is flushed.
+type saveBatcher struct {
+	size     int
+	maxWait  time.Duration
+	maxBytes int
+	send     func(collection string, docs []json.RawMessage) error
+	logger   *simplelogger.SimpleLogger
+
+	mu        sync.Mutex
+	batches   map[string]*saveBatch
+	onFailure func(SaveFailure)
+	sending   map[chan struct{}]struct{}
+	closed    bool
+
+	// asyncErr is the first error of the batches sent in the background since the last flush
+	asyncErr error
+}
+
+type saveBatch struct {
+	docs  []json.RawMessage
+	bytes int
+	timer *time.Timer
+}
+
+func newSaveBatcher(
+	size int,
+	maxWait time.Duration,
+	maxBytes int,
+	send func(collection string, docs []json.RawMessage) error,
+	logger *simplelogger.SimpleLogger,
+) *saveBatcher {
+	b := &saveBatcher{
+		size:     size,
+		maxWait:  maxWait,
+		maxBytes: maxBytes,
+		send:     send,
+		logger:   logger,
+		batches:  make(map[string]*saveBatch),
+		sending:  make(map[chan struct{}]struct{}),
+	}
+
+	b.onFailure = func(failure SaveFailure) {
+		logger.Errorf("Error saving %d documents to collection %q: %s", failure.Documents, failure.Collection, failure.Err)
+	}
+
+	return b
+}
+
+func (b *saveBatcher) setOnFailure(callback func(SaveFailure)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.onFailure = callback
+}
+
+// add queues the marshaled document, sending the collection's batch in the background once full.
+// Documents are rejected once the batcher is closed.
+func (b *saveBatcher) add(collection string, doc json.RawMessage) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return errSaveBatcherClosed
+	}
+
+	batch := b.batches[collection]
+	if batch != nil && batch.bytes+len(doc) > b.maxBytes {
+		b.sendAsync(collection, b.detach(collection))
+		batch = nil
+	}
+
+	if batch == nil {
+		newBatch := &saveBatch{}
+		newBatch.timer = time.AfterFunc(b.maxWait, func() { b.expire(collection, newBatch) })
+		b.batches[collection] = newBatch
+		batch = newBatch
+	}
+
+	batch.docs = append(batch.docs, doc)
+	batch.bytes += len(doc)
+
+	if len(batch.docs) >= b.size {
+		b.sendAsync(collection, b.detach(collection))
+	}
+
+	return nil
+}
+
+// expire sends the batch once its max wait expires, unless it was already sent.
+func (b *saveBatcher) expire(collection string, batch *saveBatch) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.batches[collection] == batch {
+		b.sendAsync(collection, b.detach(collection))
+	}
+}
+
+// detach removes the collection's batch, which must exist, and returns its documents.
+func (b *saveBatcher) detach(collection string) []json.RawMessage {
+	batch := b.batches[collection]
+	batch.timer.Stop()
+	delete(b.batches, collection)
+
+	return batch.docs
+}
+
+// sendAsync sends the batch in the background, tracking it until sent so flush can wait for it.
+// It must be called holding the lock.
+func (b *saveBatcher) sendAsync(collection string, docs []json.RawMessage) {
+	done := make(chan struct{})
+	b.sending[done] = struct{}{}
+
+	go func() {
+		err := b.sendBatch(collection, docs)
+
+		b.mu.Lock()
+		delete(b.sending, done)
+		if err != nil && b.asyncErr == nil {
+			b.asyncErr = err
+		}
+		b.mu.Unlock()
+
+		close(done)
+	}()
+}
+
+func (b *saveBatcher) sendBatch(collection string, docs []json.RawMessage) error {
+	err := b.send(collection, docs)
+	if err != nil {
+		b.mu.Lock()
+		onFailure := b.onFailure
+		b.mu.Unlock()
+
+		onFailure(SaveFailure{Collection: collection, Documents: len(docs), Err: err})
+
+		return fmt.Errorf("error saving %d documents to collection %q: %w", len(docs), collection, err)
+	}
+
+	b.logger.Debugf("%d documents sent to collection %q", len(docs), collection)
+
+	return nil
+}
+
+// flush sends every pending batch and waits for the batches being sent, returning the first
+// error of the batches sent since the previous flush, including those sent in the background.
+// Failures are reported to the failure callback as well.
+func (b *saveBatcher) flush() error {
+	return b.sendPending(false)
+}
+
+// close flushes the pending batches, rejecting the documents added afterwards.
+func (b *saveBatcher) close() error {
+	return b.sendPending(true)
+}
+
+func (b *saveBatcher) sendPending(closing bool) error {
+	b.mu.Lock()
+	if closing {
+		b.closed = true
+	}
+
+	pending := make(map[string][]json.RawMessage, len(b.batches))
+	for collection := range b.batches {
+		pending[collection] = b.detach(collection)
+	}
+
+	sending := make([]chan struct{}, 0, len(b.sending))
+	for done := range b.sending {
+		sending = append(sending, done)
+	}
+	b.mu.Unlock()
+
+	var firstErr error
+	for collection, docs := range pending {
+		if err := b.sendBatch(collection, docs); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	for _, done := range sending {
+		<-done
+	}
+
+	b.mu.Lock()
+	asyncErr := b.asyncErr
+	b.asyncErr = nil
+	b.mu.Unlock()
+
+	if asyncErr != nil {
+		return asyncErr
+	}
+
+	return firstErr
+}
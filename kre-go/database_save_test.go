@@ -0,0 +1,167 @@
+//go:build unit
+
+package kre
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/konstellation-io/kre-runners/kre-go/v4/config"
+	"github.com/konstellation-io/kre-runners/kre-go/v4/docstore"
+	"github.com/konstellation-io/kre/libs/simplelogger"
+)
+
+type SaveBatcherTestSuite struct {
+	suite.Suite
+	logger *simplelogger.SimpleLogger
+	mu     sync.Mutex
+	sent   map[string][][]json.RawMessage
+	err    error
+}
+
+func TestSaveBatcherTestSuite(t *testing.T) {
+	suite.Run(t, new(SaveBatcherTestSuite))
+}
+
+func (suite *SaveBatcherTestSuite) SetupTest() {
+	suite.logger = simplelogger.New(simplelogger.LevelInfo)
+	suite.sent = make(map[string][][]json.RawMessage)
+	suite.err = nil
+}
+
+func (suite *SaveBatcherTestSuite) send(collection string, docs []json.RawMessage) error {
+	suite.mu.Lock()
+	defer suite.mu.Unlock()
+
+	suite.sent[collection] = append(suite.sent[collection], docs)
+
+	return suite.err
+}
+
+func (suite *SaveBatcherTestSuite) sentBatches(collection string) [][]json.RawMessage {
+	suite.mu.Lock()
+	defer suite.mu.Unlock()
+
+	return suite.sent[collection]
+}
+
+func (suite *SaveBatcherTestSuite) TestBatchesAreSentPerCollectionWhenFull() {
+	// GIVEN a batcher of two documents
+	batcher := newSaveBatcher(2, time.Hour, 1024, suite.send, suite.logger)
+
+	// WHEN documents of two collections are added
+	batcher.add("a", json.RawMessage(`{"n":1}`))
+	batcher.add("b", json.RawMessage(`{"n":2}`))
+	batcher.add("a", json.RawMessage(`{"n":3}`))
+
+	// THEN only the full batch is sent
+	suite.Eventually(func() bool { return len(suite.sentBatches("a")) == 1 }, time.Second, 10*time.Millisecond)
+	suite.Equal([]json.RawMessage{json.RawMessage(`{"n":1}`), json.RawMessage(`{"n":3}`)}, suite.sentBatches("a")[0])
+	suite.Empty(suite.sentBatches("b"))
+
+	// THEN the pending batch is sent when flushed
+	suite.Require().NoError(batcher.flush())
+	suite.Len(suite.sentBatches("b"), 1)
+}
+
+func (suite *SaveBatcherTestSuite) TestBatchIsSentWhenMaxWaitExpires() {
+	batcher := newSaveBatcher(100, 20*time.Millisecond, 1024, suite.send, suite.logger)
+
+	batcher.add("a", json.RawMessage(`{"n":1}`))
+
+	suite.Eventually(func() bool { return len(suite.sentBatches("a")) == 1 }, time.Second, 10*time.Millisecond)
+}
+
+func (suite *SaveBatcherTestSuite) TestBatchIsSentBeforeExceedingMaxBytes() {
+	// GIVEN a batcher of at most 10 bytes per message
+	batcher := newSaveBatcher(100, time.Hour, 10, suite.send, suite.logger)
+
+	// WHEN documents exceeding it are added
+	batcher.add("a", json.RawMessage(`{"n":1}`))
+	batcher.add("a", json.RawMessage(`{"n":2}`))
+	suite.Require().NoError(batcher.flush())
+
+	// THEN they are sent in different messages
+	suite.Len(suite.sentBatches("a"), 2)
+}
+
+func (suite *SaveBatcherTestSuite) TestFailuresAreReported() {
+	// GIVEN a mongo writer failing
+	suite.err = errors.New("timeout")
+	batcher := newSaveBatcher(100, time.Hour, 1024, suite.send, suite.logger)
+
+	var failures []SaveFailure
+	batcher.setOnFailure(func(failure SaveFailure) {
+		failures = append(failures, failure)
+	})
+
+	// WHEN a batch is flushed
+	batcher.add("a", json.RawMessage(`{"n":1}`))
+	err := batcher.flush()
+
+	// THEN the failure is returned and given to the callback
+	suite.Error(err)
+	suite.Require().Len(failures, 1)
+	suite.Equal(SaveFailure{Collection: "a", Documents: 1, Err: suite.err}, failures[0])
+}
+
+func (suite *SaveBatcherTestSuite) TestFailuresOfBatchesSentInTheBackgroundAreReturned() {
+	// GIVEN a mongo writer failing, and a batch sent in the background once full
+	suite.err = errors.New("timeout")
+	batcher := newSaveBatcher(1, time.Hour, 1024, suite.send, suite.logger)
+	batcher.setOnFailure(func(SaveFailure) {})
+
+	suite.Require().NoError(batcher.add("a", json.RawMessage(`{"n":1}`)))
+
+	// WHEN the batcher is flushed
+	err := batcher.flush()
+
+	// THEN the failure is returned once
+	suite.ErrorIs(err, suite.err)
+	suite.NoError(batcher.flush())
+}
+
+func (suite *SaveBatcherTestSuite) TestDocumentsAreRejectedOnceClosed() {
+	// GIVEN a batcher with a pending batch and another one being sent
+	batcher := newSaveBatcher(1, time.Hour, 1024, suite.send, suite.logger)
+	suite.Require().NoError(batcher.add("a", json.RawMessage(`{"n":1}`)))
+	suite.Require().NoError(batcher.add("b", json.RawMessage(`{"n":2}`)))
+
+	// WHEN it is closed
+	suite.Require().NoError(batcher.close())
+
+	// THEN every batch was sent, and the documents added afterwards are rejected
+	suite.Len(suite.sentBatches("a"), 1)
+	suite.Len(suite.sentBatches("b"), 1)
+	suite.ErrorIs(batcher.add("a", json.RawMessage(`{"n":3}`)), errSaveBatcherClosed)
+	suite.Len(suite.sentBatches("a"), 1)
+}
+
+func (suite *SaveBatcherTestSuite) TestSavesAreStoredDirectlyByOtherBackends() {
+	// GIVEN a context database with the memory backend and no mongo writer
+	cfg := config.Config{
+		Database:  config.Database{Backend: config.MemoryBackend},
+		SaveBatch: config.Batch{Size: 10, MaxWait: time.Hour},
+		Timeouts:  config.Timeouts{SaveData: time.Second},
+	}
+	db := NewContextDatabase(cfg, nil, docstore.NewMemoryStore(suite.logger), suite.logger)
+
+	// WHEN documents are saved and saved asynchronously
+	suite.Require().NoError(db.Save("results", map[string]interface{}{"asset": "A1"}))
+	suite.Require().NoError(db.SaveAsync("results", map[string]interface{}{"asset": "A2"}))
+	suite.Require().NoError(db.Flush())
+
+	// THEN both are stored in the backend
+	var results []struct {
+		Asset string `bson:"asset"`
+	}
+	suite.Require().NoError(db.Find("results", QueryData{}, &results))
+	suite.Require().Len(results, 2)
+	suite.Equal("A1", results[0].Asset)
+	suite.Equal("A2", results[1].Asset)
+}
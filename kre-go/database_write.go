@@ -0,0 +1,215 @@
+package kre
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// WriteOperationType is the kind of a bulk write operation.
+type WriteOperationType string
+
+const (
+	InsertOperation     WriteOperationType = "insert"
+	UpdateOperation     WriteOperationType = "update"
+	UpsertOperation     WriteOperationType = "upsert"
+	DeleteOneOperation  WriteOperationType = "delete_one"
+	DeleteManyOperation WriteOperationType = "delete_many"
+)
+
+// WriteOperation is an operation of a BulkWrite. Document is only used by inserts, and Update by
+// updates and upserts, which work as Update and Upsert do.
+type WriteOperation struct {
+	Type     WriteOperationType
+	Filter   QueryData
+	Update   QueryData
+	Document interface{}
+}
+
+// WriteResult counts the documents written by an operation.
+type WriteResult struct {
+	Inserted int64
+	Matched  int64
+	Modified int64
+	Upserted int64
+	Deleted  int64
+}
+
+// updateDocument returns the update as given when it uses update operators, e.g. "$inc",
+// or sets the given fields otherwise.
+func updateDocument(update QueryData) bson.M {
+	for key := range update {
+		if strings.HasPrefix(key, "$") {
+			return update.bson()
+		}
+	}
+
+	return bson.M{"$set": update.bson()}
+}
+
+// writeContext bounds a write by the deadline of the given context, or by the
+// KRT_SAVE_DATA_TIMEOUT when it has none.
+func (c *contextDatabase) writeContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return boundContext(ctx, c.cfg.Timeouts.SaveData)
+}
+
+func newUpdateResult(res *mongo.UpdateResult) *WriteResult {
+	return &WriteResult{Matched: res.MatchedCount, Modified: res.ModifiedCount, Upserted: res.UpsertedCount}
+}
+
+// Insert stores the documents in the collection directly in MongoDB, encoding them as BSON, so
+// types like time.Time and primitive.ObjectID are kept, as opposed to Save, which encodes them as
+// JSON. It returns the ids of the inserted documents.
+func (c *contextDatabase) Insert(ctx context.Context, collection string, docs ...interface{}) ([]interface{}, error) {
+	if len(docs) == 0 {
+		return nil, nil
+	}
+
+	ctx, cancel := c.writeContext(ctx)
+	defer cancel()
+
+	ids, err := c.mongoM.InsertMany(ctx, collection, docs)
+	if err != nil {
+		return nil, fmt.Errorf("error inserting documents into collection %q: %w", collection, err)
+	}
+
+	return ids, nil
+}
+
+// Update applies the update to every document matching the filter. The update sets the given
+// fields, unless it uses update operators such as QueryData{"$inc": QueryData{"count": 1}}.
+//
+// Unlike Save, which is queued by the mongo writer, writes are applied to MongoDB before
+// returning, so they are seen by the following queries but may not see documents still queued
+// by Save.
+func (c *contextDatabase) Update(
+	ctx context.Context,
+	collection string,
+	filter, update QueryData,
+) (*WriteResult, error) {
+	ctx, cancel := c.writeContext(ctx)
+	defer cancel()
+
+	res, err := c.mongoM.UpdateMany(ctx, collection, filter.bson(), updateDocument(update), options.Update())
+	if err != nil {
+		return nil, fmt.Errorf("error updating documents of collection %q: %w", collection, err)
+	}
+
+	return newUpdateResult(res), nil
+}
+
+// Upsert applies the update to the first document matching the filter, or inserts a document
+// made of the filter's and the update's fields when none matches.
+func (c *contextDatabase) Upsert(
+	ctx context.Context,
+	collection string,
+	filter, update QueryData,
+) (*WriteResult, error) {
+	ctx, cancel := c.writeContext(ctx)
+	defer cancel()
+
+	res, err := c.mongoM.UpdateOne(ctx, collection, filter.bson(), updateDocument(update), options.Update().SetUpsert(true))
+	if err != nil {
+		return nil, fmt.Errorf("error upserting document of collection %q: %w", collection, err)
+	}
+
+	return newUpdateResult(res), nil
+}
+
+// DeleteOne deletes the first document matching the filter, returning the number of deleted
+// documents.
+func (c *contextDatabase) DeleteOne(ctx context.Context, collection string, filter QueryData) (int64, error) {
+	ctx, cancel := c.writeContext(ctx)
+	defer cancel()
+
+	res, err := c.mongoM.DeleteOne(ctx, collection, filter.bson())
+	if err != nil {
+		return 0, fmt.Errorf("error deleting document of collection %q: %w", collection, err)
+	}
+
+	return res.DeletedCount, nil
+}
+
+// DeleteMany deletes every document matching the filter, returning the number of deleted
+// documents. An empty filter deletes the whole collection.
+func (c *contextDatabase) DeleteMany(ctx context.Context, collection string, filter QueryData) (int64, error) {
+	ctx, cancel := c.writeContext(ctx)
+	defer cancel()
+
+	res, err := c.mongoM.DeleteMany(ctx, collection, filter.bson())
+	if err != nil {
+		return 0, fmt.Errorf("error deleting documents of collection %q: %w", collection, err)
+	}
+
+	return res.DeletedCount, nil
+}
+
+// BulkWrite sends the operations to MongoDB in a single request. Ordered operations are applied
+// in order, stopping at the first failure, while unordered ones are all attempted. The result
+// counts the documents written even when an error is returned.
+func (c *contextDatabase) BulkWrite(
+	ctx context.Context,
+	collection string,
+	operations []WriteOperation,
+	ordered bool,
+) (*WriteResult, error) {
+	models := make([]mongo.WriteModel, 0, len(operations))
+
+	for i, op := range operations {
+		model, err := op.model()
+		if err != nil {
+			return nil, fmt.Errorf("error in bulk write operation %d: %w", i, err)
+		}
+		models = append(models, model)
+	}
+
+	ctx, cancel := c.writeContext(ctx)
+	defer cancel()
+
+	res, err := c.mongoM.BulkWrite(ctx, collection, models, options.BulkWrite().SetOrdered(ordered))
+
+	result := &WriteResult{}
+	if res != nil {
+		result = &WriteResult{
+			Inserted: res.InsertedCount,
+			Matched:  res.MatchedCount,
+			Modified: res.ModifiedCount,
+			Upserted: res.UpsertedCount,
+			Deleted:  res.DeletedCount,
+		}
+	}
+
+	if err != nil {
+		return result, fmt.Errorf("error in bulk write of collection %q: %w", collection, err)
+	}
+
+	return result, nil
+}
+
+func (op WriteOperation) model() (mongo.WriteModel, error) {
+	switch op.Type {
+	case InsertOperation:
+		if op.Document == nil {
+			return nil, errors.New("insert without document")
+		}
+		return mongo.NewInsertOneModel().SetDocument(op.Document), nil
+	case UpdateOperation:
+		return mongo.NewUpdateManyModel().SetFilter(op.Filter.bson()).SetUpdate(updateDocument(op.Update)), nil
+	case UpsertOperation:
+		return mongo.NewUpdateOneModel().
+			SetFilter(op.Filter.bson()).
+			SetUpdate(updateDocument(op.Update)).
+			SetUpsert(true), nil
+	case DeleteOneOperation:
+		return mongo.NewDeleteOneModel().SetFilter(op.Filter.bson()), nil
+	case DeleteManyOperation:
+		return mongo.NewDeleteManyModel().SetFilter(op.Filter.bson()), nil
+	default:
+		return nil, fmt.Errorf("invalid operation type %q", op.Type)
+	}
+}
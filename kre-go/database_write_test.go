@@ -0,0 +1,66 @@
+//go:build unit
+
+package kre
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type DatabaseWriteTestSuite struct {
+	suite.Suite
+}
+
+func TestDatabaseWriteTestSuite(t *testing.T) {
+	suite.Run(t, new(DatabaseWriteTestSuite))
+}
+
+func (suite *DatabaseWriteTestSuite) TestUpdateDocumentSetsFields() {
+	update := updateDocument(QueryData{"result": "ok"})
+
+	suite.Equal(bson.M{"$set": bson.M{"result": "ok"}}, update)
+}
+
+func (suite *DatabaseWriteTestSuite) TestUpdateDocumentKeepsOperators() {
+	update := updateDocument(QueryData{"$inc": QueryData{"count": 1}})
+
+	suite.Equal(bson.M{"$inc": QueryData{"count": 1}}, update)
+}
+
+func (suite *DatabaseWriteTestSuite) TestWriteOperationModels() {
+	// GIVEN an operation of each type
+	operations := []WriteOperation{
+		{Type: InsertOperation, Document: bson.M{"asset": "A1"}},
+		{Type: UpdateOperation, Filter: QueryData{"asset": "A1"}, Update: QueryData{"result": "ok"}},
+		{Type: UpsertOperation, Filter: QueryData{"asset": "A2"}, Update: QueryData{"result": "ok"}},
+		{Type: DeleteOneOperation, Filter: QueryData{"asset": "A3"}},
+		{Type: DeleteManyOperation, Filter: QueryData{"asset": "A4"}},
+	}
+
+	// WHEN they are converted to write models
+	models := make([]mongo.WriteModel, 0, len(operations))
+	for _, op := range operations {
+		model, err := op.model()
+		suite.Require().NoError(err)
+		models = append(models, model)
+	}
+
+	// THEN each one has the matching model
+	suite.IsType(&mongo.InsertOneModel{}, models[0])
+	suite.IsType(&mongo.UpdateManyModel{}, models[1])
+	suite.Require().IsType(&mongo.UpdateOneModel{}, models[2])
+	suite.True(*models[2].(*mongo.UpdateOneModel).Upsert)
+	suite.IsType(&mongo.DeleteOneModel{}, models[3])
+	suite.IsType(&mongo.DeleteManyModel{}, models[4])
+}
+
+func (suite *DatabaseWriteTestSuite) TestInvalidWriteOperations() {
+	_, err := WriteOperation{Type: InsertOperation}.model()
+	suite.Error(err)
+
+	_, err = WriteOperation{Type: "replace"}.model()
+	suite.Error(err)
+}
@@ -0,0 +1,123 @@
+package kre
+
+import (
+	"sync"
+	"time"
+
+	"github.com/konstellation-io/kre/libs/simplelogger"
+	"github.com/nats-io/nats.go"
+)
+
+// deliveryQueue hands the delivered messages to the handler one at a time, in order, while it
+// tells JetStream the ones still waiting are in progress, so a slow handler doesn't get the
+// messages delivered after its own redelivered once their ack wait expires.
+type deliveryQueue struct {
+	processMessage nats.MsgHandler
+	interval       time.Duration
+	logger         *simplelogger.SimpleLogger
+
+	mu      sync.Mutex
+	waiting []*nats.Msg
+	running bool
+	idle    chan struct{}
+}
+
+func newDeliveryQueue(
+	processMessage nats.MsgHandler,
+	interval time.Duration,
+	logger *simplelogger.SimpleLogger,
+) *deliveryQueue {
+	return &deliveryQueue{
+		processMessage: processMessage,
+		interval:       interval,
+		logger:         logger,
+	}
+}
+
+// deliver queues the messages without waiting for them to be handled.
+func (q *deliveryQueue) deliver(msgs ...*nats.Msg) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.waiting = append(q.waiting, msgs...)
+
+	if !q.running && len(q.waiting) > 0 {
+		q.running = true
+		q.idle = make(chan struct{})
+		go q.run(q.idle)
+	}
+}
+
+// wait blocks until every queued message has been handled.
+func (q *deliveryQueue) wait() {
+	q.mu.Lock()
+	if !q.running {
+		q.mu.Unlock()
+		return
+	}
+	idle := q.idle
+	q.mu.Unlock()
+
+	<-idle
+}
+
+// run handles the queued messages until none is left.
+func (q *deliveryQueue) run(idle chan struct{}) {
+	defer close(idle)
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	go q.keepWaitingInProgress(stop)
+
+	for {
+		msg, ok := q.next()
+		if !ok {
+			return
+		}
+
+		q.processMessage(msg)
+	}
+}
+
+func (q *deliveryQueue) next() (*nats.Msg, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.waiting) == 0 {
+		q.running = false
+		return nil, false
+	}
+
+	msg := q.waiting[0]
+	q.waiting[0] = nil
+	q.waiting = q.waiting[1:]
+
+	return msg, true
+}
+
+func (q *deliveryQueue) keepWaitingInProgress(stop chan struct{}) {
+	if q.interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(q.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			q.mu.Lock()
+			waiting := append([]*nats.Msg(nil), q.waiting...)
+			q.mu.Unlock()
+
+			for _, msg := range waiting {
+				if err := msg.InProgress(); err != nil {
+					q.logger.Errorf("Error sending in progress ack: %s", err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,62 @@
+//go:build unit
+
+package kre
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/konstellation-io/kre/libs/simplelogger"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/suite"
+)
+
+type DeliveryQueueTestSuite struct {
+	suite.Suite
+	logger *simplelogger.SimpleLogger
+}
+
+func TestDeliveryQueueTestSuite(t *testing.T) {
+	suite.Run(t, new(DeliveryQueueTestSuite))
+}
+
+func (suite *DeliveryQueueTestSuite) SetupTest() {
+	suite.logger = simplelogger.New(simplelogger.LevelInfo)
+}
+
+func (suite *DeliveryQueueTestSuite) TestMessagesAreHandledInOrder() {
+	// GIVEN a queue whose handler blocks until released
+	var (
+		mu      sync.Mutex
+		handled []string
+	)
+	release := make(chan struct{})
+
+	queue := newDeliveryQueue(func(msg *nats.Msg) {
+		<-release
+		mu.Lock()
+		handled = append(handled, msg.Subject)
+		mu.Unlock()
+	}, time.Millisecond, suite.logger)
+
+	// WHEN messages are delivered while the first one is being handled
+	queue.deliver(&nats.Msg{Subject: "a"})
+	queue.deliver(&nats.Msg{Subject: "b"}, &nats.Msg{Subject: "c"})
+
+	// THEN delivering doesn't wait for the handler
+	time.Sleep(10 * time.Millisecond)
+	mu.Lock()
+	suite.Empty(handled)
+	mu.Unlock()
+
+	// THEN they are handled one at a time in order once released
+	close(release)
+	queue.wait()
+	suite.Equal([]string{"a", "b", "c"}, handled)
+
+	// THEN the queue handles the messages delivered afterwards
+	queue.deliver(&nats.Msg{Subject: "d"})
+	queue.wait()
+	suite.Equal([]string{"a", "b", "c", "d"}, handled)
+}
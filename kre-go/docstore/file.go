@@ -0,0 +1,165 @@
+package docstore
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/konstellation-io/kre/libs/simplelogger"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const fileCollectionExt = ".bson"
+
+// NewFileStore returns a Store keeping the documents in a BSON file per collection in the given
+// directory, so they survive the restarts of local runs. Collections are read on connection and
+// rewritten on every write, so they are meant to be small, and the directory must not be shared
+// by several runners.
+func NewFileStore(logger *simplelogger.SimpleLogger, dir string) *Store {
+	return &Store{
+		logger:  logger,
+		storage: &fileStorage{memoryStorage: newMemoryStorage(), dir: dir},
+	}
+}
+
+// fileStorage keeps the documents in memory, writing the collection to its file after every
+// change. Files are replaced atomically, so a crash never leaves a collection half written.
+type fileStorage struct {
+	*memoryStorage
+	dir string
+}
+
+func (f *fileStorage) open() error {
+	err := os.MkdirAll(f.dir, 0o755)
+	if err != nil {
+		return fmt.Errorf("error creating the documents directory: %w", err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(f.dir, "*"+fileCollectionExt))
+	if err != nil {
+		return err
+	}
+
+	f.memoryStorage = newMemoryStorage()
+
+	for _, file := range files {
+		collection, err := url.PathUnescape(strings.TrimSuffix(filepath.Base(file), fileCollectionExt))
+		if err != nil {
+			return fmt.Errorf("invalid collection file %q: %w", file, err)
+		}
+
+		err = f.load(collection, file)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// load reads the collection's documents, stored one after another as BSON documents.
+func (f *fileStorage) load(collection, file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("error reading collection %q: %w", collection, err)
+	}
+
+	for len(data) > 0 {
+		if len(data) < 4 {
+			return fmt.Errorf("error reading collection %q: truncated document", collection)
+		}
+
+		size := int(binary.LittleEndian.Uint32(data))
+		if size < 5 || size > len(data) {
+			return fmt.Errorf("error reading collection %q: truncated document", collection)
+		}
+
+		doc := bson.M{}
+
+		err = bson.Unmarshal(data[:size], &doc)
+		if err != nil {
+			return fmt.Errorf("error reading collection %q: %w", collection, err)
+		}
+
+		err = f.memoryStorage.create(collection, doc)
+		if err != nil {
+			return fmt.Errorf("error reading collection %q: %w", collection, err)
+		}
+
+		data = data[size:]
+	}
+
+	return nil
+}
+
+func (f *fileStorage) create(collection string, doc bson.M) error {
+	err := f.memoryStorage.create(collection, doc)
+	if err != nil {
+		return err
+	}
+
+	return f.persist(collection)
+}
+
+func (f *fileStorage) update(collection string, doc bson.M, revision uint64) error {
+	err := f.memoryStorage.update(collection, doc, revision)
+	if err != nil {
+		return err
+	}
+
+	return f.persist(collection)
+}
+
+func (f *fileStorage) remove(collection string, doc bson.M, revision uint64) error {
+	err := f.memoryStorage.remove(collection, doc, revision)
+	if err != nil {
+		return err
+	}
+
+	return f.persist(collection)
+}
+
+// persist writes the collection to a temporary file that then replaces the collection's file.
+func (f *fileStorage) persist(collection string) error {
+	docs, err := f.memoryStorage.all(collection)
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+
+	for _, stored := range docs {
+		data, err = bson.MarshalAppend(data, stored.doc)
+		if err != nil {
+			return fmt.Errorf("error encoding document %v: %w", stored.doc["_id"], err)
+		}
+	}
+
+	file := filepath.Join(f.dir, url.PathEscape(collection)+fileCollectionExt)
+
+	tmp, err := os.CreateTemp(f.dir, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("error writing collection %q: %w", collection, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), file)
+	}
+
+	if err != nil {
+		return fmt.Errorf("error writing collection %q: %w", collection, err)
+	}
+
+	return nil
+}
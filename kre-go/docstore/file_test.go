@@ -0,0 +1,42 @@
+//go:build unit
+
+package docstore
+
+import (
+	"context"
+	"testing"
+
+	"github.com/konstellation-io/kre/libs/simplelogger"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestFileStoreKeepsDocumentsAcrossConnections(t *testing.T) {
+	ctx := context.Background()
+	logger := simplelogger.New(simplelogger.LevelInfo)
+	dir := t.TempDir()
+
+	// GIVEN documents written, updated and deleted through a file store that is then disconnected
+	store := NewFileStore(logger, dir)
+	require.NoError(t, store.Connect())
+
+	_, err := store.InsertMany(ctx, "plant/assets", []interface{}{
+		asset{ID: "a1", Name: "pump", Score: 7},
+		asset{ID: "a2", Name: "valve", Score: 3},
+	})
+	require.NoError(t, err)
+	_, err = store.UpdateOne(ctx, "plant/assets", bson.M{"_id": "a1"}, bson.M{"$inc": bson.M{"score": 1}}, nil)
+	require.NoError(t, err)
+	_, err = store.DeleteOne(ctx, "plant/assets", bson.M{"_id": "a2"})
+	require.NoError(t, err)
+	require.NoError(t, store.Disconnect())
+
+	// WHEN another file store connects to the same directory
+	reopened := NewFileStore(logger, dir)
+	require.NoError(t, reopened.Connect())
+
+	// THEN it finds the documents as they were left
+	var results []asset
+	require.NoError(t, reopened.Find(ctx, "plant/assets", bson.M{}, &results))
+	require.Equal(t, []asset{{ID: "a1", Name: "pump", Score: 8}}, results)
+}
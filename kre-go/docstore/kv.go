@@ -0,0 +1,157 @@
+package docstore
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/konstellation-io/kre/libs/simplelogger"
+	"github.com/nats-io/nats.go"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// validCollectionName are the collection names usable as a prefix of the key-value store keys.
+var validCollectionName = regexp.MustCompile(`\A[-_=a-zA-Z0-9]+\z`)
+
+// NewKVStore returns a Store keeping the documents in the given JetStream key-value store, created
+// on Connect when missing, under the "<collection>.<id hash>" keys.
+func NewKVStore(logger *simplelogger.SimpleLogger, js nats.JetStreamContext, bucket string) *Store {
+	return &Store{
+		logger:  logger,
+		storage: &kvStorage{js: js, bucket: bucket},
+	}
+}
+
+type kvStorage struct {
+	js     nats.JetStreamContext
+	bucket string
+	kv     nats.KeyValue
+}
+
+func (k *kvStorage) open() error {
+	kvStore, err := k.js.KeyValue(k.bucket)
+	if errors.Is(err, nats.ErrBucketNotFound) {
+		kvStore, err = k.js.CreateKeyValue(&nats.KeyValueConfig{
+			Bucket:  k.bucket,
+			Storage: nats.FileStorage,
+		})
+	}
+
+	if err != nil {
+		return fmt.Errorf("error opening documents key-value store %q: %w", k.bucket, err)
+	}
+
+	k.kv = kvStore
+
+	return nil
+}
+
+func (k *kvStorage) close() error {
+	return nil
+}
+
+func (k *kvStorage) key(collection string, doc bson.M) (string, error) {
+	if !validCollectionName.MatchString(collection) {
+		return "", fmt.Errorf("invalid collection name %q for the key-value document store", collection)
+	}
+
+	id, err := documentKey(doc)
+	if err != nil {
+		return "", err
+	}
+
+	return collection + "." + id, nil
+}
+
+// all reads the documents of the collection watching its keys until the current values are
+// received.
+func (k *kvStorage) all(collection string) ([]storedDocument, error) {
+	if !validCollectionName.MatchString(collection) {
+		return nil, fmt.Errorf("invalid collection name %q for the key-value document store", collection)
+	}
+
+	watcher, err := k.kv.Watch(collection + ".*")
+	if err != nil {
+		return nil, fmt.Errorf("error reading collection %q: %w", collection, err)
+	}
+	defer func() { _ = watcher.Stop() }()
+
+	var docs []storedDocument
+
+	// a nil entry marks the end of the current values
+	for entry := range watcher.Updates() {
+		if entry == nil {
+			break
+		}
+
+		if entry.Operation() != nats.KeyValuePut {
+			continue
+		}
+
+		doc := bson.M{}
+		if err := bson.Unmarshal(entry.Value(), &doc); err != nil {
+			return nil, fmt.Errorf("error decoding document %q: %w", entry.Key(), err)
+		}
+
+		docs = append(docs, storedDocument{doc, entry.Revision()})
+	}
+
+	return docs, nil
+}
+
+func (k *kvStorage) encode(collection string, doc bson.M) (string, []byte, error) {
+	key, err := k.key(collection, doc)
+	if err != nil {
+		return "", nil, err
+	}
+
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		return "", nil, fmt.Errorf("error encoding document %v: %w", doc["_id"], err)
+	}
+
+	return key, data, nil
+}
+
+func (k *kvStorage) create(collection string, doc bson.M) error {
+	key, data, err := k.encode(collection, doc)
+	if err != nil {
+		return err
+	}
+
+	_, err = k.kv.Create(key, data)
+	if errors.Is(err, nats.ErrKeyExists) {
+		return errDuplicateKey
+	}
+
+	return err
+}
+
+func (k *kvStorage) update(collection string, doc bson.M, revision uint64) error {
+	key, data, err := k.encode(collection, doc)
+	if err != nil {
+		return err
+	}
+
+	_, err = k.kv.Update(key, data, revision)
+	if errors.Is(err, nats.ErrKeyExists) {
+		return errConflict
+	}
+
+	return err
+}
+
+func (k *kvStorage) remove(collection string, doc bson.M, revision uint64) error {
+	key, err := k.key(collection, doc)
+	if err != nil {
+		return err
+	}
+
+	// a delete with a stale revision fails with the same error code as an update
+	err = k.kv.Delete(key, nats.LastRevision(revision))
+	if errors.Is(err, nats.ErrKeyExists) {
+		return errConflict
+	}
+
+	return err
+}
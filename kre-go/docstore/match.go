@@ -0,0 +1,540 @@
+package docstore
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// normalize converts the given document, filter or update to a bson.M holding only BSON types,
+// as MongoDB would store it.
+func normalize(v interface{}) (bson.M, error) {
+	if v == nil {
+		return bson.M{}, nil
+	}
+
+	data, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := bson.M{}
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
+
+// asDocument returns the value as a bson.M when it is an embedded document.
+func asDocument(v interface{}) (bson.M, bool) {
+	switch doc := v.(type) {
+	case bson.M:
+		return doc, true
+	case map[string]interface{}:
+		return doc, true
+	case bson.D:
+		return doc.Map(), true
+	default:
+		return nil, false
+	}
+}
+
+func asArray(v interface{}) ([]interface{}, bool) {
+	switch arr := v.(type) {
+	case bson.A:
+		return arr, true
+	case []interface{}:
+		return arr, true
+	default:
+		return nil, false
+	}
+}
+
+// lookup returns the value at the dotted path of the document.
+func lookup(doc bson.M, path string) (interface{}, bool) {
+	head, rest, nested := strings.Cut(path, ".")
+
+	value, ok := doc[head]
+	if !ok || !nested {
+		return value, ok
+	}
+
+	embedded, ok := asDocument(value)
+	if !ok {
+		return nil, false
+	}
+
+	return lookup(embedded, rest)
+}
+
+// set sets the value at the dotted path of the document, creating the embedded documents.
+func set(doc bson.M, path string, value interface{}) {
+	head, rest, nested := strings.Cut(path, ".")
+	if !nested {
+		doc[head] = value
+		return
+	}
+
+	embedded, ok := asDocument(doc[head])
+	if !ok {
+		embedded = bson.M{}
+	}
+	set(embedded, rest, value)
+	doc[head] = embedded
+}
+
+func unset(doc bson.M, path string) {
+	head, rest, nested := strings.Cut(path, ".")
+	if !nested {
+		delete(doc, head)
+		return
+	}
+
+	if embedded, ok := asDocument(doc[head]); ok {
+		unset(embedded, rest)
+	}
+}
+
+// orderable returns a value of a kind that can be ordered: float64, string, time.Time or bool.
+func orderable(v interface{}) interface{} {
+	switch n := v.(type) {
+	case int:
+		return float64(n)
+	case int32:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case float32:
+		return float64(n)
+	case primitive.DateTime:
+		return n.Time()
+	case primitive.ObjectID:
+		return n.Hex()
+	default:
+		return v
+	}
+}
+
+// compare orders a and b, returning false when they are of different kinds.
+func compare(a, b interface{}) (int, bool) {
+	a, b = orderable(a), orderable(b)
+
+	switch x := a.(type) {
+	case float64:
+		if y, ok := b.(float64); ok {
+			switch {
+			case x < y:
+				return -1, true
+			case x > y:
+				return 1, true
+			default:
+				return 0, true
+			}
+		}
+	case string:
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y), true
+		}
+	case time.Time:
+		if y, ok := b.(time.Time); ok {
+			switch {
+			case x.Before(y):
+				return -1, true
+			case x.After(y):
+				return 1, true
+			default:
+				return 0, true
+			}
+		}
+	case bool:
+		if y, ok := b.(bool); ok {
+			switch {
+			case x == y:
+				return 0, true
+			case !x:
+				return -1, true
+			default:
+				return 1, true
+			}
+		}
+	}
+
+	return 0, false
+}
+
+func equal(a, b interface{}) bool {
+	if c, ok := compare(a, b); ok {
+		return c == 0
+	}
+
+	return reflect.DeepEqual(a, b)
+}
+
+// matches reports whether the document matches the filter, supporting $and, $or, $nor and the
+// comparison operators of matchesOperator.
+func matches(doc, filter bson.M) (bool, error) {
+	for key, condition := range filter {
+		var ok bool
+		var err error
+
+		switch key {
+		case "$and", "$or", "$nor":
+			ok, err = matchesLogical(doc, key, condition)
+		default:
+			if strings.HasPrefix(key, "$") {
+				return false, fmt.Errorf("unsupported query operator %q", key)
+			}
+			ok, err = matchesField(doc, key, condition)
+		}
+
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+func matchesLogical(doc bson.M, operator string, condition interface{}) (bool, error) {
+	filters, ok := asArray(condition)
+	if !ok {
+		return false, fmt.Errorf("%s must be an array", operator)
+	}
+
+	for _, f := range filters {
+		filter, ok := asDocument(f)
+		if !ok {
+			return false, fmt.Errorf("%s must be an array of documents", operator)
+		}
+
+		ok, err := matches(doc, filter)
+		if err != nil {
+			return false, err
+		}
+
+		switch {
+		case operator == "$and" && !ok:
+			return false, nil
+		case operator == "$or" && ok:
+			return true, nil
+		case operator == "$nor" && ok:
+			return false, nil
+		}
+	}
+
+	return operator != "$or", nil
+}
+
+func isOperatorDocument(condition interface{}) (bson.M, bool) {
+	operators, ok := asDocument(condition)
+	if !ok || len(operators) == 0 {
+		return nil, false
+	}
+
+	for key := range operators {
+		if !strings.HasPrefix(key, "$") {
+			return nil, false
+		}
+	}
+
+	return operators, true
+}
+
+func matchesField(doc bson.M, path string, condition interface{}) (bool, error) {
+	value, exists := lookup(doc, path)
+
+	operators, ok := isOperatorDocument(condition)
+	if !ok {
+		return exists && matchesValue(value, condition), nil
+	}
+
+	for operator, operand := range operators {
+		ok, err := matchesOperator(value, exists, operator, operand)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// matchesValue compares the field's value, or any of its elements when it is an array.
+func matchesValue(value, expected interface{}) bool {
+	if equal(value, expected) {
+		return true
+	}
+
+	if values, ok := asArray(value); ok {
+		for _, element := range values {
+			if equal(element, expected) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func matchesOrdered(value, operand interface{}, accept func(int) bool) bool {
+	values, ok := asArray(value)
+	if !ok {
+		values = []interface{}{value}
+	}
+
+	for _, element := range values {
+		if c, ok := compare(element, operand); ok && accept(c) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchesOperator(value interface{}, exists bool, operator string, operand interface{}) (bool, error) {
+	switch operator {
+	case "$eq":
+		return exists && matchesValue(value, operand), nil
+	case "$ne":
+		return !exists || !matchesValue(value, operand), nil
+	case "$gt":
+		return exists && matchesOrdered(value, operand, func(c int) bool { return c > 0 }), nil
+	case "$gte":
+		return exists && matchesOrdered(value, operand, func(c int) bool { return c >= 0 }), nil
+	case "$lt":
+		return exists && matchesOrdered(value, operand, func(c int) bool { return c < 0 }), nil
+	case "$lte":
+		return exists && matchesOrdered(value, operand, func(c int) bool { return c <= 0 }), nil
+	case "$in", "$nin":
+		candidates, ok := asArray(operand)
+		if !ok {
+			return false, fmt.Errorf("%s must be an array", operator)
+		}
+
+		found := false
+		for _, candidate := range candidates {
+			if exists && matchesValue(value, candidate) {
+				found = true
+				break
+			}
+		}
+
+		return found == (operator == "$in"), nil
+	case "$exists":
+		want, _ := operand.(bool)
+		return exists == want, nil
+	case "$regex":
+		pattern, ok := operand.(string)
+		if !ok {
+			if re, isRegex := operand.(primitive.Regex); isRegex {
+				pattern, ok = re.Pattern, true
+			}
+		}
+		if !ok {
+			return false, fmt.Errorf("$regex must be a string")
+		}
+
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return false, fmt.Errorf("invalid $regex: %w", err)
+		}
+
+		s, isString := value.(string)
+
+		return exists && isString && re.MatchString(s), nil
+	default:
+		return false, fmt.Errorf("unsupported query operator %q", operator)
+	}
+}
+
+type sortKey struct {
+	field string
+	order int
+}
+
+// sortKeys reads the sort specification given as a bson.D, or a bson.M for a single key.
+func sortKeys(spec interface{}) ([]sortKey, error) {
+	var elements bson.D
+
+	switch s := spec.(type) {
+	case nil:
+		return nil, nil
+	case bson.D:
+		elements = s
+	case bson.M:
+		if len(s) > 1 {
+			return nil, fmt.Errorf("sorting by several keys requires an ordered document")
+		}
+		for k, v := range s {
+			elements = append(elements, bson.E{Key: k, Value: v})
+		}
+	default:
+		return nil, fmt.Errorf("unsupported sort specification %T", spec)
+	}
+
+	keys := make([]sortKey, 0, len(elements))
+	for _, e := range elements {
+		order, ok := orderable(e.Value).(float64)
+		if !ok || (order != 1 && order != -1) {
+			return nil, fmt.Errorf("invalid sort order %v of key %q", e.Value, e.Key)
+		}
+		keys = append(keys, sortKey{field: e.Key, order: int(order)})
+	}
+
+	return keys, nil
+}
+
+// sortDocuments sorts the documents by the keys, placing the missing fields first as MongoDB does.
+func sortDocuments(docs []bson.M, keys []sortKey) {
+	if len(keys) == 0 {
+		return
+	}
+
+	sort.SliceStable(docs, func(i, j int) bool {
+		for _, key := range keys {
+			a, aok := lookup(docs[i], key.field)
+			b, bok := lookup(docs[j], key.field)
+
+			c := 0
+			switch {
+			case !aok && bok:
+				c = -1
+			case aok && !bok:
+				c = 1
+			case aok && bok:
+				c, _ = compare(a, b)
+			}
+
+			if c != 0 {
+				return c*key.order < 0
+			}
+		}
+
+		return false
+	})
+}
+
+// project keeps the included fields, and always the _id unless excluded, or removes the excluded
+// ones.
+func project(doc bson.M, projection bson.M) bson.M {
+	if len(projection) == 0 {
+		return doc
+	}
+
+	inclusive := false
+	for field, v := range projection {
+		if field != "_id" && isTruthy(v) {
+			inclusive = true
+		}
+	}
+
+	projected := bson.M{}
+
+	if inclusive {
+		for field, v := range projection {
+			if isTruthy(v) {
+				if value, ok := lookup(doc, field); ok {
+					set(projected, field, value)
+				}
+			}
+		}
+		if v, ok := projection["_id"]; !ok || isTruthy(v) {
+			if id, ok := doc["_id"]; ok {
+				projected["_id"] = id
+			}
+		}
+
+		return projected
+	}
+
+	for field, value := range doc {
+		projected[field] = value
+	}
+	for field := range projection {
+		unset(projected, field)
+	}
+
+	return projected
+}
+
+func isTruthy(v interface{}) bool {
+	switch n := orderable(v).(type) {
+	case float64:
+		return n != 0
+	case bool:
+		return n
+	default:
+		return v != nil
+	}
+}
+
+// applyUpdate applies the $set, $unset and $inc operators of the update to the document.
+func applyUpdate(doc, update bson.M) error {
+	for operator, fields := range update {
+		values, ok := asDocument(fields)
+		if !ok {
+			return fmt.Errorf("%s must be a document", operator)
+		}
+
+		for field, value := range values {
+			if field == "_id" {
+				return fmt.Errorf("the _id field can't be updated")
+			}
+
+			switch operator {
+			case "$set":
+				set(doc, field, value)
+			case "$unset":
+				unset(doc, field)
+			case "$inc":
+				current, _ := lookup(doc, field)
+				sum, err := increment(current, value)
+				if err != nil {
+					return fmt.Errorf("error incrementing %q: %w", field, err)
+				}
+				set(doc, field, sum)
+			default:
+				return fmt.Errorf("unsupported update operator %q", operator)
+			}
+		}
+	}
+
+	return nil
+}
+
+func increment(current, delta interface{}) (interface{}, error) {
+	if current == nil {
+		return delta, nil
+	}
+
+	switch c := current.(type) {
+	case int32:
+		switch d := delta.(type) {
+		case int32:
+			return c + d, nil
+		case int64:
+			return int64(c) + d, nil
+		}
+	case int64:
+		switch d := delta.(type) {
+		case int32:
+			return c + int64(d), nil
+		case int64:
+			return c + d, nil
+		}
+	}
+
+	a, aok := orderable(current).(float64)
+	b, bok := orderable(delta).(float64)
+	if !aok || !bok {
+		return nil, fmt.Errorf("non numeric values")
+	}
+
+	return a + b, nil
+}
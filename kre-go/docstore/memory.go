@@ -0,0 +1,146 @@
+package docstore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/konstellation-io/kre/libs/simplelogger"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// NewMemoryStore returns a Store keeping the documents in memory, meant for tests. Documents aren't
+// persisted, so they are lost when the runner stops, and aren't shared with the node's other
+// replicas. Local runs keeping their documents use NewFileStore instead.
+func NewMemoryStore(logger *simplelogger.SimpleLogger) *Store {
+	return &Store{
+		logger:  logger,
+		storage: newMemoryStorage(),
+	}
+}
+
+func newMemoryStorage() *memoryStorage {
+	return &memoryStorage{collections: make(map[string]*memoryCollection)}
+}
+
+// documentKey identifies the document by its _id, whatever its type.
+func documentKey(doc bson.M) (string, error) {
+	id, ok := doc["_id"]
+	if !ok {
+		return "", fmt.Errorf("document without _id")
+	}
+
+	data, err := bson.Marshal(bson.M{"_id": id})
+	if err != nil {
+		return "", fmt.Errorf("error marshaling _id %v: %w", id, err)
+	}
+
+	hash := sha256.Sum256(data)
+
+	return hex.EncodeToString(hash[:16]), nil
+}
+
+type memoryStorage struct {
+	collections map[string]*memoryCollection
+	revision    uint64
+}
+
+// memoryCollection keeps the documents in insertion order, as MongoDB usually returns them.
+type memoryCollection struct {
+	keys []string
+	docs map[string]storedDocument
+}
+
+func (m *memoryStorage) open() error {
+	return nil
+}
+
+func (m *memoryStorage) close() error {
+	return nil
+}
+
+func (m *memoryStorage) all(collection string) ([]storedDocument, error) {
+	col, ok := m.collections[collection]
+	if !ok {
+		return nil, nil
+	}
+
+	docs := make([]storedDocument, 0, len(col.keys))
+	for _, key := range col.keys {
+		docs = append(docs, col.docs[key])
+	}
+
+	return docs, nil
+}
+
+func (m *memoryStorage) create(collection string, doc bson.M) error {
+	key, err := documentKey(doc)
+	if err != nil {
+		return err
+	}
+
+	col, ok := m.collections[collection]
+	if !ok {
+		col = &memoryCollection{docs: make(map[string]storedDocument)}
+		m.collections[collection] = col
+	}
+
+	if _, exists := col.docs[key]; exists {
+		return errDuplicateKey
+	}
+
+	m.revision++
+	col.keys = append(col.keys, key)
+	col.docs[key] = storedDocument{doc, m.revision}
+
+	return nil
+}
+
+func (m *memoryStorage) update(collection string, doc bson.M, revision uint64) error {
+	col, key, err := m.stored(collection, doc, revision)
+	if err != nil {
+		return err
+	}
+
+	m.revision++
+	col.docs[key] = storedDocument{doc, m.revision}
+
+	return nil
+}
+
+func (m *memoryStorage) remove(collection string, doc bson.M, revision uint64) error {
+	col, key, err := m.stored(collection, doc, revision)
+	if err != nil {
+		return err
+	}
+
+	delete(col.docs, key)
+	for i, k := range col.keys {
+		if k == key {
+			col.keys = append(col.keys[:i], col.keys[i+1:]...)
+			break
+		}
+	}
+
+	return nil
+}
+
+// stored returns the collection and key of the document, failing when the stored document
+// changed since the given revision.
+func (m *memoryStorage) stored(collection string, doc bson.M, revision uint64) (*memoryCollection, string, error) {
+	key, err := documentKey(doc)
+	if err != nil {
+		return nil, "", err
+	}
+
+	col, ok := m.collections[collection]
+	if !ok {
+		return nil, "", errConflict
+	}
+
+	if stored, exists := col.docs[key]; !exists || stored.revision != revision {
+		return nil, "", errConflict
+	}
+
+	return col, key, nil
+}
@@ -0,0 +1,725 @@
+// Package docstore implements the mongodb.Manager used by the handler context database with
+// documents kept in files for local runs, in memory for tests, or in a JetStream key-value store,
+// without a MongoDB.
+//
+// Queries support the equality and comparison filters ($eq, $ne, $gt, $gte, $lt, $lte, $in,
+// $nin, $exists, $regex, $and, $or and $nor), sort, skip, limit and projection, the $set, $unset
+// and $inc update operators, and the $match, $sort, $skip, $limit, $project and $count
+// aggregation stages. Indexes are not enforced.
+package docstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/konstellation-io/kre/libs/simplelogger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/konstellation-io/kre-runners/kre-go/v4/mongodb"
+)
+
+// storage keeps the documents of each collection along with a revision changing on every write,
+// so writes based on a document that changed since it was read fail.
+type storage interface {
+	open() error
+	close() error
+	all(collection string) ([]storedDocument, error)
+	// create stores a new document, failing with errDuplicateKey when its _id is already stored.
+	create(collection string, doc bson.M) error
+	// update replaces the document stored with the given revision, failing with errConflict when
+	// the stored one changed since.
+	update(collection string, doc bson.M, revision uint64) error
+	// remove deletes the document stored with the given revision, failing with errConflict when
+	// the stored one changed since.
+	remove(collection string, doc bson.M, revision uint64) error
+}
+
+type storedDocument struct {
+	doc      bson.M
+	revision uint64
+}
+
+var (
+	errDuplicateKey = errors.New("duplicate key error")
+	errConflict     = errors.New("document changed by another replica")
+)
+
+// Store is a document store applying the queries to every document of the collection, so it is
+// meant for small collections. Operations are serialized, but aren't atomic across replicas
+// sharing a key-value store, so writes to documents changed meanwhile by another replica fail.
+type Store struct {
+	logger  *simplelogger.SimpleLogger
+	storage storage
+	mu      sync.Mutex
+}
+
+var _ mongodb.Manager = (*Store)(nil)
+
+func (s *Store) Connect() error {
+	return s.storage.open()
+}
+
+func (s *Store) Disconnect() error {
+	return s.storage.close()
+}
+
+// Ping always succeeds, as the documents are kept by the runner or its NATS connection.
+func (s *Store) Ping(_ context.Context) error {
+	return nil
+}
+
+// query returns the documents of the collection matching the filter, sorted, paginated and
+// projected as given.
+func (s *Store) query(colName string, filter bson.M, opts *options.FindOptions) ([]bson.M, error) {
+	stored, err := s.find(colName, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	matching := make([]bson.M, 0, len(stored))
+	for _, doc := range stored {
+		matching = append(matching, doc.doc)
+	}
+
+	if opts == nil {
+		return matching, nil
+	}
+
+	keys, err := sortKeys(opts.Sort)
+	if err != nil {
+		return nil, err
+	}
+	sortDocuments(matching, keys)
+
+	if opts.Skip != nil {
+		matching = paginate(matching, *opts.Skip, 0)
+	}
+	if opts.Limit != nil {
+		matching = paginate(matching, 0, *opts.Limit)
+	}
+
+	if opts.Projection != nil {
+		projection, err := normalize(opts.Projection)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, doc := range matching {
+			matching[i] = project(doc, projection)
+		}
+	}
+
+	return matching, nil
+}
+
+// find returns the stored documents of the collection matching the filter.
+func (s *Store) find(colName string, filter bson.M) ([]storedDocument, error) {
+	normalizedFilter, err := normalize(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	docs, err := s.storage.all(colName)
+	if err != nil {
+		return nil, err
+	}
+
+	matching := make([]storedDocument, 0, len(docs))
+	for _, doc := range docs {
+		ok, err := matches(doc.doc, normalizedFilter)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matching = append(matching, doc)
+		}
+	}
+
+	return matching, nil
+}
+
+func paginate(docs []bson.M, skip, limit int64) []bson.M {
+	if skip > int64(len(docs)) {
+		skip = int64(len(docs))
+	}
+	docs = docs[skip:]
+
+	if limit > 0 && limit < int64(len(docs)) {
+		docs = docs[:limit]
+	}
+
+	return docs
+}
+
+// decodeAll decodes the documents into results, a pointer to a slice.
+func decodeAll(docs []bson.M, results interface{}) error {
+	values := make(bson.A, 0, len(docs))
+	for _, doc := range docs {
+		values = append(values, doc)
+	}
+
+	data, err := bson.Marshal(bson.M{"docs": values})
+	if err != nil {
+		return err
+	}
+
+	return bson.Raw(data).Lookup("docs").Unmarshal(results)
+}
+
+func decode(doc bson.M, result interface{}) error {
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	return bson.Unmarshal(data, result)
+}
+
+func (s *Store) Find(ctx context.Context, colName string, filter bson.M, results interface{}) error {
+	return s.FindWithOptions(ctx, colName, filter, nil, results)
+}
+
+func (s *Store) FindWithOptions(
+	_ context.Context,
+	colName string,
+	filter bson.M,
+	opts *options.FindOptions,
+	results interface{},
+) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	docs, err := s.query(colName, filter, opts)
+	if err != nil {
+		return err
+	}
+
+	return decodeAll(docs, results)
+}
+
+func (s *Store) FindOne(
+	_ context.Context,
+	colName string,
+	filter bson.M,
+	opts *options.FindOneOptions,
+	result interface{},
+) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	findOpts := options.Find().SetLimit(1)
+	if opts != nil {
+		findOpts.Sort = opts.Sort
+		findOpts.Skip = opts.Skip
+		findOpts.Projection = opts.Projection
+	}
+
+	docs, err := s.query(colName, filter, findOpts)
+	if err != nil {
+		return err
+	}
+
+	if len(docs) == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return decode(docs[0], result)
+}
+
+func (s *Store) Cursor(
+	_ context.Context,
+	colName string,
+	filter bson.M,
+	opts *options.FindOptions,
+) (mongodb.Cursor, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	docs, err := s.query(colName, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cursor{docs: docs, position: -1}, nil
+}
+
+func (s *Store) Count(_ context.Context, colName string, filter bson.M) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	docs, err := s.query(colName, filter, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(len(docs)), nil
+}
+
+func (s *Store) Distinct(_ context.Context, colName, field string, filter bson.M) ([]interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	docs, err := s.query(colName, filter, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	values := []interface{}{}
+	addValue := func(value interface{}) {
+		for _, v := range values {
+			if equal(v, value) {
+				return
+			}
+		}
+		values = append(values, value)
+	}
+
+	for _, doc := range docs {
+		value, ok := lookup(doc, field)
+		if !ok {
+			continue
+		}
+
+		if elements, isArray := asArray(value); isArray {
+			for _, element := range elements {
+				addValue(element)
+			}
+			continue
+		}
+
+		addValue(value)
+	}
+
+	return values, nil
+}
+
+func (s *Store) Aggregate(_ context.Context, colName string, pipeline []bson.M, results interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	docs, err := s.query(colName, bson.M{}, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, stage := range pipeline {
+		docs, err = aggregateStage(docs, stage)
+		if err != nil {
+			return err
+		}
+	}
+
+	return decodeAll(docs, results)
+}
+
+func aggregateStage(docs []bson.M, stage bson.M) ([]bson.M, error) {
+	if len(stage) != 1 {
+		return nil, fmt.Errorf("an aggregation stage must have a single operator")
+	}
+
+	for operator, spec := range stage {
+		switch operator {
+		case "$match", "$project":
+			arg, err := normalize(spec)
+			if err != nil {
+				return nil, err
+			}
+
+			result := make([]bson.M, 0, len(docs))
+			for _, doc := range docs {
+				if operator == "$project" {
+					result = append(result, project(doc, arg))
+					continue
+				}
+
+				ok, err := matches(doc, arg)
+				if err != nil {
+					return nil, err
+				}
+				if ok {
+					result = append(result, doc)
+				}
+			}
+
+			return result, nil
+		case "$sort":
+			sortSpec, ok := spec.(bson.D)
+			if !ok {
+				doc, _ := asDocument(spec)
+				if len(doc) > 1 {
+					return nil, fmt.Errorf("sorting by several keys requires an ordered document")
+				}
+
+				sortSpec = bson.D{}
+				for k, v := range doc {
+					sortSpec = append(sortSpec, bson.E{Key: k, Value: v})
+				}
+			}
+
+			keys, err := sortKeys(sortSpec)
+			if err != nil {
+				return nil, err
+			}
+
+			sorted := append([]bson.M(nil), docs...)
+			sortDocuments(sorted, keys)
+
+			return sorted, nil
+		case "$skip", "$limit":
+			n, ok := orderable(spec).(float64)
+			if !ok || n < 0 {
+				return nil, fmt.Errorf("%s must be a positive number", operator)
+			}
+
+			if operator == "$skip" {
+				return paginate(docs, int64(n), 0), nil
+			}
+			return paginate(docs, 0, int64(n)), nil
+		case "$count":
+			field, ok := spec.(string)
+			if !ok || field == "" {
+				return nil, fmt.Errorf("$count must be a field name")
+			}
+
+			return []bson.M{{field: int32(len(docs))}}, nil
+		default:
+			return nil, fmt.Errorf("unsupported aggregation stage %q", operator)
+		}
+	}
+
+	return docs, nil
+}
+
+func (s *Store) InsertMany(_ context.Context, colName string, docs []interface{}) ([]interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.insert(colName, docs)
+}
+
+func (s *Store) insert(colName string, docs []interface{}) ([]interface{}, error) {
+	ids := make([]interface{}, 0, len(docs))
+
+	for _, d := range docs {
+		doc, err := normalize(d)
+		if err != nil {
+			return ids, err
+		}
+
+		if _, ok := doc["_id"]; !ok {
+			doc["_id"] = primitive.NewObjectID()
+		}
+
+		err = s.storage.create(colName, doc)
+		if errors.Is(err, errDuplicateKey) {
+			return ids, fmt.Errorf("%w: _id %v", errDuplicateKey, doc["_id"])
+		}
+		if err != nil {
+			return ids, err
+		}
+
+		ids = append(ids, doc["_id"])
+	}
+
+	return ids, nil
+}
+
+func (s *Store) UpdateOne(
+	_ context.Context,
+	colName string,
+	filter, update bson.M,
+	opts *options.UpdateOptions,
+) (*mongo.UpdateResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.update(colName, filter, update, opts, false)
+}
+
+func (s *Store) UpdateMany(
+	_ context.Context,
+	colName string,
+	filter, update bson.M,
+	opts *options.UpdateOptions,
+) (*mongo.UpdateResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.update(colName, filter, update, opts, true)
+}
+
+func (s *Store) update(
+	colName string,
+	filter, update bson.M,
+	opts *options.UpdateOptions,
+	many bool,
+) (*mongo.UpdateResult, error) {
+	normalizedUpdate, err := normalize(update)
+	if err != nil {
+		return nil, err
+	}
+
+	docs, err := s.find(colName, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if !many && len(docs) > 1 {
+		docs = docs[:1]
+	}
+
+	result := &mongo.UpdateResult{MatchedCount: int64(len(docs))}
+
+	for _, doc := range docs {
+		original, err := normalize(doc.doc)
+		if err != nil {
+			return nil, err
+		}
+
+		updated, err := normalize(doc.doc)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := applyUpdate(updated, normalizedUpdate); err != nil {
+			return nil, err
+		}
+
+		// as MongoDB does, documents left as they were aren't written nor counted as modified
+		if reflect.DeepEqual(updated, original) {
+			continue
+		}
+
+		if err := s.storage.update(colName, updated, doc.revision); err != nil {
+			return nil, fmt.Errorf("error updating document %v: %w", doc.doc["_id"], err)
+		}
+
+		result.ModifiedCount++
+	}
+
+	if len(docs) == 0 && opts != nil && opts.Upsert != nil && *opts.Upsert {
+		doc, err := upsertDocument(filter, normalizedUpdate)
+		if err != nil {
+			return nil, err
+		}
+
+		ids, err := s.insert(colName, []interface{}{doc})
+		if err != nil {
+			return nil, err
+		}
+
+		result.UpsertedCount = 1
+		result.UpsertedID = ids[0]
+	}
+
+	return result, nil
+}
+
+// upsertDocument builds the document inserted by an upsert from the filter's equality fields.
+func upsertDocument(filter, update bson.M) (bson.M, error) {
+	normalizedFilter, err := normalize(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := bson.M{}
+	for field, condition := range normalizedFilter {
+		if _, isOperator := isOperatorDocument(condition); isOperator || field[0] == '$' {
+			continue
+		}
+		set(doc, field, condition)
+	}
+
+	if err := applyUpdate(doc, update); err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
+
+func (s *Store) DeleteOne(_ context.Context, colName string, filter bson.M) (*mongo.DeleteResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.delete(colName, filter, false)
+}
+
+func (s *Store) DeleteMany(_ context.Context, colName string, filter bson.M) (*mongo.DeleteResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.delete(colName, filter, true)
+}
+
+func (s *Store) delete(colName string, filter bson.M, many bool) (*mongo.DeleteResult, error) {
+	docs, err := s.find(colName, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if !many && len(docs) > 1 {
+		docs = docs[:1]
+	}
+
+	result := &mongo.DeleteResult{}
+	for _, doc := range docs {
+		if err := s.storage.remove(colName, doc.doc, doc.revision); err != nil {
+			return result, fmt.Errorf("error deleting document %v: %w", doc.doc["_id"], err)
+		}
+		result.DeletedCount++
+	}
+
+	return result, nil
+}
+
+func (s *Store) BulkWrite(
+	_ context.Context,
+	colName string,
+	models []mongo.WriteModel,
+	opts *options.BulkWriteOptions,
+) (*mongo.BulkWriteResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ordered := opts == nil || opts.Ordered == nil || *opts.Ordered
+	result := &mongo.BulkWriteResult{UpsertedIDs: map[int64]interface{}{}}
+
+	var firstErr error
+	for i, model := range models {
+		err := s.write(colName, model, result, int64(i))
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("error in bulk write operation %d: %w", i, err)
+			}
+			if ordered {
+				break
+			}
+		}
+	}
+
+	return result, firstErr
+}
+
+func (s *Store) write(colName string, model mongo.WriteModel, result *mongo.BulkWriteResult, index int64) error {
+	var (
+		update *mongo.UpdateResult
+		err    error
+	)
+
+	switch m := model.(type) {
+	case *mongo.InsertOneModel:
+		_, err = s.insert(colName, []interface{}{m.Document})
+		if err == nil {
+			result.InsertedCount++
+		}
+		return err
+	case *mongo.UpdateOneModel:
+		update, err = s.updateModel(colName, m.Filter, m.Update, m.Upsert, false)
+	case *mongo.UpdateManyModel:
+		update, err = s.updateModel(colName, m.Filter, m.Update, m.Upsert, true)
+	case *mongo.DeleteOneModel, *mongo.DeleteManyModel:
+		var filter interface{}
+		many := false
+		if deleteOne, ok := m.(*mongo.DeleteOneModel); ok {
+			filter = deleteOne.Filter
+		} else {
+			filter = m.(*mongo.DeleteManyModel).Filter
+			many = true
+		}
+
+		filterDoc, err := normalize(filter)
+		if err != nil {
+			return err
+		}
+
+		deleted, err := s.delete(colName, filterDoc, many)
+		if deleted != nil {
+			result.DeletedCount += deleted.DeletedCount
+		}
+		return err
+	default:
+		return fmt.Errorf("unsupported write model %T", model)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	result.MatchedCount += update.MatchedCount
+	result.ModifiedCount += update.ModifiedCount
+	result.UpsertedCount += update.UpsertedCount
+	if update.UpsertedID != nil {
+		result.UpsertedIDs[index] = update.UpsertedID
+	}
+
+	return nil
+}
+
+func (s *Store) updateModel(
+	colName string,
+	filter, update interface{},
+	upsert *bool,
+	many bool,
+) (*mongo.UpdateResult, error) {
+	filterDoc, err := normalize(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	updateDoc, err := normalize(update)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := options.Update()
+	if upsert != nil {
+		opts.SetUpsert(*upsert)
+	}
+
+	return s.update(colName, filterDoc, updateDoc, opts, many)
+}
+
+// CreateIndexes only logs the indexes, as they aren't enforced.
+func (s *Store) CreateIndexes(_ context.Context, colName string, indexes []mongo.IndexModel) error {
+	s.logger.Debugf("Ignoring %d indexes of collection %q, not supported by the document store", len(indexes), colName)
+	return nil
+}
+
+// cursor iterates over the documents of a query.
+type cursor struct {
+	docs     []bson.M
+	position int
+}
+
+func (c *cursor) Next(_ context.Context) bool {
+	if c.position+1 >= len(c.docs) {
+		c.position = len(c.docs)
+		return false
+	}
+
+	c.position++
+
+	return true
+}
+
+func (c *cursor) Decode(val interface{}) error {
+	if c.position < 0 || c.position >= len(c.docs) {
+		return fmt.Errorf("no current document")
+	}
+
+	return decode(c.docs[c.position], val)
+}
+
+func (c *cursor) Err() error {
+	return nil
+}
+
+func (c *cursor) Close(_ context.Context) error {
+	return nil
+}
@@ -0,0 +1,268 @@
+//go:build unit
+
+package docstore
+
+import (
+	"context"
+	"testing"
+
+	"github.com/konstellation-io/kre/libs/simplelogger"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type asset struct {
+	ID     string   `bson:"_id"`
+	Name   string   `bson:"name"`
+	Score  int      `bson:"score"`
+	Tags   []string `bson:"tags,omitempty"`
+	Status string   `bson:"status,omitempty"`
+}
+
+type StoreTestSuite struct {
+	suite.Suite
+	ctx   context.Context
+	store *Store
+}
+
+func TestStoreTestSuite(t *testing.T) {
+	suite.Run(t, new(StoreTestSuite))
+}
+
+func (suite *StoreTestSuite) SetupTest() {
+	suite.ctx = context.Background()
+	suite.store = NewMemoryStore(simplelogger.New(simplelogger.LevelInfo))
+	suite.Require().NoError(suite.store.Connect())
+
+	_, err := suite.store.InsertMany(suite.ctx, "assets", []interface{}{
+		asset{ID: "a1", Name: "pump", Score: 7, Tags: []string{"water", "critical"}},
+		asset{ID: "a2", Name: "valve", Score: 3, Tags: []string{"water"}},
+		asset{ID: "a3", Name: "motor", Score: 9},
+	})
+	suite.Require().NoError(err)
+}
+
+func (suite *StoreTestSuite) TestFindFilters() {
+	cases := []struct {
+		filter bson.M
+		ids    []string
+	}{
+		{bson.M{}, []string{"a1", "a2", "a3"}},
+		{bson.M{"name": "valve"}, []string{"a2"}},
+		{bson.M{"tags": "water"}, []string{"a1", "a2"}},
+		{bson.M{"score": bson.M{"$gte": 7}}, []string{"a1", "a3"}},
+		{bson.M{"score": bson.M{"$gt": 3, "$lt": 9}}, []string{"a1"}},
+		{bson.M{"name": bson.M{"$in": bson.A{"pump", "motor"}}}, []string{"a1", "a3"}},
+		{bson.M{"tags": bson.M{"$exists": false}}, []string{"a3"}},
+		{bson.M{"name": bson.M{"$regex": "^m"}}, []string{"a3"}},
+		{bson.M{"$or": bson.A{bson.M{"name": "pump"}, bson.M{"score": 3}}}, []string{"a1", "a2"}},
+		{bson.M{"score": bson.M{"$ne": 7}, "tags": "water"}, []string{"a2"}},
+	}
+
+	for _, c := range cases {
+		var results []asset
+		err := suite.store.Find(suite.ctx, "assets", c.filter, &results)
+		suite.Require().NoError(err)
+
+		ids := []string{}
+		for _, r := range results {
+			ids = append(ids, r.ID)
+		}
+		suite.Equal(c.ids, ids, "filter %v", c.filter)
+	}
+}
+
+func (suite *StoreTestSuite) TestFindWithOptions() {
+	// GIVEN sort, skip, limit and projection options
+	opts := options.Find().
+		SetSort(bson.D{{Key: "score", Value: -1}}).
+		SetSkip(1).
+		SetLimit(1).
+		SetProjection(bson.M{"name": 1})
+
+	// WHEN the documents are found
+	var results []bson.M
+	err := suite.store.FindWithOptions(suite.ctx, "assets", bson.M{}, opts, &results)
+
+	// THEN only the projected fields of the second best scored document are returned
+	suite.Require().NoError(err)
+	suite.Equal([]bson.M{{"_id": "a1", "name": "pump"}}, results)
+}
+
+func (suite *StoreTestSuite) TestFindOne() {
+	var result asset
+	err := suite.store.FindOne(suite.ctx, "assets", bson.M{"score": bson.M{"$lt": 5}}, nil, &result)
+	suite.Require().NoError(err)
+	suite.Equal("valve", result.Name)
+
+	err = suite.store.FindOne(suite.ctx, "assets", bson.M{"name": "fan"}, nil, &result)
+	suite.ErrorIs(err, mongo.ErrNoDocuments)
+}
+
+func (suite *StoreTestSuite) TestInsertDuplicatedID() {
+	_, err := suite.store.InsertMany(suite.ctx, "assets", []interface{}{asset{ID: "a1", Name: "fan"}})
+	suite.ErrorIs(err, errDuplicateKey)
+
+	ids, err := suite.store.InsertMany(suite.ctx, "assets", []interface{}{bson.M{"name": "fan"}})
+	suite.Require().NoError(err)
+	suite.Len(ids, 1)
+}
+
+func (suite *StoreTestSuite) TestUpdateAndUpsert() {
+	// GIVEN an update of the water assets, and an upsert of a missing asset
+	filter := bson.M{"tags": "water"}
+	update := bson.M{"$set": bson.M{"status": "checked"}, "$inc": bson.M{"score": 1}}
+
+	// WHEN they are applied
+	updated, err := suite.store.UpdateMany(suite.ctx, "assets", filter, update, nil)
+	suite.Require().NoError(err)
+
+	upserted, err := suite.store.UpdateOne(
+		suite.ctx, "assets", bson.M{"_id": "a4"}, bson.M{"$set": bson.M{"name": "fan"}},
+		options.Update().SetUpsert(true),
+	)
+	suite.Require().NoError(err)
+
+	// THEN the matching documents are updated and the missing one inserted with the filter fields
+	suite.EqualValues(2, updated.MatchedCount)
+	suite.EqualValues(1, upserted.UpsertedCount)
+	suite.Equal("a4", upserted.UpsertedID)
+
+	var results []asset
+	err = suite.store.Find(suite.ctx, "assets", bson.M{"status": "checked"}, &results)
+	suite.Require().NoError(err)
+	suite.Require().Len(results, 2)
+	suite.Equal(8, results[0].Score)
+	suite.Equal(4, results[1].Score)
+
+	var fan asset
+	suite.Require().NoError(suite.store.FindOne(suite.ctx, "assets", bson.M{"_id": "a4"}, nil, &fan))
+	suite.Equal("fan", fan.Name)
+}
+
+func (suite *StoreTestSuite) TestUpdateLeavingDocumentsAsTheyWere() {
+	// GIVEN an update setting the score the water assets already have for one of them
+	update := bson.M{"$set": bson.M{"score": 7}}
+
+	// WHEN it is applied
+	result, err := suite.store.UpdateMany(suite.ctx, "assets", bson.M{"tags": "water"}, update, nil)
+	suite.Require().NoError(err)
+
+	// THEN both documents match, but only the changed one counts as modified
+	suite.EqualValues(2, result.MatchedCount)
+	suite.EqualValues(1, result.ModifiedCount)
+}
+
+func (suite *StoreTestSuite) TestDelete() {
+	deleted, err := suite.store.DeleteOne(suite.ctx, "assets", bson.M{"tags": "water"})
+	suite.Require().NoError(err)
+	suite.EqualValues(1, deleted.DeletedCount)
+
+	deleted, err = suite.store.DeleteMany(suite.ctx, "assets", bson.M{})
+	suite.Require().NoError(err)
+	suite.EqualValues(2, deleted.DeletedCount)
+
+	count, err := suite.store.Count(suite.ctx, "assets", bson.M{})
+	suite.Require().NoError(err)
+	suite.Zero(count)
+}
+
+func (suite *StoreTestSuite) TestBulkWrite() {
+	// GIVEN an unordered bulk write with a failing insert
+	models := []mongo.WriteModel{
+		mongo.NewInsertOneModel().SetDocument(asset{ID: "a1", Name: "duplicated"}),
+		mongo.NewUpdateManyModel().SetFilter(bson.M{"tags": "water"}).SetUpdate(bson.M{"$set": bson.M{"status": "ok"}}),
+		mongo.NewDeleteOneModel().SetFilter(bson.M{"_id": "a3"}),
+		mongo.NewInsertOneModel().SetDocument(asset{ID: "a5", Name: "fan"}),
+	}
+
+	// WHEN it is written
+	result, err := suite.store.BulkWrite(suite.ctx, "assets", models, options.BulkWrite().SetOrdered(false))
+
+	// THEN the other operations are applied, and the failure returned
+	suite.Error(err)
+	suite.EqualValues(1, result.InsertedCount)
+	suite.EqualValues(2, result.ModifiedCount)
+	suite.EqualValues(1, result.DeletedCount)
+}
+
+func (suite *StoreTestSuite) TestCursor() {
+	cursor, err := suite.store.Cursor(suite.ctx, "assets", bson.M{}, options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+	suite.Require().NoError(err)
+
+	names := []string{}
+	for cursor.Next(suite.ctx) {
+		var a asset
+		suite.Require().NoError(cursor.Decode(&a))
+		names = append(names, a.Name)
+	}
+
+	suite.NoError(cursor.Err())
+	suite.NoError(cursor.Close(suite.ctx))
+	suite.Equal([]string{"motor", "pump", "valve"}, names)
+}
+
+func (suite *StoreTestSuite) TestDistinct() {
+	values, err := suite.store.Distinct(suite.ctx, "assets", "tags", bson.M{})
+
+	suite.Require().NoError(err)
+	suite.ElementsMatch([]interface{}{"water", "critical"}, values)
+}
+
+func (suite *StoreTestSuite) TestAggregate() {
+	// GIVEN a pipeline with match, sort, limit and count stages
+	pipeline := []bson.M{
+		{"$match": bson.M{"score": bson.M{"$gt": 1}}},
+		{"$sort": bson.M{"score": -1}},
+		{"$limit": 2},
+		{"$count": "total"},
+	}
+
+	// WHEN it is aggregated
+	var results []bson.M
+	err := suite.store.Aggregate(suite.ctx, "assets", pipeline, &results)
+
+	// THEN the stages are applied in order
+	suite.Require().NoError(err)
+	suite.Equal([]bson.M{{"total": int32(2)}}, results)
+}
+
+func (suite *StoreTestSuite) TestAggregateSortBySeveralKeys() {
+	var results []asset
+
+	// the order of the keys of a map is lost
+	err := suite.store.Aggregate(suite.ctx, "assets", []bson.M{{"$sort": bson.M{"score": -1, "name": 1}}}, &results)
+	suite.Error(err)
+
+	err = suite.store.Aggregate(suite.ctx, "assets", []bson.M{
+		{"$sort": bson.D{{Key: "status", Value: 1}, {Key: "name", Value: 1}}},
+	}, &results)
+	suite.Require().NoError(err)
+	suite.Equal([]string{"a3", "a1", "a2"}, []string{results[0].ID, results[1].ID, results[2].ID})
+}
+
+func (suite *StoreTestSuite) TestUnsupportedOperators() {
+	var results []bson.M
+
+	err := suite.store.Find(suite.ctx, "assets", bson.M{"name": bson.M{"$elemMatch": bson.M{}}}, &results)
+	suite.Error(err)
+
+	_, err = suite.store.UpdateMany(suite.ctx, "assets", bson.M{}, bson.M{"$push": bson.M{"tags": "new"}}, nil)
+	suite.Error(err)
+}
+
+func (suite *StoreTestSuite) TestWritesOfChangedDocumentsFail() {
+	// GIVEN a document read before being changed, as by another replica
+	docs, err := suite.store.find("assets", bson.M{"_id": "a1"})
+	suite.Require().NoError(err)
+	suite.Require().Len(docs, 1)
+
+	_, err = suite.store.UpdateOne(suite.ctx, "assets", bson.M{"_id": "a1"}, bson.M{"$inc": bson.M{"score": 1}}, nil)
+	suite.Require().NoError(err)
+
+	// THEN writing it with the revision read fails
+	suite.ErrorIs(suite.store.storage.update("assets", docs[0].doc, docs[0].revision), errConflict)
+	suite.ErrorIs(suite.store.storage.remove("assets", docs[0].doc, docs[0].revision), errConflict)
+}
@@ -0,0 +1,160 @@
+//go:build unit
+
+package kre
+
+import (
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// fakeKV is an in-memory nats.KeyValue implementing the operations used by the runner's stores.
+// Deletes ignore their options, as the last revision given to them can't be read. Reads and
+// writes fail with err when set.
+type fakeKV struct {
+	nats.KeyValue
+
+	err      error
+	mu       sync.Mutex
+	bucket   string
+	ttl      time.Duration
+	entries  map[string]*fakeKVEntry
+	revision uint64
+}
+
+func newFakeKV(bucket string, ttl time.Duration) *fakeKV {
+	return &fakeKV{
+		bucket:  bucket,
+		ttl:     ttl,
+		entries: make(map[string]*fakeKVEntry),
+	}
+}
+
+func (kv *fakeKV) Bucket() string {
+	return kv.bucket
+}
+
+func (kv *fakeKV) Status() (nats.KeyValueStatus, error) {
+	return &fakeKVStatus{bucket: kv.bucket, ttl: kv.ttl}, nil
+}
+
+func (kv *fakeKV) Get(key string) (nats.KeyValueEntry, error) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	if kv.err != nil {
+		return nil, kv.err
+	}
+
+	entry, ok := kv.entries[key]
+	if !ok {
+		return nil, nats.ErrKeyNotFound
+	}
+
+	return entry, nil
+}
+
+func (kv *fakeKV) Put(key string, value []byte) (uint64, error) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	if kv.err != nil {
+		return 0, kv.err
+	}
+
+	return kv.put(key, value), nil
+}
+
+func (kv *fakeKV) PutString(key string, value string) (uint64, error) {
+	return kv.Put(key, []byte(value))
+}
+
+func (kv *fakeKV) Create(key string, value []byte) (uint64, error) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	if _, ok := kv.entries[key]; ok {
+		return 0, nats.ErrKeyExists
+	}
+
+	return kv.put(key, value), nil
+}
+
+func (kv *fakeKV) Update(key string, value []byte, last uint64) (uint64, error) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	entry, ok := kv.entries[key]
+	if !ok || entry.revision != last {
+		return 0, nats.ErrKeyExists
+	}
+
+	return kv.put(key, value), nil
+}
+
+func (kv *fakeKV) Delete(key string, _ ...nats.DeleteOpt) error {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	delete(kv.entries, key)
+
+	return nil
+}
+
+func (kv *fakeKV) Keys(_ ...nats.WatchOpt) ([]string, error) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	if len(kv.entries) == 0 {
+		return nil, nats.ErrNoKeysFound
+	}
+
+	keys := make([]string, 0, len(kv.entries))
+	for key := range kv.entries {
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+func (kv *fakeKV) put(key string, value []byte) uint64 {
+	kv.revision++
+	kv.entries[key] = &fakeKVEntry{
+		bucket:   kv.bucket,
+		key:      key,
+		value:    append([]byte(nil), value...),
+		revision: kv.revision,
+		created:  time.Now(),
+	}
+
+	return kv.revision
+}
+
+type fakeKVEntry struct {
+	bucket   string
+	key      string
+	value    []byte
+	revision uint64
+	created  time.Time
+}
+
+func (e *fakeKVEntry) Bucket() string             { return e.bucket }
+func (e *fakeKVEntry) Key() string                { return e.key }
+func (e *fakeKVEntry) Value() []byte              { return e.value }
+func (e *fakeKVEntry) Revision() uint64           { return e.revision }
+func (e *fakeKVEntry) Created() time.Time         { return e.created }
+func (e *fakeKVEntry) Delta() uint64              { return 0 }
+func (e *fakeKVEntry) Operation() nats.KeyValueOp { return nats.KeyValuePut }
+
+type fakeKVStatus struct {
+	bucket string
+	ttl    time.Duration
+}
+
+func (s *fakeKVStatus) Bucket() string       { return s.bucket }
+func (s *fakeKVStatus) Values() uint64       { return 0 }
+func (s *fakeKVStatus) History() int64       { return 1 }
+func (s *fakeKVStatus) TTL() time.Duration   { return s.ttl }
+func (s *fakeKVStatus) BackingStore() string { return "JetStream" }
+func (s *fakeKVStatus) Bytes() uint64        { return 0 }
@@ -0,0 +1,127 @@
+package kre
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"time"
+
+	"google.golang.org/protobuf/types/known/anypb"
+
+	utilErrors "github.com/konstellation-io/kre-runners/kre-go/v4/internal/errors"
+)
+
+const gatherBufferName = "gather"
+
+// GatherHandler is executed once per request when all the parts sent by the previous node's
+// Scatter have arrived, or when the gather times out. Parts are given in order, on timeout the
+// parts that did not arrive are nil.
+type GatherHandler func(ctx *HandlerContext, parts []*anypb.Any) error
+
+// Gather buffers the parts of a scattered request until all of them have arrived. Buffered
+// parts are stored in the join key-value store, so they survive restarts.
+//
+// Messages that are not parts are given to the gather handler as a request with a single part.
+type Gather struct {
+	timeout time.Duration
+	handler GatherHandler
+}
+
+// NewGather creates a gather for the parts of the incoming requests. A timeout of zero means
+// the gather waits forever.
+func NewGather(handler GatherHandler, timeout time.Duration) *Gather {
+	return &Gather{
+		timeout: timeout,
+		handler: handler,
+	}
+}
+
+// Handler returns the handler buffering the scattered parts.
+func (g *Gather) Handler() Handler {
+	return func(ctx *HandlerContext, data *anypb.Any) error {
+		if !ctx.IsMessagePart() {
+			return g.handler(ctx, []*anypb.Any{data})
+		}
+
+		if ctx.joins == nil {
+			return utilErrors.ErrUndefinedJoinStore
+		}
+
+		ctx.joins.register(g)
+
+		requestID := ctx.GetRequestID()
+		fromNode := ctx.reqMsg.FromNode
+		key := g.key(requestID, fromNode)
+		slot := strconv.Itoa(ctx.GetPartIndex())
+
+		state, revision, err := ctx.joins.add(key, requestID, fromNode, slot, ctx.GetPartCount(), data)
+		if err != nil {
+			return err
+		}
+
+		if len(state.Payloads) < state.Total {
+			ctx.Logger.Debugf("Gather for request %q waiting for %d more parts",
+				requestID, state.Total-len(state.Payloads))
+			return nil
+		}
+
+		parts, err := g.orderedParts(state)
+		if err != nil {
+			return err
+		}
+
+		// Removing the state first ensures the gather is completed once, and not timed out meanwhile
+		completed, err := ctx.joins.complete(key, revision, requestID)
+		if err != nil || !completed {
+			return err
+		}
+
+		return g.handler(ctx, parts)
+	}
+}
+
+func (g *Gather) bufferName() string {
+	return gatherBufferName
+}
+
+func (g *Gather) bufferTimeout() time.Duration {
+	return g.timeout
+}
+
+func (g *Gather) handleTimeout(ctx *HandlerContext, state *joinState) error {
+	parts, err := g.orderedParts(state)
+	if err != nil {
+		return err
+	}
+
+	return g.handler(ctx, parts)
+}
+
+func (g *Gather) orderedParts(state *joinState) ([]*anypb.Any, error) {
+	payloads, err := state.decodePayloads()
+	if err != nil {
+		return nil, err
+	}
+
+	parts := make([]*anypb.Any, state.Total)
+
+	for slot, payload := range payloads {
+		index, err := strconv.Atoi(slot)
+		if err != nil || index < 0 || index >= state.Total {
+			return nil, fmt.Errorf("invalid part index %q for request %q", slot, state.RequestID)
+		}
+
+		parts[index] = payload
+	}
+
+	return parts, nil
+}
+
+// key keeps apart the parts of the same request scattered by different nodes.
+func (g *Gather) key(requestID, fromNode string) string {
+	return fmt.Sprintf("%s.%s.%s",
+		gatherBufferName,
+		base64.RawURLEncoding.EncodeToString([]byte(requestID)),
+		base64.RawURLEncoding.EncodeToString([]byte(fromNode)),
+	)
+}
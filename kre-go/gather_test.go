@@ -0,0 +1,89 @@
+//go:build unit
+
+package kre
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type GatherTestSuite struct {
+	suite.Suite
+}
+
+func TestGatherTestSuite(t *testing.T) {
+	suite.Run(t, new(GatherTestSuite))
+}
+
+func (suite *GatherTestSuite) encodePart(value string) []byte {
+	payload, err := anypb.New(wrapperspb.String(value))
+	suite.Require().NoError(err)
+
+	data, err := proto.Marshal(payload)
+	suite.Require().NoError(err)
+
+	return data
+}
+
+func (suite *GatherTestSuite) TestOrderedPartsWithMissingParts() {
+	// GIVEN a state with two of three parts received out of order
+	state := &joinState{
+		RequestID: "request",
+		Total:     3,
+		Payloads: map[string][]byte{
+			"2": suite.encodePart("c"),
+			"0": suite.encodePart("a"),
+		},
+	}
+
+	// WHEN the parts are ordered
+	parts, err := NewGather(nil, 0).orderedParts(state)
+	suite.Require().NoError(err)
+
+	// THEN parts are placed by index and the missing one is nil
+	suite.Require().Len(parts, 3)
+	suite.Nil(parts[1])
+
+	value := &wrapperspb.StringValue{}
+	suite.Require().NoError(parts[2].UnmarshalTo(value))
+	suite.Equal("c", value.Value)
+}
+
+func (suite *GatherTestSuite) TestOrderedPartsWithInvalidIndex() {
+	state := &joinState{
+		RequestID: "request",
+		Total:     1,
+		Payloads: map[string][]byte{
+			"1": suite.encodePart("a"),
+		},
+	}
+
+	_, err := NewGather(nil, 0).orderedParts(state)
+	suite.Require().Error(err)
+}
+
+func (suite *GatherTestSuite) TestHandlerWithMessageNotBeingAPart() {
+	// GIVEN a gather and an incoming message that is not a part
+	var received []*anypb.Any
+	gather := NewGather(func(ctx *HandlerContext, parts []*anypb.Any) error {
+		received = parts
+		return nil
+	}, 0)
+
+	payload, err := anypb.New(wrapperspb.String("a"))
+	suite.Require().NoError(err)
+
+	ctx := &HandlerContext{reqMsg: &KreNatsMessage{RequestId: "request"}}
+
+	// WHEN the gather handles it
+	err = gather.Handler()(ctx, payload)
+
+	// THEN the gather handler receives a single part without buffering it
+	suite.Require().NoError(err)
+	suite.Require().Len(received, 1)
+	suite.True(proto.Equal(payload, received[0]))
+}
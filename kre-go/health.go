@@ -0,0 +1,118 @@
+package kre
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/konstellation-io/kre/libs/simplelogger"
+)
+
+const healthReadHeaderTimeout = 5 * time.Second
+
+// HealthCheck returns an error when the checked dependency is not healthy.
+type HealthCheck func() error
+
+// HealthServer exposes the liveness and readiness of the node over HTTP, for the container
+// probes. Liveness fails when the node cannot recover by itself and must be restarted, while
+// readiness fails while a dependency is temporarily unavailable.
+type HealthServer struct {
+	logger    *simplelogger.SimpleLogger
+	mu        sync.RWMutex
+	liveness  map[string]HealthCheck
+	readiness map[string]HealthCheck
+}
+
+type healthResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+func NewHealthServer(logger *simplelogger.SimpleLogger) *HealthServer {
+	return &HealthServer{
+		logger:    logger,
+		liveness:  make(map[string]HealthCheck),
+		readiness: make(map[string]HealthCheck),
+	}
+}
+
+// AddLivenessCheck registers a check served at /healthz.
+func (h *HealthServer) AddLivenessCheck(name string, check HealthCheck) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.liveness[name] = check
+}
+
+// AddReadinessCheck registers a check served at /readyz.
+func (h *HealthServer) AddReadinessCheck(name string, check HealthCheck) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.readiness[name] = check
+}
+
+func (h *HealthServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		h.writeChecks(w, h.liveness)
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, _ *http.Request) {
+		h.writeChecks(w, h.readiness)
+	})
+
+	return mux
+}
+
+// Serve blocks serving the health endpoints in the given address.
+func (h *HealthServer) Serve(address string) error {
+	server := &http.Server{
+		Addr:              address,
+		Handler:           h.Handler(),
+		ReadHeaderTimeout: healthReadHeaderTimeout,
+	}
+
+	h.logger.Infof("Serving health checks on %s", address)
+
+	return server.ListenAndServe()
+}
+
+func (h *HealthServer) writeChecks(w http.ResponseWriter, checks map[string]HealthCheck) {
+	h.mu.RLock()
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	h.mu.RUnlock()
+
+	sort.Strings(names)
+
+	res := healthResponse{Status: "ok"}
+	status := http.StatusOK
+
+	for _, name := range names {
+		h.mu.RLock()
+		check := checks[name]
+		h.mu.RUnlock()
+
+		if err := check(); err != nil {
+			if res.Checks == nil {
+				res.Checks = make(map[string]string)
+			}
+
+			res.Status = "error"
+			res.Checks[name] = err.Error()
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	err := json.NewEncoder(w).Encode(res)
+	if err != nil {
+		h.logger.Errorf("Error writing health checks response: %s", err)
+	}
+}
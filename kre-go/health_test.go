@@ -0,0 +1,91 @@
+//go:build unit
+
+package kre
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/konstellation-io/kre/libs/simplelogger"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/konstellation-io/kre-runners/kre-go/v4/config"
+	"github.com/konstellation-io/kre-runners/kre-go/v4/mongodb"
+)
+
+type HealthServerTestSuite struct {
+	suite.Suite
+	health *HealthServer
+}
+
+func TestHealthServerTestSuite(t *testing.T) {
+	suite.Run(t, new(HealthServerTestSuite))
+}
+
+func (suite *HealthServerTestSuite) SetupTest() {
+	suite.health = NewHealthServer(simplelogger.New(simplelogger.LevelInfo))
+}
+
+func (suite *HealthServerTestSuite) get(path string) (int, healthResponse) {
+	rec := httptest.NewRecorder()
+	suite.health.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+	var res healthResponse
+	suite.Require().NoError(json.NewDecoder(rec.Body).Decode(&res))
+
+	return rec.Code, res
+}
+
+func (suite *HealthServerTestSuite) TestHealthyChecks() {
+	suite.health.AddLivenessCheck("nats", func() error { return nil })
+
+	code, res := suite.get("/healthz")
+
+	suite.Equal(http.StatusOK, code)
+	suite.Equal("ok", res.Status)
+}
+
+func (suite *HealthServerTestSuite) TestFailingChecks() {
+	// GIVEN a failing readiness check
+	suite.health.AddLivenessCheck("nats", func() error { return nil })
+	suite.health.AddReadinessCheck("nats", func() error { return fmt.Errorf("connection status is RECONNECTING") })
+
+	// WHEN the readiness is requested
+	code, res := suite.get("/readyz")
+
+	// THEN the failing check is reported
+	suite.Equal(http.StatusServiceUnavailable, code)
+	suite.Equal("error", res.Status)
+	suite.Equal(map[string]string{"nats": "connection status is RECONNECTING"}, res.Checks)
+
+	// THEN the liveness is not affected
+	code, _ = suite.get("/healthz")
+	suite.Equal(http.StatusOK, code)
+}
+
+func (suite *HealthServerTestSuite) TestDatabaseReadinessCheck() {
+	// GIVEN a lazily connected MongoDB that is not available
+	cfg := config.Config{MongoDB: config.MongoDB{
+		Address:                "mongodb://127.0.0.1:1",
+		ConnTimeout:            1,
+		ServerSelectionTimeout: 100 * time.Millisecond,
+		LazyConnect:            true,
+		ConnectRetryInterval:   time.Hour,
+	}}
+	db := mongodb.NewMongoManager(cfg, simplelogger.New(simplelogger.LevelInfo))
+	suite.Require().NoError(db.Connect())
+	defer func() { suite.NoError(db.Disconnect()) }()
+
+	suite.health.AddReadinessCheck("database", databaseReadinessCheck(db))
+
+	// WHEN the readiness is requested
+	code, res := suite.get("/readyz")
+
+	// THEN the database is reported as not ready
+	suite.Equal(http.StatusServiceUnavailable, code)
+	suite.Contains(res.Checks, "database")
+}
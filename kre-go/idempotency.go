@@ -0,0 +1,118 @@
+package kre
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/konstellation-io/kre/libs/simplelogger"
+	"github.com/nats-io/nats.go"
+
+	"github.com/konstellation-io/kre-runners/kre-go/v4/config"
+	utilErrors "github.com/konstellation-io/kre-runners/kre-go/v4/internal/errors"
+)
+
+// IdempotencyStore records which (request ID, from node) pairs have already been processed by
+// the node, so redelivered messages are acknowledged without running the handler twice.
+//
+// Entries expire following the TTL of the underlying key-value bucket.
+type IdempotencyStore struct {
+	logger  *simplelogger.SimpleLogger
+	kvStore nats.KeyValue
+}
+
+// NewIdempotencyStore connects to the idempotency key-value store, creating it when missing.
+// A nil store is returned when no key-value store is configured.
+func NewIdempotencyStore(
+	cfg config.Config,
+	logger *simplelogger.SimpleLogger,
+	js nats.JetStreamContext,
+) (*IdempotencyStore, error) {
+	wrapErr := utilErrors.Wrapper("idempotency init: %w")
+
+	bucket := cfg.NATS.KeyValueStoreIdempotencyName
+	if bucket == "" {
+		logger.Info("Idempotency key-value store not defined. Skipping idempotency initialization.")
+		return nil, nil
+	}
+
+	kvStore, err := js.KeyValue(bucket)
+	switch {
+	case errors.Is(err, nats.ErrBucketNotFound):
+		kvStore, err = js.CreateKeyValue(&nats.KeyValueConfig{
+			Bucket:  bucket,
+			TTL:     cfg.NATS.IdempotencyTTL,
+			Storage: nats.FileStorage,
+		})
+	case err == nil:
+		_, err = checkBucketTTL(logger, kvStore, cfg.NATS.IdempotencyTTL, "KRT_IDEMPOTENCY_TTL")
+	}
+
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+
+	return &IdempotencyStore{
+		logger:  logger,
+		kvStore: kvStore,
+	}, nil
+}
+
+// IsProcessed returns true if the part of the request coming from the given node was already
+// processed. Messages that aren't scatter parts have part index 0.
+func (s *IdempotencyStore) IsProcessed(requestID, fromNode string, partIndex int32) (bool, error) {
+	_, err := s.kvStore.Get(idempotencyKey(requestID, fromNode, partIndex))
+	if errors.Is(err, nats.ErrKeyNotFound) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("error checking if request %q was processed: %w", requestID, err)
+	}
+
+	return true, nil
+}
+
+// MarkProcessed records the part of the request coming from the given node as processed.
+func (s *IdempotencyStore) MarkProcessed(requestID, fromNode string, partIndex int32) error {
+	_, err := s.kvStore.PutString(idempotencyKey(requestID, fromNode, partIndex), time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("error marking request %q as processed: %w", requestID, err)
+	}
+
+	return nil
+}
+
+// checkBucketTTL warns when an existing bucket expires its entries after a TTL other than the
+// configured one, as the TTL is only applied when the bucket is created. It returns whether they match.
+func checkBucketTTL(
+	logger *simplelogger.SimpleLogger,
+	kvStore nats.KeyValue,
+	ttl time.Duration,
+	ttlVar string,
+) (bool, error) {
+	status, err := kvStore.Status()
+	if err != nil {
+		return false, fmt.Errorf("error getting key-value store %q status: %w", kvStore.Bucket(), err)
+	}
+
+	if status.TTL() == ttl {
+		return true, nil
+	}
+
+	logger.Warnf("Key-value store %q keeps its TTL %s instead of the %s given by %s, recreate it to apply it",
+		kvStore.Bucket(), status.TTL(), ttl, ttlVar)
+
+	return false, nil
+}
+
+// idempotencyKey encodes the request ID and node name since they may contain characters that are
+// not allowed in key-value store keys. The part index tells apart the parts of a scattered request.
+func idempotencyKey(requestID, fromNode string, partIndex int32) string {
+	return fmt.Sprintf("%s.%s.%d",
+		base64.RawURLEncoding.EncodeToString([]byte(requestID)),
+		base64.RawURLEncoding.EncodeToString([]byte(fromNode)),
+		partIndex,
+	)
+}
@@ -0,0 +1,79 @@
+//go:build unit
+
+package kre
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/konstellation-io/kre/libs/simplelogger"
+	"github.com/stretchr/testify/suite"
+)
+
+type IdempotencyStoreTestSuite struct {
+	suite.Suite
+	logger  *simplelogger.SimpleLogger
+	kvStore *fakeKV
+	store   *IdempotencyStore
+}
+
+func TestIdempotencyStoreTestSuite(t *testing.T) {
+	suite.Run(t, new(IdempotencyStoreTestSuite))
+}
+
+func (suite *IdempotencyStoreTestSuite) SetupTest() {
+	suite.logger = simplelogger.New(simplelogger.LevelInfo)
+	suite.kvStore = newFakeKV("kv_idempotency", time.Hour)
+	suite.store = &IdempotencyStore{logger: suite.logger, kvStore: suite.kvStore}
+}
+
+func (suite *IdempotencyStoreTestSuite) TestMarkProcessed() {
+	// GIVEN a part of a request marked as processed
+	err := suite.store.MarkProcessed("request.1", "nodeA", 2)
+	suite.Require().NoError(err)
+
+	// THEN only that part of the request coming from that node is processed
+	processed, err := suite.store.IsProcessed("request.1", "nodeA", 2)
+	suite.Require().NoError(err)
+	suite.True(processed)
+
+	processed, err = suite.store.IsProcessed("request.1", "nodeA", 0)
+	suite.Require().NoError(err)
+	suite.False(processed)
+
+	processed, err = suite.store.IsProcessed("request.1", "nodeB", 2)
+	suite.Require().NoError(err)
+	suite.False(processed)
+
+	processed, err = suite.store.IsProcessed("request.2", "nodeA", 2)
+	suite.Require().NoError(err)
+	suite.False(processed)
+}
+
+func (suite *IdempotencyStoreTestSuite) TestStoreErrors() {
+	// GIVEN an unavailable key-value store
+	suite.kvStore.err = errors.New("timeout")
+
+	// THEN checking and marking requests fail
+	_, err := suite.store.IsProcessed("request", "nodeA", 0)
+	suite.ErrorIs(err, suite.kvStore.err)
+
+	err = suite.store.MarkProcessed("request", "nodeA", 0)
+	suite.ErrorIs(err, suite.kvStore.err)
+}
+
+func (suite *IdempotencyStoreTestSuite) TestIdempotencyKey() {
+	// request IDs and node names may contain characters not allowed in keys
+	suite.Equal("cmVxLzE.bm9kZSBB.3", idempotencyKey("req/1", "node A", 3))
+}
+
+func (suite *IdempotencyStoreTestSuite) TestCheckBucketTTL() {
+	matches, err := checkBucketTTL(suite.logger, suite.kvStore, time.Hour, "KRT_IDEMPOTENCY_TTL")
+	suite.Require().NoError(err)
+	suite.True(matches)
+
+	matches, err = checkBucketTTL(suite.logger, suite.kvStore, 24*time.Hour, "KRT_IDEMPOTENCY_TTL")
+	suite.Require().NoError(err)
+	suite.False(matches)
+}
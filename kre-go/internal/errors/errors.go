@@ -6,9 +6,13 @@ import (
 )
 
 var ErrUndefinedObjectStore = errors.New("the object store does not exist")
+var ErrUndefinedJoinStore = errors.New("the join key-value store does not exist")
 var ErrMessageToBig = errors.New("compressed message exceeds maximum size allowed")
 var ErrMsgAck = "Error in message ack: %s"
 var ErrEmptyPayload = errors.New("the payload cannot be empty")
+var ErrPublishFailed = errors.New("error publishing output")
+var ErrPublishAckTimeout = errors.New("timeout waiting for publish acknowledgement")
+var ErrUndefinedSecretKey = errors.New("the configuration secret key is not defined")
 
 // Wrapper creates a function that returns errors starts with a given message.
 func Wrapper(message string) func(params ...interface{}) error {
@@ -0,0 +1,414 @@
+package kre
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/konstellation-io/kre/libs/simplelogger"
+	"github.com/nats-io/nats.go"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	"github.com/konstellation-io/kre-runners/kre-go/v4/config"
+	utilErrors "github.com/konstellation-io/kre-runners/kre-go/v4/internal/errors"
+)
+
+const (
+	// joinSweepInterval is the shortest interval between join timeout checks
+	joinSweepInterval     = 1 * time.Second
+	maxJoinUpdateAttempts = 10
+)
+
+// JoinHandler is executed once per request when the messages from all the join's nodes have
+// arrived, or when the join times out. Payloads are indexed by the node they come from, on
+// timeout only the payloads that arrived are given.
+type JoinHandler func(ctx *HandlerContext, payloads map[string]*anypb.Any) error
+
+// Join buffers the messages of a request coming from several upstream nodes until all of them
+// have arrived. Buffered payloads are stored in the join key-value store, so they survive restarts.
+type Join struct {
+	name      string
+	fromNodes []string
+	timeout   time.Duration
+	handler   JoinHandler
+}
+
+// NewJoin creates a join waiting for the messages from the given nodes. A timeout of zero means
+// the join waits forever.
+func NewJoin(handler JoinHandler, timeout time.Duration, fromNodes ...string) *Join {
+	nodes := append([]string{}, fromNodes...)
+	sort.Strings(nodes)
+
+	return &Join{
+		name:      "join_" + base64.RawURLEncoding.EncodeToString([]byte(strings.Join(nodes, ","))),
+		fromNodes: nodes,
+		timeout:   timeout,
+		handler:   handler,
+	}
+}
+
+// Handler returns the handler buffering the join's messages.
+func (j *Join) Handler() Handler {
+	return func(ctx *HandlerContext, data *anypb.Any) error {
+		if ctx.joins == nil {
+			return utilErrors.ErrUndefinedJoinStore
+		}
+
+		ctx.joins.register(j)
+
+		fromNode := ctx.reqMsg.FromNode
+		if !j.expects(fromNode) {
+			return fmt.Errorf("join does not expect messages from node %q", fromNode)
+		}
+
+		key := j.key(ctx.GetRequestID())
+
+		state, revision, err := ctx.joins.add(key, ctx.GetRequestID(), "", fromNode, len(j.fromNodes), data)
+		if err != nil {
+			return err
+		}
+
+		if len(state.Payloads) < state.Total {
+			ctx.Logger.Debugf("Join for request %q waiting for %d more messages",
+				ctx.GetRequestID(), state.Total-len(state.Payloads))
+			return nil
+		}
+
+		payloads, err := state.decodePayloads()
+		if err != nil {
+			return err
+		}
+
+		// Removing the state first ensures the join is completed once, and not timed out meanwhile
+		completed, err := ctx.joins.complete(key, revision, ctx.GetRequestID())
+		if err != nil || !completed {
+			return err
+		}
+
+		return j.handler(ctx, payloads)
+	}
+}
+
+// Handlers returns the join's handler indexed by each of the join's nodes, ready to be given to Start.
+func (j *Join) Handlers() map[string]Handler {
+	handler := j.Handler()
+
+	handlers := make(map[string]Handler, len(j.fromNodes))
+	for _, node := range j.fromNodes {
+		handlers[node] = handler
+	}
+
+	return handlers
+}
+
+func (j *Join) bufferName() string {
+	return j.name
+}
+
+func (j *Join) bufferTimeout() time.Duration {
+	return j.timeout
+}
+
+func (j *Join) handleTimeout(ctx *HandlerContext, state *joinState) error {
+	payloads, err := state.decodePayloads()
+	if err != nil {
+		return err
+	}
+
+	return j.handler(ctx, payloads)
+}
+
+func (j *Join) expects(fromNode string) bool {
+	for _, node := range j.fromNodes {
+		if node == fromNode {
+			return true
+		}
+	}
+	return false
+}
+
+func (j *Join) key(requestID string) string {
+	return fmt.Sprintf("%s.%s", j.name, base64.RawURLEncoding.EncodeToString([]byte(requestID)))
+}
+
+// bufferedHandler is implemented by the handlers buffering messages in the join store, so the
+// runner can process their timeouts.
+type bufferedHandler interface {
+	bufferName() string
+	bufferTimeout() time.Duration
+	handleTimeout(ctx *HandlerContext, state *joinState) error
+}
+
+// joinState holds the payloads buffered for a request, indexed by a slot that identifies each
+// expected message, until Total messages have arrived.
+type joinState struct {
+	RequestID string            `json:"requestId"`
+	FromNode  string            `json:"fromNode,omitempty"`
+	StartedAt time.Time         `json:"startedAt"`
+	Total     int               `json:"total"`
+	Payloads  map[string][]byte `json:"payloads"`
+}
+
+func (s *joinState) decodePayloads() (map[string]*anypb.Any, error) {
+	payloads := make(map[string]*anypb.Any, len(s.Payloads))
+
+	for node, data := range s.Payloads {
+		payload := &anypb.Any{}
+
+		err := proto.Unmarshal(data, payload)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding join payload from node %q: %w", node, err)
+		}
+
+		payloads[node] = payload
+	}
+
+	return payloads, nil
+}
+
+type expiredJoin struct {
+	handler  bufferedHandler
+	key      string
+	state    *joinState
+	revision uint64
+}
+
+// JoinStore keeps the state of the node's joins and gathers in a key-value store.
+type JoinStore struct {
+	logger  *simplelogger.SimpleLogger
+	kvStore nats.KeyValue
+	ttl     time.Duration
+	mu      sync.Mutex
+	joins   map[string]bufferedHandler
+}
+
+// NewJoinStore connects to the join key-value store, creating it when missing with a TTL, so the
+// states of joins without timeout, which never time out, are eventually dropped.
+// A nil store is returned when no key-value store is configured.
+func NewJoinStore(
+	cfg config.Config,
+	logger *simplelogger.SimpleLogger,
+	js nats.JetStreamContext,
+) (*JoinStore, error) {
+	wrapErr := utilErrors.Wrapper("join init: %w")
+
+	bucket := cfg.NATS.KeyValueStoreJoinName
+	if bucket == "" {
+		logger.Info("Join key-value store not defined. Skipping join initialization.")
+		return nil, nil
+	}
+
+	kvStore, err := js.KeyValue(bucket)
+	switch {
+	case errors.Is(err, nats.ErrBucketNotFound):
+		kvStore, err = js.CreateKeyValue(&nats.KeyValueConfig{
+			Bucket:  bucket,
+			TTL:     cfg.NATS.JoinTTL,
+			Storage: nats.FileStorage,
+		})
+	case err == nil:
+		_, err = checkBucketTTL(logger, kvStore, cfg.NATS.JoinTTL, "KRT_JOIN_TTL")
+	}
+
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+
+	return &JoinStore{
+		logger:  logger,
+		kvStore: kvStore,
+		ttl:     cfg.NATS.JoinTTL,
+		joins:   make(map[string]bufferedHandler),
+	}, nil
+}
+
+// register makes the handler's timeouts be checked by the runner.
+func (s *JoinStore) register(handler bufferedHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.joins[handler.bufferName()]; !ok && s.ttl > 0 && handler.bufferTimeout() > s.ttl {
+		s.logger.Warnf("Join timeout %s exceeds the join store TTL %s, its states may expire before timing out",
+			handler.bufferTimeout(), s.ttl)
+	}
+
+	s.joins[handler.bufferName()] = handler
+}
+
+func (s *JoinStore) registered() []bufferedHandler {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	joins := make([]bufferedHandler, 0, len(s.joins))
+	for _, join := range s.joins {
+		joins = append(joins, join)
+	}
+
+	return joins
+}
+
+// add stores the payload in the given slot of the state stored with the given key, retrying
+// when another replica updates the same state concurrently.
+func (s *JoinStore) add(
+	key, requestID, fromNode, slot string,
+	total int,
+	payload *anypb.Any,
+) (*joinState, uint64, error) {
+	data, err := proto.Marshal(payload)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error encoding join payload: %w", err)
+	}
+
+	for attempt := 0; attempt < maxJoinUpdateAttempts; attempt++ {
+		state := &joinState{
+			RequestID: requestID,
+			FromNode:  fromNode,
+			StartedAt: time.Now().UTC(),
+			Total:     total,
+			Payloads:  map[string][]byte{},
+		}
+
+		var lastRevision uint64
+
+		entry, err := s.kvStore.Get(key)
+		switch {
+		case errors.Is(err, nats.ErrKeyNotFound):
+		case err != nil:
+			return nil, 0, fmt.Errorf("error retrieving join state for request %q: %w", requestID, err)
+		default:
+			err = json.Unmarshal(entry.Value(), state)
+			if err != nil {
+				return nil, 0, fmt.Errorf("error decoding join state for request %q: %w", requestID, err)
+			}
+			lastRevision = entry.Revision()
+		}
+
+		state.Payloads[slot] = data
+
+		value, err := json.Marshal(state)
+		if err != nil {
+			return nil, 0, fmt.Errorf("error encoding join state for request %q: %w", requestID, err)
+		}
+
+		var revision uint64
+		if lastRevision == 0 {
+			revision, err = s.kvStore.Create(key, value)
+		} else {
+			revision, err = s.kvStore.Update(key, value, lastRevision)
+		}
+
+		if errors.Is(err, nats.ErrKeyExists) {
+			continue
+		}
+
+		if err != nil {
+			return nil, 0, fmt.Errorf("error storing join state for request %q: %w", requestID, err)
+		}
+
+		return state, revision, nil
+	}
+
+	return nil, 0, fmt.Errorf("error storing join state for request %q: too many concurrent updates", requestID)
+}
+
+// remove deletes the state only if it has not changed since the given revision, so a join is
+// completed or timed out by a single replica.
+func (s *JoinStore) remove(key string, revision uint64) error {
+	return s.kvStore.Delete(key, nats.LastRevision(revision))
+}
+
+// complete removes the state of a join that received all its messages, returning false when the
+// state changed since the given revision, as it was already completed or timed out by another
+// replica or the sweeper.
+func (s *JoinStore) complete(key string, revision uint64, requestID string) (bool, error) {
+	err := s.remove(key, revision)
+	if errors.Is(err, nats.ErrKeyExists) {
+		s.logger.Debugf("Join for request %q already processed", requestID)
+		return false, nil
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("error removing join state for request %q: %w", requestID, err)
+	}
+
+	return true, nil
+}
+
+// expired returns the states of the given handlers whose timeout expired, reading the store once
+// for all of them.
+func (s *JoinStore) expired(handlers []bufferedHandler) ([]expiredJoin, error) {
+	timed := make(map[string]bufferedHandler, len(handlers))
+	for _, handler := range handlers {
+		if handler.bufferTimeout() > 0 {
+			timed[handler.bufferName()] = handler
+		}
+	}
+
+	if len(timed) == 0 {
+		return nil, nil
+	}
+
+	watcher, err := s.kvStore.WatchAll(nats.IgnoreDeletes())
+	if err != nil {
+		return nil, fmt.Errorf("error listing join states: %w", err)
+	}
+	defer watcher.Stop()
+
+	var expired []expiredJoin
+
+	for entry := range watcher.Updates() {
+		// a nil entry marks the end of the initial values
+		if entry == nil {
+			break
+		}
+
+		// keys are the handler's name followed by the encoded request ID, which has no dots
+		separator := strings.LastIndex(entry.Key(), ".")
+		if separator < 0 {
+			continue
+		}
+
+		handler, ok := timed[entry.Key()[:separator]]
+		if !ok {
+			continue
+		}
+
+		state := &joinState{}
+
+		err = json.Unmarshal(entry.Value(), state)
+		if err != nil {
+			s.logger.Errorf("Error decoding join state with key %q: %s", entry.Key(), err)
+			continue
+		}
+
+		if time.Since(state.StartedAt) > handler.bufferTimeout() {
+			expired = append(expired, expiredJoin{handler, entry.Key(), state, entry.Revision()})
+		}
+	}
+
+	return expired, nil
+}
+
+// sweepInterval returns the interval between timeout checks of the given handlers, a tenth of the
+// shortest timeout, so timeouts are handled at most 10% late, but no shorter than joinSweepInterval.
+func sweepInterval(handlers []bufferedHandler) time.Duration {
+	interval := time.Duration(0)
+
+	for _, handler := range handlers {
+		if timeout := handler.bufferTimeout() / 10; timeout > 0 && (interval == 0 || timeout < interval) {
+			interval = timeout
+		}
+	}
+
+	if interval < joinSweepInterval {
+		return joinSweepInterval
+	}
+
+	return interval
+}
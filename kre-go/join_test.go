@@ -0,0 +1,140 @@
+//go:build integration
+
+package kre
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	testserver "github.com/nats-io/nats-server/v2/test"
+
+	"github.com/konstellation-io/kre-runners/kre-go/v4/config"
+	"github.com/konstellation-io/kre/libs/simplelogger"
+)
+
+type JoinTestSuite struct {
+	suite.Suite
+	tServer   *server.Server
+	cfg       config.Config
+	nc        *nats.Conn
+	js        nats.JetStreamContext
+	joinStore *JoinStore
+}
+
+func TestJoinTestSuite(t *testing.T) {
+	suite.Run(t, new(JoinTestSuite))
+}
+
+func (suite *JoinTestSuite) SetupSuite() {
+	suite.cfg = config.Config{
+		NATS: config.ConfigNATS{
+			KeyValueStoreJoinName: "kv_join",
+		},
+	}
+
+	testPort := 8332
+	opts := testserver.DefaultTestOptions
+	opts.Port = testPort
+	opts.JetStream = true
+	suite.tServer = testserver.RunServer(&opts)
+
+	var err error
+	suite.nc, err = nats.Connect(fmt.Sprintf("nats://127.0.0.1:%d", testPort))
+	suite.Require().NoError(err)
+
+	suite.js, err = suite.nc.JetStream()
+	suite.Require().NoError(err)
+}
+
+func (suite *JoinTestSuite) TearDownSuite() {
+	suite.nc.Close()
+	suite.tServer.Shutdown()
+}
+
+func (suite *JoinTestSuite) SetupTest() {
+	var err error
+
+	suite.joinStore, err = NewJoinStore(suite.cfg, simplelogger.New(simplelogger.LevelInfo), suite.js)
+	suite.Require().NoError(err)
+}
+
+func (suite *JoinTestSuite) TearDownTest() {
+	err := suite.js.DeleteKeyValue(suite.cfg.NATS.KeyValueStoreJoinName)
+	suite.Require().NoError(err)
+}
+
+func (suite *JoinTestSuite) newPayload(value string) *anypb.Any {
+	payload, err := anypb.New(wrapperspb.String(value))
+	suite.Require().NoError(err)
+
+	return payload
+}
+
+func (suite *JoinTestSuite) TestJoinStoreAddCollectsPayloads() {
+	// GIVEN a join waiting for two nodes
+	join := NewJoin(nil, time.Minute, "nodeA", "nodeB")
+
+	// WHEN the messages of both nodes arrive
+	key := join.key("request")
+
+	state, _, err := suite.joinStore.add(key, "request", "", "nodeA", 2, suite.newPayload("a"))
+	suite.Require().NoError(err)
+	suite.Require().Len(state.Payloads, 1)
+
+	state, revision, err := suite.joinStore.add(key, "request", "", "nodeB", 2, suite.newPayload("b"))
+	suite.Require().NoError(err)
+
+	// THEN the state holds both payloads
+	payloads, err := state.decodePayloads()
+	suite.Require().NoError(err)
+	suite.Require().Len(payloads, 2)
+
+	value := &wrapperspb.StringValue{}
+	suite.Require().NoError(payloads["nodeB"].UnmarshalTo(value))
+	suite.Equal("b", value.Value)
+
+	// THEN the state can be removed given its last revision
+	suite.Require().NoError(suite.joinStore.remove(key, revision))
+}
+
+func (suite *JoinTestSuite) TestJoinStoreExpired() {
+	// GIVEN a join with a short timeout and a pending request
+	join := NewJoin(nil, 10*time.Millisecond, "nodeA", "nodeB")
+
+	_, _, err := suite.joinStore.add(join.key("request"), "request", "", "nodeA", 2, suite.newPayload("a"))
+	suite.Require().NoError(err)
+
+	// WHEN the timeout expires
+	time.Sleep(20 * time.Millisecond)
+
+	// THEN the pending request is expired
+	expired, err := suite.joinStore.expired([]bufferedHandler{join, NewJoin(nil, time.Hour, "nodeC")})
+	suite.Require().NoError(err)
+	suite.Require().Len(expired, 1)
+	suite.Equal("request", expired[0].state.RequestID)
+	suite.Equal(join, expired[0].handler)
+}
+
+func (suite *JoinTestSuite) TestJoinStoreRemoveOutdatedRevision() {
+	// GIVEN a pending request updated after reading its revision
+	join := NewJoin(nil, time.Minute, "nodeA", "nodeB", "nodeC")
+
+	key := join.key("request")
+
+	_, revision, err := suite.joinStore.add(key, "request", "", "nodeA", 3, suite.newPayload("a"))
+	suite.Require().NoError(err)
+
+	_, _, err = suite.joinStore.add(key, "request", "", "nodeB", 3, suite.newPayload("b"))
+	suite.Require().NoError(err)
+
+	// WHEN removing it with the outdated revision
+	// THEN it fails
+	suite.Require().Error(suite.joinStore.remove(key, revision))
+}
@@ -0,0 +1,144 @@
+package kre
+
+import (
+	"context"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"golang.org/x/time/rate"
+
+	"github.com/konstellation-io/kre-runners/kre-go/v4/config"
+)
+
+// limiter applies the configured rate limits and concurrency caps, globally and per upstream
+// node, before a message is given to its handler.
+type limiter struct {
+	global *limit
+	nodes  map[string]*limit
+}
+
+type limit struct {
+	rate *rate.Limiter
+	sem  chan struct{}
+}
+
+func newLimit(ratePerSecond float64, burst, maxConcurrency int) *limit {
+	if ratePerSecond <= 0 && maxConcurrency <= 0 {
+		return nil
+	}
+
+	l := &limit{}
+
+	if ratePerSecond > 0 {
+		if burst < 1 {
+			burst = 1
+		}
+		l.rate = rate.NewLimiter(rate.Limit(ratePerSecond), burst)
+	}
+
+	if maxConcurrency > 0 {
+		l.sem = make(chan struct{}, maxConcurrency)
+	}
+
+	return l
+}
+
+// newLimiter returns nil when no limits are configured.
+func newLimiter(cfg config.Limits) *limiter {
+	l := &limiter{
+		global: newLimit(cfg.RateLimit, cfg.RateLimitBurst, cfg.MaxConcurrency),
+		nodes:  make(map[string]*limit),
+	}
+
+	for node := range limitedNodes(cfg) {
+		if nodeLimit := newLimit(cfg.NodeRateLimits[node], cfg.RateLimitBurst, cfg.NodeMaxConcurrency[node]); nodeLimit != nil {
+			l.nodes[node] = nodeLimit
+		}
+	}
+
+	if l.global == nil && len(l.nodes) == 0 {
+		return nil
+	}
+
+	return l
+}
+
+func limitedNodes(cfg config.Limits) map[string]bool {
+	nodes := make(map[string]bool)
+	for node := range cfg.NodeRateLimits {
+		nodes[node] = true
+	}
+	for node := range cfg.NodeMaxConcurrency {
+		nodes[node] = true
+	}
+
+	return nodes
+}
+
+// limits returns the limits applying to the messages coming from the given node.
+func (l *limiter) limits(fromNode string) []*limit {
+	limits := make([]*limit, 0, 2)
+	if nodeLimit, ok := l.nodes[fromNode]; ok {
+		limits = append(limits, nodeLimit)
+	}
+	if l.global != nil {
+		limits = append(limits, l.global)
+	}
+
+	return limits
+}
+
+// limited reports whether the messages coming from the given node must wait for the limiter.
+func (l *limiter) limited(fromNode string) bool {
+	return len(l.limits(fromNode)) > 0
+}
+
+// acquire waits until the message coming from the given node can be handled. The returned
+// function must be called once the handler has finished.
+func (l *limiter) acquire(ctx context.Context, fromNode string) (func(), error) {
+	limits := l.limits(fromNode)
+
+	var acquired []*limit
+	release := func() {
+		for _, lim := range acquired {
+			<-lim.sem
+		}
+	}
+
+	for _, lim := range limits {
+		if lim.rate != nil {
+			if err := lim.rate.Wait(ctx); err != nil {
+				release()
+				return nil, err
+			}
+		}
+
+		if lim.sem != nil {
+			select {
+			case lim.sem <- struct{}{}:
+				acquired = append(acquired, lim)
+			case <-ctx.Done():
+				release()
+				return nil, ctx.Err()
+			}
+		}
+	}
+
+	return release, nil
+}
+
+// processLimitedMessage waits for the limiter before processing the message, telling JetStream
+// the message is still in progress while it waits.
+func (r *Runner) processLimitedMessage(msg *nats.Msg, requestMsg *KreNatsMessage, start time.Time) {
+	stopInProgress := r.keepInProgress(msg, r.cfg.NATS.InProgressInterval)
+	release, err := r.limiter.acquire(context.Background(), requestMsg.FromNode)
+	stopInProgress()
+
+	if err != nil {
+		r.logger.Errorf("Error waiting for limits of node %q: %s", requestMsg.FromNode, err)
+		return
+	}
+	defer release()
+
+	r.processRequest(msg, requestMsg, start)
+}
@@ -0,0 +1,66 @@
+//go:build unit
+
+package kre
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/konstellation-io/kre-runners/kre-go/v4/config"
+)
+
+type LimiterTestSuite struct {
+	suite.Suite
+}
+
+func TestLimiterTestSuite(t *testing.T) {
+	suite.Run(t, new(LimiterTestSuite))
+}
+
+func (suite *LimiterTestSuite) TestNewLimiterWithoutLimits() {
+	suite.Nil(newLimiter(config.Limits{}))
+}
+
+func (suite *LimiterTestSuite) TestAcquireRespectsNodeConcurrency() {
+	// GIVEN a limiter allowing a single concurrent message from nodeA
+	l := newLimiter(config.Limits{
+		NodeMaxConcurrency: map[string]int{"nodeA": 1},
+	})
+	suite.Require().NotNil(l)
+
+	release, err := l.acquire(context.Background(), "nodeA")
+	suite.Require().NoError(err)
+
+	// WHEN another message from nodeA arrives
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	// THEN it waits until the first one is released
+	_, err = l.acquire(ctx, "nodeA")
+	suite.Require().ErrorIs(err, context.DeadlineExceeded)
+
+	// THEN messages from other nodes are not limited
+	releaseB, err := l.acquire(context.Background(), "nodeB")
+	suite.Require().NoError(err)
+	releaseB()
+
+	release()
+
+	release, err = l.acquire(context.Background(), "nodeA")
+	suite.Require().NoError(err)
+	release()
+}
+
+func (suite *LimiterTestSuite) TestLimited() {
+	l := newLimiter(config.Limits{NodeMaxConcurrency: map[string]int{"nodeA": 1}})
+
+	suite.True(l.limited("nodeA"))
+	suite.False(l.limited("nodeB"))
+
+	l = newLimiter(config.Limits{RateLimit: 1})
+
+	suite.True(l.limited("nodeB"))
+}
@@ -1,10 +1,9 @@
 package kre
 
 import (
-	"fmt"
+	"context"
 	"os"
 	"os/signal"
-	"strings"
 	"syscall"
 	"time"
 
@@ -13,9 +12,12 @@ import (
 	"google.golang.org/protobuf/types/known/anypb"
 
 	"github.com/konstellation-io/kre-runners/kre-go/v4/config"
+	"github.com/konstellation-io/kre-runners/kre-go/v4/docstore"
 	"github.com/konstellation-io/kre-runners/kre-go/v4/mongodb"
 )
 
+const databasePingTimeout = 2 * time.Second
+
 // HandlerInit is executed once. It is useful to initialize variables that will be constants
 // between handler calls.
 type HandlerInit func(ctx *HandlerContext)
@@ -29,7 +31,11 @@ type Handler func(ctx *HandlerContext, data *anypb.Any) error
 // connects to NATS and MongoDB and processes all incoming messages.
 func Start(handlerInit HandlerInit, defaultHandler Handler, handlersOpt ...map[string]Handler) {
 	logger := simplelogger.New(simplelogger.LevelInfo)
-	cfg := config.NewConfig(logger)
+	cfg, err := config.NewConfig(logger)
+	if err != nil {
+		logger.Errorf("Error reading config: %s", err)
+		os.Exit(1)
+	}
 
 	noHandlersDefined := handlersOpt == nil || len(handlersOpt) < 1
 	if defaultHandler == nil && noHandlersDefined {
@@ -44,14 +50,35 @@ func Start(handlerInit HandlerInit, defaultHandler Handler, handlersOpt ...map[s
 
 	handlerManager := NewHandlerManager(defaultHandler, customHandler)
 
-	mongoManager := mongodb.NewMongoManager(cfg, logger)
-	err := mongoManager.Connect()
+	run(logger, cfg, handlerInit, handlerManager, nil)
+}
+
+// StartBatch works as Start, but the given batch handler receives the incoming messages in
+// batches of up to KRT_BATCH_SIZE messages, or whatever arrived within KRT_BATCH_MAX_WAIT.
+func StartBatch(handlerInit HandlerInit, batchHandler BatchHandler) {
+	logger := simplelogger.New(simplelogger.LevelInfo)
+	cfg, err := config.NewConfig(logger)
 	if err != nil {
-		logger.Errorf("Error connecting to MongoDB: %s", err)
+		logger.Errorf("Error reading config: %s", err)
+		os.Exit(1)
+	}
+
+	if batchHandler == nil {
+		logger.Errorf("No batch handler detected")
 		os.Exit(1)
 	}
 
-	nc, err := nats.Connect(cfg.NATS.Server)
+	run(logger, cfg, handlerInit, NewHandlerManager(nil, nil), batchHandler)
+}
+
+func run(
+	logger *simplelogger.SimpleLogger,
+	cfg config.Config,
+	handlerInit HandlerInit,
+	handlerManager *HandlerManager,
+	batchHandler BatchHandler,
+) {
+	nc, err := connectNATS(cfg, logger)
 	if err != nil {
 		logger.Errorf("Error connecting to NATS: %s", err)
 		os.Exit(1)
@@ -64,6 +91,28 @@ func Start(handlerInit HandlerInit, defaultHandler Handler, handlersOpt ...map[s
 		os.Exit(1)
 	}
 
+	mongoManager := newDatabaseBackend(cfg, logger, js)
+	err = mongoManager.Connect()
+	if err != nil {
+		logger.Errorf("Error connecting to the %s database: %s", cfg.Database.Backend, err)
+		os.Exit(1)
+	}
+
+	if cfg.Health.Address != "" {
+		health := NewHealthServer(logger)
+		health.AddLivenessCheck("nats", natsLivenessCheck(nc))
+		health.AddReadinessCheck("nats", natsReadinessCheck(nc))
+		if cfg.Health.DatabaseReadiness {
+			health.AddReadinessCheck("database", databaseReadinessCheck(mongoManager))
+		}
+
+		go func() {
+			if err := health.Serve(cfg.Health.Address); err != nil {
+				logger.Errorf("Error serving health checks: %s", err)
+			}
+		}()
+	}
+
 	contextObjectStore, err := NewContextObjectStore(cfg, logger, js)
 	if err != nil {
 		logger.Errorf("Error connecting to object stores: %s", err)
@@ -76,6 +125,18 @@ func Start(handlerInit HandlerInit, defaultHandler Handler, handlersOpt ...map[s
 		os.Exit(1)
 	}
 
+	idempotencyStore, err := NewIdempotencyStore(cfg, logger, js)
+	if err != nil {
+		logger.Errorf("Error connecting to idempotency store: %s", err)
+		os.Exit(1)
+	}
+
+	joinStore, err := NewJoinStore(cfg, logger, js)
+	if err != nil {
+		logger.Errorf("Error connecting to join store: %s", err)
+		os.Exit(1)
+	}
+
 	// Handle incoming messages from NATS
 	runner := NewRunner(&RunnerParams{
 		Logger:               logger,
@@ -87,28 +148,20 @@ func Start(handlerInit HandlerInit, defaultHandler Handler, handlersOpt ...map[s
 		MongoManager:         mongoManager,
 		ContextObjectStore:   contextObjectStore,
 		ContextConfiguration: contextConfiguration,
+		IdempotencyStore:     idempotencyStore,
+		JoinStore:            joinStore,
+		BatchHandler:         batchHandler,
 	})
 
-	var subscriptions []*nats.Subscription
-	for _, subject := range cfg.NATS.InputSubjects {
-		consumerName := fmt.Sprintf("%s-%s", strings.ReplaceAll(subject, ".", "-"), cfg.NodeName)
-
-		s, err := js.QueueSubscribe(
-			subject,
-			consumerName,
-			runner.ProcessMessage,
-			nats.DeliverNew(),
-			nats.Durable(consumerName),
-			nats.ManualAck(),
-			nats.AckWait(22*time.Hour),
-			nats.MaxAckPending(cfg.NATS.MaxPendingAck),
-		)
-		if err != nil {
-			logger.Errorf("Error subscribing to NATS subject %s: %s", subject, err)
-			os.Exit(1)
-		}
-		subscriptions = append(subscriptions, s)
-		logger.Infof("Listening to '%s' subject with queue group %s", subject, consumerName)
+	processMessage := runner.ProcessMessage
+	if batchHandler != nil {
+		processMessage = runner.EnqueueMessage
+	}
+
+	subscriptions, err := subscribe(cfg, logger, js, processMessage)
+	if err != nil {
+		logger.Errorf("Error subscribing to NATS: %s", err)
+		os.Exit(1)
 	}
 
 	// Handle sigterm and await termChan signal
@@ -125,4 +178,41 @@ func Start(handlerInit HandlerInit, defaultHandler Handler, handlersOpt ...map[s
 			os.Exit(1)
 		}
 	}
+
+	runner.Shutdown()
+
+	// saved documents are flushed by the runner before disconnecting
+	if err := mongoManager.Disconnect(); err != nil {
+		logger.Errorf("Error disconnecting from the %s database: %s", cfg.Database.Backend, err)
+	}
+}
+
+// newDatabaseBackend returns the manager of the configured handler context database backend.
+func newDatabaseBackend(
+	cfg config.Config,
+	logger *simplelogger.SimpleLogger,
+	js nats.JetStreamContext,
+) mongodb.Manager {
+	switch cfg.Database.Backend {
+	case config.FileBackend:
+		return docstore.NewFileStore(logger, cfg.Database.Dir)
+	case config.MemoryBackend:
+		logger.Warn("Documents of the memory database backend are not persisted, they are lost when the runner stops")
+		return docstore.NewMemoryStore(logger)
+	case config.KVBackend:
+		return docstore.NewKVStore(logger, js, cfg.Database.KVBucket)
+	default:
+		return mongodb.NewMongoManager(cfg, logger)
+	}
+}
+
+// databaseReadinessCheck fails while the database doesn't answer, e.g. MongoDB being unavailable
+// or still connecting in the background.
+func databaseReadinessCheck(db mongodb.Manager) HealthCheck {
+	return func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), databasePingTimeout)
+		defer cancel()
+
+		return db.Ping(ctx)
+	}
 }
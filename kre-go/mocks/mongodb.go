@@ -7,7 +7,10 @@ package mocks
 import (
 	context "context"
 	gomock "github.com/golang/mock/gomock"
+	mongodb "github.com/konstellation-io/kre-runners/kre-go/v4/mongodb"
 	bson "go.mongodb.org/mongo-driver/bson"
+	mongo "go.mongodb.org/mongo-driver/mongo"
+	options "go.mongodb.org/mongo-driver/mongo/options"
 	reflect "reflect"
 )
 
@@ -62,6 +65,20 @@ func (mr *MockManagerMockRecorder) Disconnect() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Disconnect", reflect.TypeOf((*MockManager)(nil).Disconnect))
 }
 
+// Ping mocks base method
+func (m *MockManager) Ping(arg0 context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Ping", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Ping indicates an expected call of Ping
+func (mr *MockManagerMockRecorder) Ping(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ping", reflect.TypeOf((*MockManager)(nil).Ping), arg0)
+}
+
 // Find mocks base method
 func (m *MockManager) Find(arg0 context.Context, arg1 string, arg2 bson.M, arg3 interface{}) error {
 	m.ctrl.T.Helper()
@@ -75,3 +92,194 @@ func (mr *MockManagerMockRecorder) Find(arg0, arg1, arg2, arg3 interface{}) *gom
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Find", reflect.TypeOf((*MockManager)(nil).Find), arg0, arg1, arg2, arg3)
 }
+
+// FindOne mocks base method
+func (m *MockManager) FindOne(arg0 context.Context, arg1 string, arg2 bson.M, arg3 *options.FindOneOptions, arg4 interface{}) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindOne", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// FindOne indicates an expected call of FindOne
+func (mr *MockManagerMockRecorder) FindOne(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindOne", reflect.TypeOf((*MockManager)(nil).FindOne), arg0, arg1, arg2, arg3, arg4)
+}
+
+// FindWithOptions mocks base method
+func (m *MockManager) FindWithOptions(arg0 context.Context, arg1 string, arg2 bson.M, arg3 *options.FindOptions, arg4 interface{}) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindWithOptions", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// FindWithOptions indicates an expected call of FindWithOptions
+func (mr *MockManagerMockRecorder) FindWithOptions(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindWithOptions", reflect.TypeOf((*MockManager)(nil).FindWithOptions), arg0, arg1, arg2, arg3, arg4)
+}
+
+// Cursor mocks base method
+func (m *MockManager) Cursor(arg0 context.Context, arg1 string, arg2 bson.M, arg3 *options.FindOptions) (mongodb.Cursor, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Cursor", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(mongodb.Cursor)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Cursor indicates an expected call of Cursor
+func (mr *MockManagerMockRecorder) Cursor(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Cursor", reflect.TypeOf((*MockManager)(nil).Cursor), arg0, arg1, arg2, arg3)
+}
+
+// Count mocks base method
+func (m *MockManager) Count(arg0 context.Context, arg1 string, arg2 bson.M) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Count", arg0, arg1, arg2)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Count indicates an expected call of Count
+func (mr *MockManagerMockRecorder) Count(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Count", reflect.TypeOf((*MockManager)(nil).Count), arg0, arg1, arg2)
+}
+
+// Distinct mocks base method
+func (m *MockManager) Distinct(arg0 context.Context, arg1 string, arg2 string, arg3 bson.M) ([]interface{}, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Distinct", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].([]interface{})
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Distinct indicates an expected call of Distinct
+func (mr *MockManagerMockRecorder) Distinct(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Distinct", reflect.TypeOf((*MockManager)(nil).Distinct), arg0, arg1, arg2, arg3)
+}
+
+// Aggregate mocks base method
+func (m *MockManager) Aggregate(arg0 context.Context, arg1 string, arg2 []bson.M, arg3 interface{}) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Aggregate", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Aggregate indicates an expected call of Aggregate
+func (mr *MockManagerMockRecorder) Aggregate(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Aggregate", reflect.TypeOf((*MockManager)(nil).Aggregate), arg0, arg1, arg2, arg3)
+}
+
+// UpdateOne mocks base method
+func (m *MockManager) UpdateOne(arg0 context.Context, arg1 string, arg2 bson.M, arg3 bson.M, arg4 *options.UpdateOptions) (*mongo.UpdateResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateOne", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].(*mongo.UpdateResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateOne indicates an expected call of UpdateOne
+func (mr *MockManagerMockRecorder) UpdateOne(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateOne", reflect.TypeOf((*MockManager)(nil).UpdateOne), arg0, arg1, arg2, arg3, arg4)
+}
+
+// UpdateMany mocks base method
+func (m *MockManager) UpdateMany(arg0 context.Context, arg1 string, arg2 bson.M, arg3 bson.M, arg4 *options.UpdateOptions) (*mongo.UpdateResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateMany", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].(*mongo.UpdateResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateMany indicates an expected call of UpdateMany
+func (mr *MockManagerMockRecorder) UpdateMany(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateMany", reflect.TypeOf((*MockManager)(nil).UpdateMany), arg0, arg1, arg2, arg3, arg4)
+}
+
+// DeleteOne mocks base method
+func (m *MockManager) DeleteOne(arg0 context.Context, arg1 string, arg2 bson.M) (*mongo.DeleteResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteOne", arg0, arg1, arg2)
+	ret0, _ := ret[0].(*mongo.DeleteResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteOne indicates an expected call of DeleteOne
+func (mr *MockManagerMockRecorder) DeleteOne(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteOne", reflect.TypeOf((*MockManager)(nil).DeleteOne), arg0, arg1, arg2)
+}
+
+// DeleteMany mocks base method
+func (m *MockManager) DeleteMany(arg0 context.Context, arg1 string, arg2 bson.M) (*mongo.DeleteResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteMany", arg0, arg1, arg2)
+	ret0, _ := ret[0].(*mongo.DeleteResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteMany indicates an expected call of DeleteMany
+func (mr *MockManagerMockRecorder) DeleteMany(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteMany", reflect.TypeOf((*MockManager)(nil).DeleteMany), arg0, arg1, arg2)
+}
+
+// BulkWrite mocks base method
+func (m *MockManager) BulkWrite(arg0 context.Context, arg1 string, arg2 []mongo.WriteModel, arg3 *options.BulkWriteOptions) (*mongo.BulkWriteResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BulkWrite", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(*mongo.BulkWriteResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// BulkWrite indicates an expected call of BulkWrite
+func (mr *MockManagerMockRecorder) BulkWrite(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BulkWrite", reflect.TypeOf((*MockManager)(nil).BulkWrite), arg0, arg1, arg2, arg3)
+}
+
+// InsertMany mocks base method
+func (m *MockManager) InsertMany(arg0 context.Context, arg1 string, arg2 []interface{}) ([]interface{}, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertMany", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]interface{})
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// InsertMany indicates an expected call of InsertMany
+func (mr *MockManagerMockRecorder) InsertMany(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertMany", reflect.TypeOf((*MockManager)(nil).InsertMany), arg0, arg1, arg2)
+}
+
+// CreateIndexes mocks base method
+func (m *MockManager) CreateIndexes(arg0 context.Context, arg1 string, arg2 []mongo.IndexModel) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateIndexes", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateIndexes indicates an expected call of CreateIndexes
+func (mr *MockManagerMockRecorder) CreateIndexes(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateIndexes", reflect.TypeOf((*MockManager)(nil).CreateIndexes), arg0, arg1, arg2)
+}
@@ -4,6 +4,8 @@ package mongodb
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/konstellation-io/kre/libs/simplelogger"
@@ -11,6 +13,7 @@ import (
 
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 
 	"github.com/konstellation-io/kre-runners/kre-go/v4/config"
 )
@@ -19,57 +22,180 @@ type MongoDB struct {
 	cfg    config.Config
 	logger *simplelogger.SimpleLogger
 	client *mongo.Client
+	stop   context.CancelFunc
 }
 
+// ErrNotConnected is returned by Ping until the client is created by Connect.
+var ErrNotConnected = errors.New("MongoDB client not connected")
+
 type Manager interface {
 	Connect() error
 	Disconnect() error
+	Ping(context.Context) error
 	Find(context.Context, string, bson.M, interface{}) error
+	FindOne(context.Context, string, bson.M, *options.FindOneOptions, interface{}) error
+	FindWithOptions(context.Context, string, bson.M, *options.FindOptions, interface{}) error
+	Cursor(context.Context, string, bson.M, *options.FindOptions) (Cursor, error)
+	Count(context.Context, string, bson.M) (int64, error)
+	Distinct(context.Context, string, string, bson.M) ([]interface{}, error)
+	Aggregate(context.Context, string, []bson.M, interface{}) error
+	UpdateOne(context.Context, string, bson.M, bson.M, *options.UpdateOptions) (*mongo.UpdateResult, error)
+	UpdateMany(context.Context, string, bson.M, bson.M, *options.UpdateOptions) (*mongo.UpdateResult, error)
+	DeleteOne(context.Context, string, bson.M) (*mongo.DeleteResult, error)
+	DeleteMany(context.Context, string, bson.M) (*mongo.DeleteResult, error)
+	BulkWrite(context.Context, string, []mongo.WriteModel, *options.BulkWriteOptions) (*mongo.BulkWriteResult, error)
+	InsertMany(context.Context, string, []interface{}) ([]interface{}, error)
+	CreateIndexes(context.Context, string, []mongo.IndexModel) error
+}
+
+// Cursor iterates over the documents of a query, as *mongo.Cursor does.
+type Cursor interface {
+	Next(ctx context.Context) bool
+	Decode(val interface{}) error
+	Err() error
+	Close(ctx context.Context) error
 }
 
 func NewMongoManager(cfg config.Config, logger *simplelogger.SimpleLogger) *MongoDB {
 	return &MongoDB{
-		cfg,
-		logger,
-		nil,
+		cfg:    cfg,
+		logger: logger,
+	}
+}
+
+// clientOptions applies the connection settings on top of the ones of the URI.
+func clientOptions(cfg config.MongoDB) (*options.ClientOptions, error) {
+	opts := options.Client().
+		ApplyURI(cfg.Address).
+		SetRetryReads(cfg.RetryReads).
+		SetRetryWrites(cfg.RetryWrites)
+
+	if cfg.Username != "" {
+		opts.SetAuth(options.Credential{
+			Username:   cfg.Username,
+			Password:   cfg.Password,
+			AuthSource: cfg.AuthSource,
+		})
+	}
+
+	if cfg.MaxPoolSize > 0 {
+		opts.SetMaxPoolSize(uint64(cfg.MaxPoolSize))
+	}
+
+	if cfg.MinPoolSize > 0 {
+		opts.SetMinPoolSize(uint64(cfg.MinPoolSize))
 	}
+
+	if cfg.ServerSelectionTimeout > 0 {
+		opts.SetServerSelectionTimeout(cfg.ServerSelectionTimeout)
+	}
+
+	if cfg.ReadPreference != "" {
+		mode, err := readpref.ModeFromString(cfg.ReadPreference)
+		if err != nil {
+			return nil, err
+		}
+
+		readPref, err := readpref.New(mode)
+		if err != nil {
+			return nil, err
+		}
+
+		opts.SetReadPreference(readPref)
+	}
+
+	return opts, opts.Validate()
 }
 
+// Connect creates the client and waits until MongoDB answers, retrying every
+// KRT_MONGO_CONNECT_RETRY_INTERVAL for up to KRT_MONGO_CONN_TIMEOUT seconds. With lazy connection
+// it returns once the client is created, connecting in the background, so the operations fail
+// after the server selection timeout while MongoDB is unavailable.
 func (m *MongoDB) Connect() error {
 	m.logger.Info("MongoDB connecting...")
 
-	client, err := mongo.NewClient(options.Client().ApplyURI(m.cfg.MongoDB.Address))
+	opts, err := clientOptions(m.cfg.MongoDB)
+	if err != nil {
+		return fmt.Errorf("invalid MongoDB options: %w", err)
+	}
+
+	// the client connects in the background, so it is only created here
+	client, err := mongo.Connect(context.Background(), opts)
 	if err != nil {
 		return err
 	}
 
+	m.client = client
+
+	if m.cfg.MongoDB.LazyConnect {
+		ctx, stop := context.WithCancel(context.Background())
+		m.stop = stop
+
+		go func() {
+			if err := m.waitConnection(ctx); err != nil && ctx.Err() == nil {
+				m.logger.Errorf("Error connecting to MongoDB: %s", err)
+			}
+		}()
+
+		return nil
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(m.cfg.MongoDB.ConnTimeout)*time.Second)
 	defer cancel()
 
-	err = client.Connect(ctx)
+	err = m.waitConnection(ctx)
 	if err != nil {
+		// the client keeps connecting in the background until disconnected
+		disconnectErr := client.Disconnect(context.Background())
+		if disconnectErr != nil {
+			m.logger.Warnf("Error disconnecting from MongoDB: %s", disconnectErr)
+		}
+
+		m.client = nil
+
 		return err
 	}
 
-	// Call Ping to verify that the deployment is up and the Client was configured successfully.
-	ctx, cancel = context.WithTimeout(context.Background(), time.Duration(m.cfg.MongoDB.ConnTimeout)*time.Second)
-	defer cancel()
+	return nil
+}
 
-	m.logger.Info("MongoDB ping...")
-	err = client.Ping(ctx, nil)
-	if err != nil {
-		return err
+// waitConnection pings MongoDB until it answers or the context is done.
+func (m *MongoDB) waitConnection(ctx context.Context) error {
+	for {
+		m.logger.Info("MongoDB ping...")
+
+		err := m.Ping(ctx)
+		if err == nil {
+			m.logger.Info("MongoDB connected")
+			return nil
+		}
+
+		m.logger.Warnf("MongoDB not available, retrying in %s: %s", m.cfg.MongoDB.ConnectRetryInterval, err)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(m.cfg.MongoDB.ConnectRetryInterval):
+		}
 	}
+}
 
-	m.logger.Info("MongoDB connected")
-	m.client = client
+// Ping checks that MongoDB answers, for the readiness probe.
+func (m *MongoDB) Ping(ctx context.Context) error {
+	if m.client == nil {
+		return ErrNotConnected
+	}
 
-	return nil
+	return m.client.Ping(ctx, nil)
 }
 
 func (m *MongoDB) Disconnect() error {
 	m.logger.Info("MongoDB disconnecting...")
 
+	if m.stop != nil {
+		m.stop()
+	}
+
 	if m.client == nil {
 		return nil
 	}
@@ -96,3 +222,107 @@ func (m *MongoDB) Find(ctx context.Context, colName string, filter bson.M, resul
 
 	return nil
 }
+
+func (m *MongoDB) collection(colName string) *mongo.Collection {
+	return m.client.Database(m.cfg.MongoDB.DataDBName).Collection(colName)
+}
+
+func (m *MongoDB) FindOne(
+	ctx context.Context,
+	colName string,
+	filter bson.M,
+	opts *options.FindOneOptions,
+	result interface{},
+) error {
+	return m.collection(colName).FindOne(ctx, filter, opts).Decode(result)
+}
+
+func (m *MongoDB) FindWithOptions(
+	ctx context.Context,
+	colName string,
+	filter bson.M,
+	opts *options.FindOptions,
+	results interface{},
+) error {
+	cursor, err := m.collection(colName).Find(ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+
+	return cursor.All(ctx, results)
+}
+
+func (m *MongoDB) Cursor(ctx context.Context, colName string, filter bson.M, opts *options.FindOptions) (Cursor, error) {
+	cursor, err := m.collection(colName).Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return cursor, nil
+}
+
+func (m *MongoDB) Count(ctx context.Context, colName string, filter bson.M) (int64, error) {
+	return m.collection(colName).CountDocuments(ctx, filter)
+}
+
+func (m *MongoDB) Distinct(ctx context.Context, colName, field string, filter bson.M) ([]interface{}, error) {
+	return m.collection(colName).Distinct(ctx, field, filter)
+}
+
+func (m *MongoDB) Aggregate(ctx context.Context, colName string, pipeline []bson.M, results interface{}) error {
+	cursor, err := m.collection(colName).Aggregate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+
+	return cursor.All(ctx, results)
+}
+
+func (m *MongoDB) UpdateOne(
+	ctx context.Context,
+	colName string,
+	filter, update bson.M,
+	opts *options.UpdateOptions,
+) (*mongo.UpdateResult, error) {
+	return m.collection(colName).UpdateOne(ctx, filter, update, opts)
+}
+
+func (m *MongoDB) UpdateMany(
+	ctx context.Context,
+	colName string,
+	filter, update bson.M,
+	opts *options.UpdateOptions,
+) (*mongo.UpdateResult, error) {
+	return m.collection(colName).UpdateMany(ctx, filter, update, opts)
+}
+
+func (m *MongoDB) DeleteOne(ctx context.Context, colName string, filter bson.M) (*mongo.DeleteResult, error) {
+	return m.collection(colName).DeleteOne(ctx, filter)
+}
+
+func (m *MongoDB) DeleteMany(ctx context.Context, colName string, filter bson.M) (*mongo.DeleteResult, error) {
+	return m.collection(colName).DeleteMany(ctx, filter)
+}
+
+func (m *MongoDB) BulkWrite(
+	ctx context.Context,
+	colName string,
+	models []mongo.WriteModel,
+	opts *options.BulkWriteOptions,
+) (*mongo.BulkWriteResult, error) {
+	return m.collection(colName).BulkWrite(ctx, models, opts)
+}
+
+func (m *MongoDB) InsertMany(ctx context.Context, colName string, docs []interface{}) ([]interface{}, error) {
+	res, err := m.collection(colName).InsertMany(ctx, docs)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.InsertedIDs, nil
+}
+
+func (m *MongoDB) CreateIndexes(ctx context.Context, colName string, indexes []mongo.IndexModel) error {
+	_, err := m.collection(colName).Indexes().CreateMany(ctx, indexes)
+	return err
+}
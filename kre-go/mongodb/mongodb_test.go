@@ -0,0 +1,109 @@
+//go:build unit
+
+package mongodb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/konstellation-io/kre/libs/simplelogger"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+
+	"github.com/konstellation-io/kre-runners/kre-go/v4/config"
+)
+
+type MongoDBTestSuite struct {
+	suite.Suite
+	logger *simplelogger.SimpleLogger
+}
+
+func TestMongoDBTestSuite(t *testing.T) {
+	suite.Run(t, new(MongoDBTestSuite))
+}
+
+func (suite *MongoDBTestSuite) SetupTest() {
+	suite.logger = simplelogger.New(simplelogger.LevelInfo)
+}
+
+func (suite *MongoDBTestSuite) TestClientOptions() {
+	// GIVEN connection settings overriding the URI ones
+	cfg := config.MongoDB{
+		Address:                "mongodb://localhost:27017/?maxPoolSize=5&retryWrites=true",
+		Username:               "user",
+		Password:               "secret",
+		AuthSource:             "admin",
+		MaxPoolSize:            20,
+		MinPoolSize:            2,
+		ReadPreference:         "secondaryPreferred",
+		ServerSelectionTimeout: 3 * time.Second,
+		RetryReads:             true,
+		RetryWrites:            false,
+	}
+
+	// WHEN the client options are built
+	opts, err := clientOptions(cfg)
+
+	// THEN the settings are applied
+	suite.Require().NoError(err)
+	suite.EqualValues(20, *opts.MaxPoolSize)
+	suite.EqualValues(2, *opts.MinPoolSize)
+	suite.Equal(readpref.SecondaryPreferredMode, opts.ReadPreference.Mode())
+	suite.Equal(3*time.Second, *opts.ServerSelectionTimeout)
+	suite.True(*opts.RetryReads)
+	suite.False(*opts.RetryWrites)
+	suite.Equal("user", opts.Auth.Username)
+	suite.Equal("admin", opts.Auth.AuthSource)
+}
+
+func (suite *MongoDBTestSuite) TestClientOptionsKeepURIPoolSize() {
+	opts, err := clientOptions(config.MongoDB{Address: "mongodb://localhost:27017/?maxPoolSize=5"})
+
+	suite.Require().NoError(err)
+	suite.EqualValues(5, *opts.MaxPoolSize)
+	suite.Nil(opts.Auth)
+}
+
+func (suite *MongoDBTestSuite) TestLazyConnectWithoutMongoDB() {
+	// GIVEN a lazy connection to an unavailable MongoDB
+	cfg := config.Config{MongoDB: config.MongoDB{
+		Address:                "mongodb://127.0.0.1:1",
+		ConnTimeout:            1,
+		ServerSelectionTimeout: 100 * time.Millisecond,
+		LazyConnect:            true,
+		ConnectRetryInterval:   time.Hour,
+	}}
+	m := NewMongoManager(cfg, suite.logger)
+
+	// WHEN it connects
+	err := m.Connect()
+
+	// THEN it doesn't wait for MongoDB, which is reported as unavailable
+	suite.Require().NoError(err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	suite.Error(m.Ping(ctx))
+
+	suite.NoError(m.Disconnect())
+}
+
+func (suite *MongoDBTestSuite) TestConnectWithoutMongoDB() {
+	// GIVEN an unavailable MongoDB
+	cfg := config.Config{MongoDB: config.MongoDB{
+		Address:                "mongodb://127.0.0.1:1",
+		ConnTimeout:            1,
+		ServerSelectionTimeout: 100 * time.Millisecond,
+		ConnectRetryInterval:   200 * time.Millisecond,
+	}}
+	m := NewMongoManager(cfg, suite.logger)
+
+	// WHEN it connects
+	err := m.Connect()
+
+	// THEN it fails after retrying for the connection timeout, disconnecting the created client
+	suite.Error(err)
+	suite.ErrorIs(m.Ping(context.Background()), ErrNotConnected)
+	suite.NoError(m.Disconnect())
+}
@@ -0,0 +1,97 @@
+package kre
+
+import (
+	"fmt"
+
+	"github.com/konstellation-io/kre/libs/simplelogger"
+	"github.com/nats-io/nats.go"
+
+	"github.com/konstellation-io/kre-runners/kre-go/v4/config"
+)
+
+// connectNATS connects to the NATS server with the configured authentication, TLS and
+// reconnect policy, logging every change of the connection state.
+func connectNATS(cfg config.Config, logger *simplelogger.SimpleLogger) (*nats.Conn, error) {
+	return nats.Connect(cfg.NATS.Server, natsOptions(cfg, logger)...)
+}
+
+func natsOptions(cfg config.Config, logger *simplelogger.SimpleLogger) []nats.Option {
+	conn := cfg.NATS.Connection
+
+	name := conn.Name
+	if name == "" {
+		name = fmt.Sprintf("%s-%s", cfg.NATS.Stream, cfg.NodeName)
+	}
+
+	opts := []nats.Option{
+		nats.Name(name),
+		nats.MaxReconnects(conn.MaxReconnects),
+		nats.ReconnectWait(conn.ReconnectWait),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				logger.Errorf("Disconnected from NATS: %s", err)
+				return
+			}
+			logger.Info("Disconnected from NATS")
+		}),
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			logger.Infof("Reconnected to NATS server %s", nc.ConnectedUrl())
+		}),
+		nats.ClosedHandler(func(nc *nats.Conn) {
+			if err := nc.LastError(); err != nil {
+				logger.Errorf("NATS connection closed: %s", err)
+				return
+			}
+			logger.Info("NATS connection closed")
+		}),
+		nats.ErrorHandler(func(_ *nats.Conn, s *nats.Subscription, err error) {
+			if s != nil {
+				logger.Errorf("NATS error in subscription to %q: %s", s.Subject, err)
+				return
+			}
+			logger.Errorf("NATS error: %s", err)
+		}),
+	}
+
+	if conn.CredsFile != "" {
+		opts = append(opts, nats.UserCredentials(conn.CredsFile))
+	}
+
+	if conn.Token != "" {
+		opts = append(opts, nats.Token(conn.Token))
+	}
+
+	if conn.User != "" {
+		opts = append(opts, nats.UserInfo(conn.User, conn.Password))
+	}
+
+	if conn.TLSCertFile != "" || conn.TLSKeyFile != "" {
+		opts = append(opts, nats.ClientCert(conn.TLSCertFile, conn.TLSKeyFile))
+	}
+
+	if conn.TLSCAFile != "" {
+		opts = append(opts, nats.RootCAs(conn.TLSCAFile))
+	}
+
+	return opts
+}
+
+// natsLivenessCheck fails once the connection is closed, as it is never reopened.
+func natsLivenessCheck(nc *nats.Conn) HealthCheck {
+	return func() error {
+		if nc.IsClosed() {
+			return fmt.Errorf("connection closed")
+		}
+		return nil
+	}
+}
+
+// natsReadinessCheck fails while the connection is not established, e.g. reconnecting.
+func natsReadinessCheck(nc *nats.Conn) HealthCheck {
+	return func() error {
+		if !nc.IsConnected() {
+			return fmt.Errorf("connection status is %s", nc.Status())
+		}
+		return nil
+	}
+}
@@ -0,0 +1,292 @@
+package kre
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/konstellation-io/kre-runners/kre-go/v4/config"
+	"github.com/konstellation-io/kre/libs/simplelogger"
+)
+
+const objectCacheFileExt = ".krt-cache"
+
+// ObjectCacheStats are the counters of the objects cache.
+type ObjectCacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Objects   int
+	Bytes     int64
+}
+
+// objectCache is a read-through LRU cache of the objects retrieved from the object stores, kept
+// in memory or in a directory. Objects are cached by name and digest, and only served while their
+// digest matches the last one notified by the object store watchers, or written by the node, so
+// updated and deleted objects are dropped from the cache.
+//
+// A nil *objectCache is a disabled cache.
+type objectCache struct {
+	logger   *simplelogger.SimpleLogger
+	maxBytes int64
+	dir      string
+
+	mu      sync.Mutex
+	lru     *list.List
+	entries map[string]*list.Element
+	digests map[string]string
+	synced  map[string]bool
+	stats   ObjectCacheStats
+}
+
+type objectCacheEntry struct {
+	key    string
+	digest string
+	size   int64
+	data   []byte
+	path   string
+}
+
+func newObjectCache(cfg config.ObjectStore, logger *simplelogger.SimpleLogger) (*objectCache, error) {
+	if cfg.CacheMaxBytes <= 0 {
+		return nil, nil
+	}
+
+	if cfg.CacheDir != "" {
+		err := os.MkdirAll(cfg.CacheDir, 0o755)
+		if err != nil {
+			return nil, fmt.Errorf("error creating objects cache directory: %w", err)
+		}
+
+		// the files cached by a previous run can't be trusted, as their objects may have changed
+		stale, _ := filepath.Glob(filepath.Join(cfg.CacheDir, "*"+objectCacheFileExt))
+		for _, file := range stale {
+			os.Remove(file)
+		}
+	}
+
+	return &objectCache{
+		logger:   logger,
+		maxBytes: int64(cfg.CacheMaxBytes),
+		dir:      cfg.CacheDir,
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
+		digests:  make(map[string]string),
+		synced:   make(map[string]bool),
+	}, nil
+}
+
+func objectCacheKey(bucket, name string) string {
+	return bucket + "/" + name
+}
+
+// watch keeps the digests of the bucket's objects up to date.
+func (oc *objectCache) watch(bucket string, objStore nats.ObjectStore) error {
+	watcher, err := objStore.Watch()
+	if err != nil {
+		return fmt.Errorf("error watching object store %q: %w", bucket, err)
+	}
+
+	go func() {
+		for info := range watcher.Updates() {
+			// a nil info marks the end of the initial values
+			if info == nil {
+				oc.mu.Lock()
+				oc.synced[bucket] = true
+				oc.mu.Unlock()
+
+				continue
+			}
+
+			oc.update(bucket, info)
+		}
+	}()
+
+	return nil
+}
+
+// update keeps the object's digest, notified by the bucket's watcher or by the node writing the
+// object, so it is found right after being written without waiting for the watcher.
+func (oc *objectCache) update(bucket string, info *nats.ObjectInfo) {
+	if oc == nil {
+		return
+	}
+
+	key := objectCacheKey(bucket, info.Name)
+
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+
+	if info.Deleted {
+		delete(oc.digests, key)
+	} else {
+		oc.digests[key] = info.Digest
+	}
+
+	if elem, ok := oc.entries[key]; ok && (info.Deleted || elem.Value.(*objectCacheEntry).digest != info.Digest) {
+		oc.remove(elem)
+		oc.logger.Debugf("Object %q dropped from the objects cache", key)
+	}
+}
+
+// exists reports whether the object is in the bucket, as notified by the bucket's watcher. known
+// is false until the watcher receives the bucket's objects.
+func (oc *objectCache) exists(bucket, name string) (exists, known bool) {
+	if oc == nil {
+		return false, false
+	}
+
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+
+	if !oc.synced[bucket] {
+		return false, false
+	}
+
+	_, exists = oc.digests[objectCacheKey(bucket, name)]
+
+	return exists, true
+}
+
+// fits reports whether an object of the given size can be cached.
+func (oc *objectCache) fits(size int64) bool {
+	return oc != nil && size <= oc.maxBytes
+}
+
+// get returns the cached object. Objects cached in a directory are read without holding the
+// lock, so lookups don't wait for each other's disk reads.
+func (oc *objectCache) get(bucket, name string) ([]byte, bool) {
+	if oc == nil {
+		return nil, false
+	}
+
+	key := objectCacheKey(bucket, name)
+
+	oc.mu.Lock()
+
+	elem, ok := oc.entries[key]
+	if !ok || elem.Value.(*objectCacheEntry).digest != oc.digests[key] {
+		oc.stats.Misses++
+		oc.mu.Unlock()
+
+		return nil, false
+	}
+
+	entry := elem.Value.(*objectCacheEntry)
+
+	if entry.path == "" {
+		oc.lru.MoveToFront(elem)
+		oc.stats.Hits++
+		oc.mu.Unlock()
+
+		// the cached data is copied, as callers may modify the returned slice
+		return append([]byte(nil), entry.data...), true
+	}
+
+	oc.mu.Unlock()
+
+	data, err := os.ReadFile(entry.path)
+
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+
+	// the object may have changed while reading it
+	current := oc.entries[key] == elem && entry.digest == oc.digests[key]
+
+	if err != nil || !current {
+		if err != nil && current {
+			oc.logger.Warnf("Error reading object %q from the objects cache: %s", key, err)
+			oc.remove(elem)
+		}
+		oc.stats.Misses++
+
+		return nil, false
+	}
+
+	oc.lru.MoveToFront(elem)
+	oc.stats.Hits++
+
+	return data, true
+}
+
+// add caches the object when its digest is the last one notified by the bucket's watcher,
+// evicting the least recently used objects to keep the cache under its size limit.
+func (oc *objectCache) add(bucket, name, digest string, data []byte) {
+	if !oc.fits(int64(len(data))) {
+		return
+	}
+
+	key := objectCacheKey(bucket, name)
+
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+
+	if oc.digests[key] != digest {
+		return
+	}
+
+	if elem, ok := oc.entries[key]; ok {
+		oc.remove(elem)
+	}
+
+	entry := &objectCacheEntry{key: key, digest: digest, size: int64(len(data))}
+
+	if oc.dir == "" {
+		entry.data = append([]byte(nil), data...)
+	} else {
+		hash := sha256.Sum256([]byte(key + "\x00" + digest))
+		entry.path = filepath.Join(oc.dir, hex.EncodeToString(hash[:])+objectCacheFileExt)
+
+		err := os.WriteFile(entry.path, data, 0o644)
+		if err != nil {
+			oc.logger.Warnf("Error writing object %q to the objects cache: %s", key, err)
+			os.Remove(entry.path)
+
+			return
+		}
+	}
+
+	oc.entries[key] = oc.lru.PushFront(entry)
+	oc.stats.Objects++
+	oc.stats.Bytes += entry.size
+
+	for oc.stats.Bytes > oc.maxBytes {
+		oc.remove(oc.lru.Back())
+		oc.stats.Evictions++
+	}
+}
+
+// deleted drops the object deleted by the node.
+func (oc *objectCache) deleted(bucket, name string) {
+	oc.update(bucket, &nats.ObjectInfo{ObjectMeta: nats.ObjectMeta{Name: name}, Deleted: true})
+}
+
+func (oc *objectCache) remove(elem *list.Element) {
+	entry := elem.Value.(*objectCacheEntry)
+
+	oc.lru.Remove(elem)
+	delete(oc.entries, entry.key)
+	oc.stats.Objects--
+	oc.stats.Bytes -= entry.size
+
+	if entry.path != "" {
+		os.Remove(entry.path)
+	}
+}
+
+func (oc *objectCache) statistics() ObjectCacheStats {
+	if oc == nil {
+		return ObjectCacheStats{}
+	}
+
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+
+	return oc.stats
+}
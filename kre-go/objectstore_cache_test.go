@@ -0,0 +1,184 @@
+//go:build unit
+
+package kre
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/konstellation-io/kre-runners/kre-go/v4/config"
+	"github.com/konstellation-io/kre/libs/simplelogger"
+)
+
+type ObjectCacheTestSuite struct {
+	suite.Suite
+	logger *simplelogger.SimpleLogger
+}
+
+func TestObjectCacheTestSuite(t *testing.T) {
+	suite.Run(t, new(ObjectCacheTestSuite))
+}
+
+func (s *ObjectCacheTestSuite) SetupSuite() {
+	s.logger = simplelogger.New(simplelogger.LevelInfo)
+}
+
+func (s *ObjectCacheTestSuite) newCache(cfg config.ObjectStore) *objectCache {
+	cache, err := newObjectCache(cfg, s.logger)
+	s.Require().NoError(err)
+	s.Require().NotNil(cache)
+
+	return cache
+}
+
+func (s *ObjectCacheTestSuite) TestDisabledCache() {
+	cache, err := newObjectCache(config.ObjectStore{}, s.logger)
+	s.Require().NoError(err)
+	s.Require().Nil(cache)
+
+	_, ok := cache.get("bucket", "model")
+	s.False(ok)
+	s.Equal(ObjectCacheStats{}, cache.statistics())
+}
+
+func (s *ObjectCacheTestSuite) TestGetCachedObject() {
+	// GIVEN a cached object
+	cache := s.newCache(config.ObjectStore{CacheMaxBytes: 100})
+	cache.update("bucket", &nats.ObjectInfo{ObjectMeta: nats.ObjectMeta{Name: "model"}, Digest: "d1"})
+	cache.add("bucket", "model", "d1", []byte("model v1"))
+
+	// WHEN it is retrieved twice
+	data, ok := cache.get("bucket", "model")
+	s.Require().True(ok)
+	data[0] = 'X'
+	data, ok = cache.get("bucket", "model")
+
+	// THEN it is served from the cache, unmodified
+	s.Require().True(ok)
+	s.Equal([]byte("model v1"), data)
+	s.Equal(ObjectCacheStats{Hits: 2, Objects: 1, Bytes: 8}, cache.statistics())
+}
+
+func (s *ObjectCacheTestSuite) TestUpdatedObjectIsDropped() {
+	// GIVEN a cached object
+	cache := s.newCache(config.ObjectStore{CacheMaxBytes: 100})
+	cache.update("bucket", &nats.ObjectInfo{ObjectMeta: nats.ObjectMeta{Name: "model"}, Digest: "d1"})
+	cache.add("bucket", "model", "d1", []byte("model v1"))
+
+	// WHEN the watcher notifies a new version
+	cache.update("bucket", &nats.ObjectInfo{ObjectMeta: nats.ObjectMeta{Name: "model"}, Digest: "d2"})
+
+	// THEN the outdated object isn't served and can't be cached again
+	_, ok := cache.get("bucket", "model")
+	s.False(ok)
+
+	cache.add("bucket", "model", "d1", []byte("model v1"))
+	_, ok = cache.get("bucket", "model")
+	s.False(ok)
+
+	cache.add("bucket", "model", "d2", []byte("model v2"))
+	data, ok := cache.get("bucket", "model")
+	s.True(ok)
+	s.Equal([]byte("model v2"), data)
+}
+
+func (s *ObjectCacheTestSuite) TestDeletedObjectIsDropped() {
+	cache := s.newCache(config.ObjectStore{CacheMaxBytes: 100})
+	cache.synced["bucket"] = true
+	cache.update("bucket", &nats.ObjectInfo{ObjectMeta: nats.ObjectMeta{Name: "model"}, Digest: "d1"})
+	cache.add("bucket", "model", "d1", []byte("model v1"))
+
+	exists, known := cache.exists("bucket", "model")
+	s.True(known)
+	s.True(exists)
+
+	cache.update("bucket", &nats.ObjectInfo{ObjectMeta: nats.ObjectMeta{Name: "model"}, Deleted: true})
+
+	exists, known = cache.exists("bucket", "model")
+	s.True(known)
+	s.False(exists)
+	s.Equal(0, cache.statistics().Objects)
+}
+
+func (s *ObjectCacheTestSuite) TestLeastRecentlyUsedObjectsAreEvicted() {
+	// GIVEN a cache with room for two objects
+	cache := s.newCache(config.ObjectStore{CacheMaxBytes: 10})
+	for _, name := range []string{"a", "b", "c", "big"} {
+		cache.update("bucket", &nats.ObjectInfo{ObjectMeta: nats.ObjectMeta{Name: name}, Digest: name})
+	}
+	cache.add("bucket", "a", "a", []byte("aaaaa"))
+	cache.add("bucket", "b", "b", []byte("bbbbb"))
+
+	// WHEN a third object is cached after using the first one
+	_, ok := cache.get("bucket", "a")
+	s.Require().True(ok)
+	cache.add("bucket", "c", "c", []byte("ccccc"))
+	cache.add("bucket", "big", "big", []byte("bigger than the cache"))
+
+	// THEN the least recently used is evicted and the objects bigger than the cache aren't cached
+	_, ok = cache.get("bucket", "b")
+	s.False(ok)
+	_, ok = cache.get("bucket", "a")
+	s.True(ok)
+	_, ok = cache.get("bucket", "c")
+	s.True(ok)
+	_, ok = cache.get("bucket", "big")
+	s.False(ok)
+
+	stats := cache.statistics()
+	s.Equal(uint64(1), stats.Evictions)
+	s.Equal(2, stats.Objects)
+	s.Equal(int64(10), stats.Bytes)
+}
+
+func (s *ObjectCacheTestSuite) TestDiskCache() {
+	// GIVEN a disk cache with a stale file from a previous run
+	dir := s.T().TempDir()
+	stale := filepath.Join(dir, "stale"+objectCacheFileExt)
+	s.Require().NoError(os.WriteFile(stale, []byte("stale"), 0o644))
+
+	cache := s.newCache(config.ObjectStore{CacheMaxBytes: 100, CacheDir: dir})
+	s.NoFileExists(stale)
+
+	// WHEN an object is cached and later updated
+	cache.update("bucket", &nats.ObjectInfo{ObjectMeta: nats.ObjectMeta{Name: "model"}, Digest: "d1"})
+	cache.add("bucket", "model", "d1", []byte("model v1"))
+
+	data, ok := cache.get("bucket", "model")
+	s.Require().True(ok)
+	s.Equal([]byte("model v1"), data)
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*"+objectCacheFileExt))
+	s.Len(files, 1)
+
+	cache.update("bucket", &nats.ObjectInfo{ObjectMeta: nats.ObjectMeta{Name: "model"}, Digest: "d2"})
+
+	// THEN its file is removed
+	files, _ = filepath.Glob(filepath.Join(dir, "*"+objectCacheFileExt))
+	s.Empty(files)
+}
+
+func (s *ObjectCacheTestSuite) TestUnreadableDiskCacheFileIsDropped() {
+	// GIVEN an object cached on disk whose file is removed
+	dir := s.T().TempDir()
+	cache := s.newCache(config.ObjectStore{CacheMaxBytes: 100, CacheDir: dir})
+
+	cache.update("bucket", &nats.ObjectInfo{ObjectMeta: nats.ObjectMeta{Name: "model"}, Digest: "d1"})
+	cache.add("bucket", "model", "d1", []byte("model v1"))
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*"+objectCacheFileExt))
+	s.Require().Len(files, 1)
+	s.Require().NoError(os.Remove(files[0]))
+
+	// WHEN it is read
+	_, ok := cache.get("bucket", "model")
+
+	// THEN it is a miss, and the object is dropped from the cache
+	s.False(ok)
+	s.Equal(0, cache.stats.Objects)
+	s.EqualValues(1, cache.stats.Misses)
+}
@@ -0,0 +1,191 @@
+package kre
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/konstellation-io/kre-runners/kre-go/v4/internal/errors"
+)
+
+const (
+	contentTypeHeader = "Content-Type"
+	expiresAtHeader   = "Krt-Expires-At"
+)
+
+// ObjectOptions are the optional metadata of an object. Objects with a TTL are deleted by the
+// object store sweeper once expired.
+type ObjectOptions struct {
+	ContentType string
+	Description string
+	Headers     map[string]string
+	TTL         time.Duration
+}
+
+// ObjectInfo describes an object stored in the object store. ExpiresAt is zero for objects
+// without TTL.
+type ObjectInfo struct {
+	Name        string
+	Description string
+	ContentType string
+	Headers     map[string]string
+	Size        uint64
+	Digest      string
+	ModTime     time.Time
+	ExpiresAt   time.Time
+}
+
+func (o ObjectOptions) meta(key string, now time.Time) *nats.ObjectMeta {
+	meta := &nats.ObjectMeta{
+		Name:        key,
+		Description: o.Description,
+	}
+
+	if len(o.Headers) == 0 && o.ContentType == "" && o.TTL <= 0 {
+		return meta
+	}
+
+	meta.Headers = nats.Header{}
+	for name, value := range o.Headers {
+		meta.Headers.Set(name, value)
+	}
+
+	if o.ContentType != "" {
+		meta.Headers.Set(contentTypeHeader, o.ContentType)
+	}
+
+	if o.TTL > 0 {
+		meta.Headers.Set(expiresAtHeader, now.Add(o.TTL).UTC().Format(time.RFC3339Nano))
+	}
+
+	return meta
+}
+
+func newObjectInfo(info *nats.ObjectInfo) *ObjectInfo {
+	objectInfo := &ObjectInfo{
+		Name:        info.Name,
+		Description: info.Description,
+		Headers:     make(map[string]string, len(info.Headers)),
+		Size:        info.Size,
+		Digest:      info.Digest,
+		ModTime:     info.ModTime,
+	}
+
+	for name := range info.Headers {
+		switch name {
+		case contentTypeHeader:
+			objectInfo.ContentType = info.Headers.Get(name)
+		case expiresAtHeader:
+			objectInfo.ExpiresAt, _ = time.Parse(time.RFC3339Nano, info.Headers.Get(name))
+		default:
+			objectInfo.Headers[name] = info.Headers.Get(name)
+		}
+	}
+
+	return objectInfo
+}
+
+// IsExpired reports whether the object's TTL expired at the given time.
+func (o *ObjectInfo) IsExpired(now time.Time) bool {
+	return !o.ExpiresAt.IsZero() && !now.Before(o.ExpiresAt)
+}
+
+// SaveWithOptions stores the given payload in the Object Store with the given key as identifier,
+// along with the given metadata.
+func (c *contextObjectStore) SaveWithOptions(key string, payload []byte, opts ObjectOptions) error {
+	if c.objStore == nil {
+		return errors.ErrUndefinedObjectStore
+	}
+	if payload == nil {
+		return errors.ErrEmptyPayload
+	}
+
+	info, err := c.objStore.Put(opts.meta(key, time.Now()), bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("error storing object to the object store: %w", err)
+	}
+
+	c.cache.update(c.bucket, info)
+
+	c.logger.Debugf("File with key %q successfully stored in object store %q", key, c.bucket)
+
+	return nil
+}
+
+// GetInfo retrieves the metadata of the object, searched as Get does.
+func (c *contextObjectStore) GetInfo(key string) (*ObjectInfo, error) {
+	store, err := c.lookup(key)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := store.objStore.GetInfo(key)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving info of object with key %s from the object store: %w", key, err)
+	}
+
+	return newObjectInfo(info), nil
+}
+
+// ListInfo works as List, but returns the metadata of the objects.
+func (c *contextObjectStore) ListInfo(regexp ...string) ([]*ObjectInfo, error) {
+	if c.objStore == nil {
+		return nil, errors.ErrUndefinedObjectStore
+	}
+
+	pattern, err := compileOptionalRegexp(regexp)
+	if err != nil {
+		return nil, err
+	}
+
+	objStoreList, err := c.objStore.List()
+	if err != nil && err != nats.ErrNoObjectsFound {
+		return nil, fmt.Errorf("error listing objects from the object store: %w", err)
+	}
+
+	response := []*ObjectInfo{}
+
+	for _, info := range objStoreList {
+		if pattern == nil || pattern.MatchString(info.Name) {
+			response = append(response, newObjectInfo(info))
+		}
+	}
+
+	return response, nil
+}
+
+// sweepExpiredObjects periodically deletes the objects whose TTL expired.
+func (c *contextObjectStore) sweepExpiredObjects(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		c.deleteExpiredObjects(time.Now())
+	}
+}
+
+func (c *contextObjectStore) deleteExpiredObjects(now time.Time) {
+	objects, err := c.ListInfo()
+	if err != nil {
+		c.logger.Errorf("Error listing expired objects: %s", err)
+		return
+	}
+
+	for _, object := range objects {
+		if !object.IsExpired(now) {
+			continue
+		}
+
+		err = c.objStore.Delete(object.Name)
+		if err != nil && err != nats.ErrObjectNotFound {
+			c.logger.Errorf("Error deleting expired object %q: %s", object.Name, err)
+			continue
+		}
+
+		c.cache.deleted(c.bucket, object.Name)
+
+		c.logger.Debugf("Expired object %q deleted from object store %q", object.Name, c.bucket)
+	}
+}
@@ -0,0 +1,51 @@
+//go:build unit
+
+package kre
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/suite"
+)
+
+type ObjectInfoTestSuite struct {
+	suite.Suite
+}
+
+func TestObjectInfoTestSuite(t *testing.T) {
+	suite.Run(t, new(ObjectInfoTestSuite))
+}
+
+func (suite *ObjectInfoTestSuite) TestObjectOptionsRoundTrip() {
+	// GIVEN an object saved with options
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	opts := ObjectOptions{
+		ContentType: "text/csv",
+		Description: "lookup table",
+		Headers:     map[string]string{"Model-Version": "3"},
+		TTL:         time.Hour,
+	}
+
+	meta := opts.meta("table", now)
+
+	// WHEN its info is read
+	info := newObjectInfo(&nats.ObjectInfo{ObjectMeta: *meta, Size: 10, Digest: "SHA-256=abc"})
+
+	// THEN the options are restored
+	suite.Equal("table", info.Name)
+	suite.Equal("lookup table", info.Description)
+	suite.Equal("text/csv", info.ContentType)
+	suite.Equal(map[string]string{"Model-Version": "3"}, info.Headers)
+	suite.Equal(now.Add(time.Hour), info.ExpiresAt)
+	suite.False(info.IsExpired(now))
+	suite.True(info.IsExpired(now.Add(time.Hour)))
+}
+
+func (suite *ObjectInfoTestSuite) TestObjectWithoutTTLNeverExpires() {
+	info := newObjectInfo(&nats.ObjectInfo{ObjectMeta: *ObjectOptions{}.meta("table", time.Now())})
+
+	suite.True(info.ExpiresAt.IsZero())
+	suite.False(info.IsExpired(time.Now().Add(100 * 365 * 24 * time.Hour)))
+}
@@ -0,0 +1,145 @@
+package kre
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/konstellation-io/kre-runners/kre-go/v4/internal/errors"
+)
+
+const defaultPurgeConcurrency = 4
+
+// PurgeOptions select the objects deleted by PurgeWithOptions. Objects must match both the
+// Regexp, when given, and be older than OlderThan, when not zero.
+type PurgeOptions struct {
+	Regexp      string
+	OlderThan   time.Duration
+	DryRun      bool
+	Concurrency int
+}
+
+// PurgeError lists the objects that could not be deleted by a purge.
+type PurgeError struct {
+	Failed map[string]error
+}
+
+func (e *PurgeError) Error() string {
+	keys := make([]string, 0, len(e.Failed))
+	for key := range e.Failed {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	failures := make([]string, 0, len(keys))
+	for _, key := range keys {
+		failures = append(failures, fmt.Sprintf("%s: %s", key, e.Failed[key]))
+	}
+
+	return fmt.Sprintf("error purging %d objects from the object store: %s", len(keys), strings.Join(failures, "; "))
+}
+
+// Purge deletes the objects matching the optional regexp from the node's object store.
+func (c *contextObjectStore) Purge(regexp ...string) error {
+	opts := PurgeOptions{}
+	if len(regexp) > 0 {
+		opts.Regexp = regexp[0]
+	}
+
+	_, err := c.PurgeWithOptions(opts)
+
+	return err
+}
+
+// PurgeWithOptions deletes the objects selected by the options from the node's object store and
+// returns their keys, or only returns them on a dry run. Deletion continues when an object fails
+// to be deleted, returning a *PurgeError listing the failed keys, which aren't returned as purged.
+func (c *contextObjectStore) PurgeWithOptions(opts PurgeOptions) ([]string, error) {
+	if c.objStore == nil {
+		return nil, errors.ErrUndefinedObjectStore
+	}
+
+	objects, err := c.ListInfo(opts.Regexp)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	keys := make([]string, 0, len(objects))
+
+	for _, object := range objects {
+		if opts.OlderThan > 0 && now.Sub(object.ModTime) < opts.OlderThan {
+			continue
+		}
+		keys = append(keys, object.Name)
+	}
+
+	if opts.DryRun {
+		c.logger.Debugf("%d files would be purged from object store %q", len(keys), c.bucket)
+		return keys, nil
+	}
+
+	failed := c.deleteObjects(keys, opts.Concurrency)
+
+	purged := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if _, ok := failed[key]; !ok {
+			purged = append(purged, key)
+		}
+	}
+
+	if len(failed) > 0 {
+		return purged, &PurgeError{Failed: failed}
+	}
+
+	c.logger.Debugf("Files successfully purged from object store %q", c.bucket)
+
+	return purged, nil
+}
+
+// deleteObjects deletes the objects with at most the given concurrency, returning the errors
+// of the objects that failed to be deleted.
+func (c *contextObjectStore) deleteObjects(keys []string, concurrency int) map[string]error {
+	if concurrency <= 0 {
+		concurrency = defaultPurgeConcurrency
+	}
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed = make(map[string]error)
+		sem    = make(chan struct{}, concurrency)
+	)
+
+	for _, key := range keys {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(key string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			c.logger.Debugf("Deleting object %q", key)
+
+			err := c.objStore.Delete(key)
+			if err != nil && err != nats.ErrObjectNotFound {
+				mu.Lock()
+				failed[key] = err
+				mu.Unlock()
+				return
+			}
+
+			c.cache.deleted(c.bucket, key)
+		}(key)
+	}
+
+	wg.Wait()
+
+	return failed
+}
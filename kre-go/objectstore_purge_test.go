@@ -0,0 +1,29 @@
+//go:build unit
+
+package kre
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type PurgeTestSuite struct {
+	suite.Suite
+}
+
+func TestPurgeTestSuite(t *testing.T) {
+	suite.Run(t, new(PurgeTestSuite))
+}
+
+func (suite *PurgeTestSuite) TestPurgeErrorListsFailedKeys() {
+	// GIVEN a purge where two objects failed to be deleted
+	err := &PurgeError{Failed: map[string]error{
+		"b": errors.New("timeout"),
+		"a": errors.New("not permitted"),
+	}}
+
+	// THEN the error lists the failed keys in order
+	suite.Equal("error purging 2 objects from the object store: a: not permitted; b: timeout", err.Error())
+}
@@ -0,0 +1,172 @@
+package kre
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/konstellation-io/kre-runners/kre-go/v4/internal/errors"
+)
+
+// ProgressFunc is called while an object is transferred with the bytes transferred so far and
+// the total size of the object, or zero when the size is unknown.
+type ProgressFunc func(transferred, total int64)
+
+// progressReader reports the progress of the reads of the wrapped reader.
+type progressReader struct {
+	reader      io.Reader
+	total       int64
+	transferred int64
+	progress    ProgressFunc
+}
+
+func withProgress(reader io.Reader, total int64, progressOpt []ProgressFunc) io.Reader {
+	if len(progressOpt) == 0 || progressOpt[0] == nil {
+		return reader
+	}
+
+	return &progressReader{reader: reader, total: total, progress: progressOpt[0]}
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.transferred += int64(n)
+		r.progress(r.transferred, r.total)
+	}
+
+	return n, err
+}
+
+// Put stores the content read from the given reader in the Object Store with the given key as
+// identifier, without loading it in memory.
+func (c *contextObjectStore) Put(key string, reader io.Reader, progressOpt ...ProgressFunc) error {
+	return c.put(key, reader, 0, progressOpt)
+}
+
+func (c *contextObjectStore) put(key string, reader io.Reader, size int64, progressOpt []ProgressFunc) error {
+	if c.objStore == nil {
+		return errors.ErrUndefinedObjectStore
+	}
+
+	info, err := c.objStore.Put(&nats.ObjectMeta{Name: key}, withProgress(reader, size, progressOpt))
+	if err != nil {
+		return fmt.Errorf("error storing object to the object store: %w", err)
+	}
+
+	c.cache.update(c.bucket, info)
+
+	c.logger.Debugf("File with key %q successfully stored in object store %q", key, c.bucket)
+
+	return nil
+}
+
+// GetTo writes the object stored in the node's object store, or in the workflow's and the
+// project's ones if not found, to the given writer, without loading it in memory.
+func (c *contextObjectStore) GetTo(key string, writer io.Writer, progressOpt ...ProgressFunc) error {
+	store, err := c.lookup(key)
+	if err != nil {
+		return err
+	}
+
+	if response, ok := c.cache.get(store.bucket, key); ok {
+		_, err = io.Copy(writer, withProgress(bytes.NewReader(response), int64(len(response)), progressOpt))
+		if err != nil {
+			return fmt.Errorf("error retrieving object with key %s from the objects cache: %w", key, err)
+		}
+
+		c.logger.Debugf("File with key %q retrieved from the objects cache", key)
+
+		return nil
+	}
+
+	result, err := store.objStore.Get(key)
+	if err != nil {
+		return fmt.Errorf("error retrieving object with key %s from the object store: %w", key, err)
+	}
+	defer result.Close()
+
+	info, err := result.Info()
+	if err != nil {
+		return fmt.Errorf("error retrieving object with key %s from the object store: %w", key, err)
+	}
+
+	// objects small enough for the cache are kept while copied
+	var reader io.Reader = result
+	var cached *bytes.Buffer
+	if c.cache.fits(int64(info.Size)) {
+		cached = bytes.NewBuffer(make([]byte, 0, info.Size))
+		reader = io.TeeReader(result, cached)
+	}
+
+	_, err = io.Copy(writer, withProgress(reader, int64(info.Size), progressOpt))
+	if err != nil {
+		return fmt.Errorf("error retrieving object with key %s from the object store: %w", key, err)
+	}
+
+	if cached != nil {
+		c.cache.add(store.bucket, key, info.Digest, cached.Bytes())
+	}
+
+	c.logger.Debugf("File with key %q successfully retrieved from object store %q", key, store.bucket)
+
+	return nil
+}
+
+// SaveFile stores the file in the given path, relative to the base path as HandlerContext.Path,
+// in the Object Store with the given key as identifier.
+func (c *contextObjectStore) SaveFile(key, relativePath string, progressOpt ...ProgressFunc) error {
+	file, err := os.Open(c.path(relativePath))
+	if err != nil {
+		return fmt.Errorf("error opening file to store in the object store: %w", err)
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("error opening file to store in the object store: %w", err)
+	}
+
+	return c.put(key, file, stat.Size(), progressOpt)
+}
+
+// GetToFile writes the object stored in the node's object store to the given path, relative to
+// the base path as HandlerContext.Path. The file is only replaced once the object is complete.
+func (c *contextObjectStore) GetToFile(key, relativePath string, progressOpt ...ProgressFunc) error {
+	filePath := c.path(relativePath)
+
+	err := os.MkdirAll(filepath.Dir(filePath), 0o755)
+	if err != nil {
+		return fmt.Errorf("error creating directory for object with key %s: %w", key, err)
+	}
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(filePath), filepath.Base(filePath)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("error creating file for object with key %s: %w", key, err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	err = c.GetTo(key, tmpFile, progressOpt...)
+	if closeErr := tmpFile.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("error writing file for object with key %s: %w", key, closeErr)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tmpFile.Name(), filePath)
+	if err != nil {
+		return fmt.Errorf("error writing file for object with key %s: %w", key, err)
+	}
+
+	return nil
+}
+
+func (c *contextObjectStore) path(relativePath string) string {
+	return path.Join(c.cfg.BasePath, relativePath)
+}
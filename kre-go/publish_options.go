@@ -0,0 +1,34 @@
+package kre
+
+// PublishOpt customizes how a single output is published.
+type PublishOpt func(*publishOptions)
+
+type publishOptions struct {
+	msgID     string
+	partIndex int32
+	partCount int32
+}
+
+func newPublishOptions(opts []PublishOpt) publishOptions {
+	options := publishOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return options
+}
+
+// withMsgID sets the Nats-Msg-Id header used by JetStream to discard duplicated messages.
+func withMsgID(msgID string) PublishOpt {
+	return func(o *publishOptions) {
+		o.msgID = msgID
+	}
+}
+
+// withPart tags the output as one of the parts of a scattered request.
+func withPart(index, count int) PublishOpt {
+	return func(o *publishOptions) {
+		o.partIndex = int32(index)
+		o.partCount = int32(count)
+	}
+}
@@ -0,0 +1,114 @@
+package kre
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/konstellation-io/kre-runners/kre-go/v4/internal/errors"
+)
+
+// PublishErrorPolicy decides what happens to the incoming message when publishing one of its
+// outputs fails.
+type PublishErrorPolicy string
+
+const (
+	// FailOnPublishError treats a failed publish as a handler error: an error message is sent
+	// downstream and the request is recorded as unsuccessful.
+	FailOnPublishError PublishErrorPolicy = "fail"
+	// IgnorePublishError only logs failed publishes, the message is processed as successful.
+	IgnorePublishError PublishErrorPolicy = "ignore"
+)
+
+func (p PublishErrorPolicy) IsValid() error {
+	switch p {
+	case FailOnPublishError, IgnorePublishError:
+		return nil
+	}
+	return fmt.Errorf("invalid PublishErrorPolicy type: %s", p)
+}
+
+// publishTracker collects the result of every publish made while handling a single message.
+// Synchronous publishes store their error right away, asynchronous ones store the PubAckFuture
+// that is resolved once the handler has finished.
+type publishTracker struct {
+	mu      sync.Mutex
+	sent    int
+	futures []nats.PubAckFuture
+	errs    []error
+}
+
+func newPublishTracker() *publishTracker {
+	return &publishTracker{}
+}
+
+func (t *publishTracker) track(future nats.PubAckFuture, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err != nil {
+		t.errs = append(t.errs, err)
+		return
+	}
+
+	if future != nil {
+		t.futures = append(t.futures, future)
+	}
+}
+
+// nextMsgID generates a deterministic Nats-Msg-Id for the next output of the message, so that
+// JetStream discards the outputs published again when the message is redelivered.
+// Outputs are identified by the part of the request and the order in which the handler sends them.
+func (t *publishTracker) nextMsgID(reqMsg *KreNatsMessage, nodeName string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.sent++
+
+	return fmt.Sprintf("%s:%s:%d:%s:%d", reqMsg.RequestId, reqMsg.FromNode, reqMsg.PartIndex, nodeName, t.sent)
+}
+
+// wait blocks until every pending PubAckFuture is resolved or the timeout expires, and returns
+// all the errors collected for the message.
+func (t *publishTracker) wait(timeout time.Duration) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	errs := t.errs
+
+	// a closed channel keeps the deadline expired for all the remaining futures
+	expired := make(chan struct{})
+	deadline := time.AfterFunc(timeout, func() { close(expired) })
+	defer deadline.Stop()
+
+	for _, future := range t.futures {
+		select {
+		case <-future.Ok():
+		case err := <-future.Err():
+			errs = append(errs, err)
+		case <-expired:
+			errs = append(errs, fmt.Errorf("%w for subject %q", errors.ErrPublishAckTimeout, future.Msg().Subject))
+		}
+	}
+
+	t.futures = nil
+	t.errs = nil
+
+	return joinPublishErrors(errs)
+}
+
+func joinPublishErrors(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+
+	msgs := make([]string, 0, len(errs))
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+
+	return fmt.Errorf("%w: %s", errors.ErrPublishFailed, strings.Join(msgs, "; "))
+}
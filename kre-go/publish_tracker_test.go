@@ -0,0 +1,82 @@
+//go:build unit
+
+package kre
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/suite"
+
+	utilErrors "github.com/konstellation-io/kre-runners/kre-go/v4/internal/errors"
+)
+
+type fakePubAckFuture struct {
+	ok  chan *nats.PubAck
+	err chan error
+	msg *nats.Msg
+}
+
+func newFakePubAckFuture(subject string) *fakePubAckFuture {
+	return &fakePubAckFuture{
+		ok:  make(chan *nats.PubAck, 1),
+		err: make(chan error, 1),
+		msg: &nats.Msg{Subject: subject},
+	}
+}
+
+func (f *fakePubAckFuture) Ok() <-chan *nats.PubAck { return f.ok }
+func (f *fakePubAckFuture) Err() <-chan error       { return f.err }
+func (f *fakePubAckFuture) Msg() *nats.Msg          { return f.msg }
+
+type PublishTrackerTestSuite struct {
+	suite.Suite
+	tracker *publishTracker
+}
+
+func TestPublishTrackerTestSuite(t *testing.T) {
+	suite.Run(t, new(PublishTrackerTestSuite))
+}
+
+func (suite *PublishTrackerTestSuite) SetupTest() {
+	suite.tracker = newPublishTracker()
+}
+
+func (suite *PublishTrackerTestSuite) TestWaitWithAckedFutures() {
+	// GIVEN an acknowledged async publish
+	future := newFakePubAckFuture("output")
+	future.ok <- &nats.PubAck{}
+	suite.tracker.track(future, nil)
+
+	// WHEN the tracker is awaited
+	// THEN no error is returned
+	suite.Require().NoError(suite.tracker.wait(time.Second))
+}
+
+func (suite *PublishTrackerTestSuite) TestWaitCollectsAllErrors() {
+	// GIVEN a failed sync publish, a failed async publish and a never acknowledged one
+	suite.tracker.track(nil, errors.New("sync error"))
+
+	failed := newFakePubAckFuture("output")
+	failed.err <- errors.New("async error")
+	suite.tracker.track(failed, nil)
+
+	suite.tracker.track(newFakePubAckFuture("output.channel"), nil)
+
+	// WHEN the tracker is awaited
+	err := suite.tracker.wait(10 * time.Millisecond)
+
+	// THEN every error is reported
+	suite.Require().ErrorIs(err, utilErrors.ErrPublishFailed)
+	suite.Contains(err.Error(), "sync error")
+	suite.Contains(err.Error(), "async error")
+	suite.Contains(err.Error(), "output.channel")
+}
+
+func (suite *PublishTrackerTestSuite) TestPublishErrorPolicyIsValid() {
+	suite.NoError(FailOnPublishError.IsValid())
+	suite.NoError(IgnorePublishError.IsValid())
+	suite.Error(PublishErrorPolicy("retry").IsValid())
+}
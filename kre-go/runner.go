@@ -1,7 +1,9 @@
 package kre
 
 import (
+	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/konstellation-io/kre/libs/simplelogger"
@@ -28,26 +30,47 @@ type RunnerParams struct {
 	MongoManager         mongodb.Manager
 	ContextObjectStore   ContextObjectStore
 	ContextConfiguration ContextConfiguration
+	IdempotencyStore     *IdempotencyStore
+	JoinStore            *JoinStore
+	BatchHandler         BatchHandler
 }
 
 type Runner struct {
-	logger         *simplelogger.SimpleLogger
-	cfg            config.Config
-	nc             *nats.Conn
-	js             nats.JetStreamContext
-	handlerContext *HandlerContext
-	handlerManager *HandlerManager
+	logger           *simplelogger.SimpleLogger
+	cfg              config.Config
+	nc               *nats.Conn
+	js               nats.JetStreamContext
+	handlerContext   *HandlerContext
+	handlerManager   *HandlerManager
+	idempotencyStore *IdempotencyStore
+	joinStore        *JoinStore
+	batchHandler     BatchHandler
+	batcher          *batcher
+	limiter          *limiter
+
+	// inFlight tracks the messages being processed, so Shutdown waits for them
+	inFlight     sync.WaitGroup
+	inFlightMu   sync.Mutex
+	shuttingDown bool
+
+	// stopSweep stops the join timeouts sweeper, which closes sweepDone once stopped
+	stopSweep chan struct{}
+	sweepDone chan struct{}
 }
 
 // NewRunner creates a new Runner instance, initializing a new handler context within and runs
 // the given handler init func.
 func NewRunner(params *RunnerParams) *Runner {
 	runner := &Runner{
-		logger:         params.Logger,
-		cfg:            params.Cfg,
-		nc:             params.NC,
-		js:             params.JS,
-		handlerManager: params.HandlerManager,
+		logger:           params.Logger,
+		cfg:              params.Cfg,
+		nc:               params.NC,
+		js:               params.JS,
+		handlerManager:   params.HandlerManager,
+		idempotencyStore: params.IdempotencyStore,
+		joinStore:        params.JoinStore,
+		batchHandler:     params.BatchHandler,
+		limiter:          newLimiter(params.Cfg.Limits),
 	}
 
 	ctx := NewHandlerContext(&HandlerContextParams{
@@ -60,6 +83,7 @@ func NewRunner(params *RunnerParams) *Runner {
 		params.ContextObjectStore,
 		params.ContextConfiguration,
 	})
+	ctx.joins = params.JoinStore
 
 	if params.HandlerInit != nil {
 		params.HandlerInit(ctx)
@@ -67,9 +91,54 @@ func NewRunner(params *RunnerParams) *Runner {
 
 	runner.handlerContext = ctx
 
+	if runner.joinStore != nil {
+		runner.stopSweep = make(chan struct{})
+		runner.sweepDone = make(chan struct{})
+		go runner.sweepJoins()
+	}
+
+	if runner.batchHandler != nil {
+		runner.batcher = newBatcher(params.Cfg.Batch.Size, params.Cfg.Batch.MaxWait, func(msgs []*nats.Msg) {
+			runner.processBatch(msgs)
+			runner.inFlight.Add(-len(msgs))
+		})
+		go runner.batcher.run()
+	}
+
 	return runner
 }
 
+// Shutdown stops the join timeouts sweeper, waits for the messages being processed, and sends the
+// documents still queued by the handlers with SaveAsync. Messages received afterwards are left for
+// redelivery.
+func (r *Runner) Shutdown() {
+	r.inFlightMu.Lock()
+	r.shuttingDown = true
+	r.inFlightMu.Unlock()
+
+	if r.stopSweep != nil {
+		close(r.stopSweep)
+		<-r.sweepDone
+	}
+
+	r.inFlight.Wait()
+
+	err := closeDatabase(r.handlerContext.DB)
+	if err != nil {
+		r.logger.Errorf("Error saving queued documents on shutdown: %s", err)
+	}
+}
+
+// closeDatabase sends the documents queued in the database, rejecting the ones saved afterwards
+// when the database supports it.
+func closeDatabase(db ContextDatabase) error {
+	if closer, ok := db.(interface{ close() error }); ok {
+		return closer.close()
+	}
+
+	return db.Flush()
+}
+
 // ProcessMessage parses the incoming NATS message and executes the appropiate handler function
 // taking into account the origin's node of the message.
 func (r *Runner) ProcessMessage(msg *nats.Msg) {
@@ -77,54 +146,262 @@ func (r *Runner) ProcessMessage(msg *nats.Msg) {
 		start = time.Now().UTC()
 	)
 
+	if !r.startMessage(msg) {
+		return
+	}
+
 	requestMsg, err := r.newRequestMessage(msg.Data)
 	if err != nil {
 		errMsg := fmt.Sprintf("Error parsing msg.data coming from subject %s because is not a valid protobuf: %s", msg.Subject, err)
-		r.processRunnerError(msg, errMsg, requestMsg.RequestId, start, requestMsg.FromNode)
+		r.processRunnerError(msg, errMsg, requestMsg, start)
+		r.inFlight.Done()
 		return
 	}
 
 	r.logger.Infof("Received a message from %q with requestId %q", msg.Subject, requestMsg.RequestId)
 
+	if r.limiter != nil && r.limiter.limited(requestMsg.FromNode) {
+		// Limited messages wait concurrently, so a node's burst does not block other nodes' messages.
+		go func() {
+			defer r.inFlight.Done()
+			r.processLimitedMessage(msg, requestMsg, start)
+		}()
+		return
+	}
+
+	defer r.inFlight.Done()
+	r.processRequest(msg, requestMsg, start)
+}
+
+// startMessage tracks the message as in flight, unless the runner is shutting down, in which case
+// the message is handed back to JetStream for redelivery.
+func (r *Runner) startMessage(msg *nats.Msg) bool {
+	if !r.startWork() {
+		if err := msg.Nak(); err != nil {
+			r.logger.Errorf("Error returning message received during shutdown: %s", err)
+		}
+		return false
+	}
+
+	return true
+}
+
+// startWork tracks work that runs handlers as in flight, unless the runner is shutting down.
+func (r *Runner) startWork() bool {
+	r.inFlightMu.Lock()
+	defer r.inFlightMu.Unlock()
+
+	if r.shuttingDown {
+		return false
+	}
+
+	r.inFlight.Add(1)
+
+	return true
+}
+
+// processRequest executes the handler for the already parsed message.
+func (r *Runner) processRequest(msg *nats.Msg, requestMsg *KreNatsMessage, start time.Time) {
+	if r.isAlreadyProcessed(requestMsg) {
+		r.logger.Infof("Skipping already processed request %q part %d from node %q",
+			requestMsg.RequestId, requestMsg.PartIndex, requestMsg.FromNode)
+		r.ackMessage(msg)
+		return
+	}
+
 	// Make a shallow copy of the ctx object to set inside the request msg.
-	hCtx := r.handlerContext
-	hCtx.reqMsg = requestMsg
+	hCtx, cancel := r.newMessageContext(requestMsg)
+	defer cancel()
 
 	handler := r.handlerManager.GetHandler(requestMsg.FromNode)
 	if handler == nil {
 		errMsg := fmt.Sprintf("Error missing handler for node %q", requestMsg.FromNode)
-		r.processRunnerError(msg, errMsg, requestMsg.RequestId, start, requestMsg.FromNode)
+		r.processRunnerError(msg, errMsg, requestMsg, start)
 		return
 	}
 
-	err = handler(hCtx, requestMsg.Payload)
+	stopInProgress := r.keepInProgress(msg, r.cfg.NATS.InProgressInterval)
+	err := handler(hCtx, requestMsg.Payload)
+	stopInProgress()
+
 	if err != nil {
 		errMsg := fmt.Sprintf("Error in node %q executing handler for node %q: %s", r.cfg.NodeName, requestMsg.FromNode, err)
-		r.processRunnerError(msg, errMsg, requestMsg.RequestId, start, requestMsg.FromNode)
+		r.processRunnerError(msg, errMsg, requestMsg, start)
 		return
 	}
 
-	// Tell NATS we don't need to receive the message anymore and we are done processing it.
-	ackErr := msg.Ack()
-	if ackErr != nil {
-		r.logger.Errorf(errors.ErrMsgAck, ackErr)
+	err = r.awaitPublishes(hCtx)
+	if err != nil {
+		errMsg := fmt.Sprintf("Error in node %q publishing outputs of handler for node %q: %s", r.cfg.NodeName, requestMsg.FromNode, err)
+		r.processRunnerError(msg, errMsg, requestMsg, start)
+		return
 	}
 
+	r.markAsProcessed(requestMsg)
+
+	// Tell NATS we don't need to receive the message anymore and we are done processing it.
+	r.ackMessage(msg)
+
 	end := time.Now().UTC()
 	r.saveElapsedTime(start, end, requestMsg.FromNode, true)
 }
 
-func (r *Runner) processRunnerError(msg *nats.Msg, errMsg string, requestID string, start time.Time, fromNode string) {
+// newMessageContext returns a copy of the runner's handler context bound to the given request,
+// so that state tracked while handling a message is never shared between messages. The returned
+// func cancels the copy's context, and must be called once the message is handled.
+func (r *Runner) newMessageContext(requestMsg *KreNatsMessage) (*HandlerContext, context.CancelFunc) {
+	hCtx := *r.handlerContext
+	hCtx.reqMsg = requestMsg
+	hCtx.publishes = newPublishTracker()
+
+	var cancel context.CancelFunc
+	if r.cfg.Timeouts.Handler > 0 {
+		hCtx.ctx, cancel = context.WithTimeout(context.Background(), r.cfg.Timeouts.Handler)
+	} else {
+		hCtx.ctx, cancel = context.WithCancel(context.Background())
+	}
+
+	return &hCtx, cancel
+}
+
+func (r *Runner) processRunnerError(msg *nats.Msg, errMsg string, requestMsg *KreNatsMessage, start time.Time) {
+	r.ackMessage(msg)
+
+	r.logger.Error(errMsg)
+	r.publishError(requestMsg, errMsg)
+	r.markAsProcessed(requestMsg)
+
+	end := time.Now().UTC()
+	r.saveElapsedTime(start, end, requestMsg.FromNode, false)
+}
+
+// keepInProgress periodically tells JetStream the message is still being processed, so it is
+// not redelivered once its ack wait expires. The returned function stops the notifications.
+func (r *Runner) keepInProgress(msg *nats.Msg, interval time.Duration) func() {
+	if interval <= 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := msg.InProgress(); err != nil {
+					r.logger.Errorf("Error sending in progress ack: %s", err)
+				}
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+func (r *Runner) ackMessage(msg *nats.Msg) {
 	ackErr := msg.Ack()
 	if ackErr != nil {
 		r.logger.Errorf(errors.ErrMsgAck, ackErr)
 	}
+}
 
-	r.logger.Error(errMsg)
-	r.publishError(requestID, errMsg)
+// isAlreadyProcessed checks the idempotency store, if any. Messages are processed when the
+// store cannot be checked, as losing a message is worse than processing it twice.
+func (r *Runner) isAlreadyProcessed(requestMsg *KreNatsMessage) bool {
+	if r.idempotencyStore == nil {
+		return false
+	}
 
-	end := time.Now().UTC()
-	r.saveElapsedTime(start, end, fromNode, false)
+	processed, err := r.idempotencyStore.IsProcessed(requestMsg.RequestId, requestMsg.FromNode, requestMsg.PartIndex)
+	if err != nil {
+		r.logger.Errorf("Error checking idempotency store: %s", err)
+		return false
+	}
+
+	return processed
+}
+
+func (r *Runner) markAsProcessed(requestMsg *KreNatsMessage) {
+	if r.idempotencyStore == nil || requestMsg.RequestId == "" {
+		return
+	}
+
+	err := r.idempotencyStore.MarkProcessed(requestMsg.RequestId, requestMsg.FromNode, requestMsg.PartIndex)
+	if err != nil {
+		r.logger.Errorf("Error updating idempotency store: %s", err)
+	}
+}
+
+// sweepJoins periodically invokes the join handler of the requests whose join timed out, until the
+// runner shuts down.
+func (r *Runner) sweepJoins() {
+	defer close(r.sweepDone)
+
+	timer := time.NewTimer(joinSweepInterval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-r.stopSweep:
+			return
+		case <-timer.C:
+		}
+
+		handlers := r.joinStore.registered()
+
+		expired, err := r.joinStore.expired(handlers)
+		if err != nil {
+			r.logger.Errorf("Error checking join timeouts: %s", err)
+		}
+
+		for _, e := range expired {
+			if !r.startWork() {
+				return
+			}
+
+			r.processJoinTimeout(e)
+			r.inFlight.Done()
+		}
+
+		timer.Reset(sweepInterval(handlers))
+	}
+}
+
+func (r *Runner) processJoinTimeout(expired expiredJoin) {
+	requestID := expired.state.RequestID
+
+	// Removing the state first ensures the timeout is only processed by one replica
+	err := r.joinStore.remove(expired.key, expired.revision)
+	if err != nil {
+		r.logger.Debugf("Join timeout for request %q already processed: %s", requestID, err)
+		return
+	}
+
+	r.logger.Infof("Join for request %q timed out with %d of %d messages",
+		requestID, len(expired.state.Payloads), expired.state.Total)
+
+	hCtx, cancel := r.newMessageContext(&KreNatsMessage{
+		RequestId:   requestID,
+		FromNode:    expired.state.FromNode,
+		MessageType: MessageType_OK,
+	})
+	defer cancel()
+
+	err = expired.handler.handleTimeout(hCtx, expired.state)
+	if err == nil {
+		err = r.awaitPublishes(hCtx)
+	}
+
+	if err != nil {
+		errMsg := fmt.Sprintf("Error in node %q executing join handler for timed out request: %s", r.cfg.NodeName, err)
+		r.logger.Error(errMsg)
+		r.publishError(hCtx.reqMsg, errMsg)
+	}
 }
 
 func (r *Runner) newRequestMessage(data []byte) (*KreNatsMessage, error) {
@@ -135,7 +412,7 @@ func (r *Runner) newRequestMessage(data []byte) (*KreNatsMessage, error) {
 		data, err = r.uncompressData(data)
 		if err != nil {
 			r.logger.Errorf("error reading compressed message: %s", err)
-			return nil, err
+			return requestMsg, err
 		}
 	}
 
@@ -145,64 +422,146 @@ func (r *Runner) newRequestMessage(data []byte) (*KreNatsMessage, error) {
 }
 
 // publishMsg will send a desired payload to the node's output subject.
-func (r *Runner) publishMsg(msg proto.Message, reqMsg *KreNatsMessage, msgType MessageType, channel string) error {
+func (r *Runner) publishMsg(
+	msg proto.Message,
+	reqMsg *KreNatsMessage,
+	msgType MessageType,
+	channel string,
+	opts ...PublishOpt,
+) (nats.PubAckFuture, error) {
 	payload, err := anypb.New(msg)
 	if err != nil {
-		return fmt.Errorf("the handler result is not a valid protobuf: %s", err)
+		return nil, fmt.Errorf("the handler result is not a valid protobuf: %w", err)
 	}
-	responseMsg := r.newResponseMsg(payload, reqMsg, msgType)
-
-	r.publishResponse(responseMsg, channel)
 
-	return nil
+	return r.publishAny(payload, reqMsg, msgType, channel, opts...)
 }
 
-func (r *Runner) publishAny(payload *anypb.Any, reqMsg *KreNatsMessage, msgType MessageType, channel string) {
-	responseMsg := r.newResponseMsg(payload, reqMsg, msgType)
-	r.publishResponse(responseMsg, channel)
+func (r *Runner) publishAny(
+	payload *anypb.Any,
+	reqMsg *KreNatsMessage,
+	msgType MessageType,
+	channel string,
+	opts ...PublishOpt,
+) (nats.PubAckFuture, error) {
+	options := newPublishOptions(opts)
+	responseMsg := r.newResponseMsg(payload, reqMsg, msgType, options)
+
+	return r.publishResponse(responseMsg, channel, options.msgID)
 }
 
-func (r *Runner) publishError(requestID, errMsg string) {
+// publishError always publishes synchronously, as there is no handler left to wait for its ack.
+func (r *Runner) publishError(requestMsg *KreNatsMessage, errMsg string) {
 	responseMsg := &KreNatsMessage{
-		RequestId:   requestID,
+		RequestId:   requestMsg.RequestId,
 		Error:       errMsg,
 		FromNode:    r.cfg.NodeName,
 		MessageType: MessageType_ERROR,
 	}
-	r.publishResponse(responseMsg, "")
+
+	outputSubject := r.getOutputSubject("")
+
+	outputMsg, err := r.encodeResponse(responseMsg)
+	if err != nil {
+		r.logger.Errorf("Error preparing error msg: %s", err)
+		return
+	}
+
+	var opts []nats.PubOpt
+	if r.idempotencyStore != nil {
+		// identified as the outputs are, so the errors of each scatter part aren't deduplicated
+		opts = append(opts, nats.MsgId(errorMsgID(requestMsg, r.cfg.NodeName)))
+	}
+
+	_, err = r.js.Publish(outputSubject, outputMsg, opts...)
+	if err != nil {
+		r.logger.Errorf("Error publishing error msg: %s", err)
+	}
+}
+
+func errorMsgID(requestMsg *KreNatsMessage, nodeName string) string {
+	return fmt.Sprintf("%s:%s:%d:%s:error", requestMsg.RequestId, requestMsg.FromNode, requestMsg.PartIndex, nodeName)
 }
 
 // newResponseMsg creates a KreNatsMessage that keeps previous request ID plus adding the payload we wish to send.
-func (r *Runner) newResponseMsg(payload *anypb.Any, requestMsg *KreNatsMessage, msgType MessageType) *KreNatsMessage {
+func (r *Runner) newResponseMsg(
+	payload *anypb.Any,
+	requestMsg *KreNatsMessage,
+	msgType MessageType,
+	options publishOptions,
+) *KreNatsMessage {
 	return &KreNatsMessage{
 		RequestId:   requestMsg.RequestId,
 		Payload:     payload,
 		FromNode:    r.cfg.NodeName,
 		MessageType: msgType,
+		PartIndex:   options.partIndex,
+		PartCount:   options.partCount,
 	}
 }
 
-func (r *Runner) publishResponse(responseMsg *KreNatsMessage, channel string) {
+// publishResponse sends the response to the output subject. When async publishing is enabled
+// the returned PubAckFuture must be resolved to know if the message was stored by JetStream,
+// otherwise the future is nil and the returned error already reflects the JetStream ack.
+func (r *Runner) publishResponse(responseMsg *KreNatsMessage, channel, msgID string) (nats.PubAckFuture, error) {
 	outputSubject := r.getOutputSubject(channel)
 
+	var opts []nats.PubOpt
+	if msgID != "" {
+		opts = append(opts, nats.MsgId(msgID))
+	}
+
+	outputMsg, err := r.encodeResponse(responseMsg)
+	if err != nil {
+		return nil, err
+	}
+
+	r.logger.Infof("Publishing response to %q subject", outputSubject)
+
+	if r.cfg.NATS.AsyncPublish {
+		future, err := r.js.PublishAsync(outputSubject, outputMsg, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("error publishing output to subject %q: %w", outputSubject, err)
+		}
+		return future, nil
+	}
+
+	_, err = r.js.Publish(outputSubject, outputMsg, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error publishing output to subject %q: %w", outputSubject, err)
+	}
+
+	return nil, nil
+}
+
+func (r *Runner) encodeResponse(responseMsg *KreNatsMessage) ([]byte, error) {
 	outputMsg, err := proto.Marshal(responseMsg)
 	if err != nil {
-		r.logger.Errorf("Error generating output result because handler result is not a serializable Protobuf: %s", err)
-		return
+		return nil, fmt.Errorf("error generating output result because handler result is not a serializable Protobuf: %w", err)
 	}
 
 	outputMsg, err = r.prepareOutputMessage(outputMsg)
 	if err != nil {
-		r.logger.Errorf("Error preparing output msg: %s", err)
-		return
+		return nil, fmt.Errorf("error preparing output msg: %w", err)
 	}
 
-	r.logger.Infof("Publishing response to %q subject", outputSubject)
+	return outputMsg, nil
+}
 
-	_, err = r.js.Publish(outputSubject, outputMsg)
-	if err != nil {
-		r.logger.Errorf("Error publishing output: %s", err)
+// awaitPublishes resolves every publish made by the handler and applies the handler's
+// publish error policy, returning an error only when the message must be considered failed.
+func (r *Runner) awaitPublishes(hCtx *HandlerContext) error {
+	err := hCtx.publishes.wait(r.cfg.NATS.PublishAckTimeout)
+	if err == nil {
+		return nil
+	}
+
+	if hCtx.publishErrorPolicy == IgnorePublishError {
+		r.logger.Errorf("Ignoring publish errors for request %q: %s", hCtx.GetRequestID(), err)
+		return nil
 	}
+
+	return err
 }
 
 func (r *Runner) getOutputSubject(channel string) string {
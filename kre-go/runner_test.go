@@ -0,0 +1,303 @@
+//go:build unit
+
+package kre
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/konstellation-io/kre/libs/simplelogger"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/konstellation-io/kre-runners/kre-go/v4/config"
+)
+
+type fakeMeasurement struct{}
+
+func (fakeMeasurement) Save(_ string, _ map[string]interface{}, _ map[string]string) {}
+
+// fakeJetStream has no output stream, so the runner's outputs and errors are dropped.
+type fakeJetStream struct {
+	nats.JetStreamContext
+}
+
+func (js *fakeJetStream) StreamInfo(_ string, _ ...nats.JSOpt) (*nats.StreamInfo, error) {
+	return nil, nats.ErrStreamNotFound
+}
+
+type fakeDatabase struct {
+	ContextDatabase
+	flushed bool
+}
+
+func (db *fakeDatabase) Flush() error {
+	db.flushed = true
+	return nil
+}
+
+type RunnerTestSuite struct {
+	suite.Suite
+	logger      *simplelogger.SimpleLogger
+	idempotency *fakeKV
+	joins       *fakeKV
+}
+
+func TestRunnerTestSuite(t *testing.T) {
+	suite.Run(t, new(RunnerTestSuite))
+}
+
+func (suite *RunnerTestSuite) SetupTest() {
+	suite.logger = simplelogger.New(simplelogger.LevelInfo)
+	suite.idempotency = newFakeKV("kv_idempotency", time.Hour)
+	suite.joins = newFakeKV("kv_join", 0)
+}
+
+// newRunner returns a runner with the idempotency and join stores, whose handlers neither
+// publish nor use the measurements, so it needs no NATS connection.
+func (suite *RunnerTestSuite) newRunner(handlers map[string]Handler) *Runner {
+	cfg := config.Config{NodeName: "nodeB"}
+	joinStore := &JoinStore{logger: suite.logger, kvStore: suite.joins, joins: make(map[string]bufferedHandler)}
+
+	return &Runner{
+		logger:           suite.logger,
+		cfg:              cfg,
+		js:               &fakeJetStream{},
+		handlerManager:   NewHandlerManager(nil, handlers),
+		idempotencyStore: &IdempotencyStore{logger: suite.logger, kvStore: suite.idempotency},
+		joinStore:        joinStore,
+		handlerContext: &HandlerContext{
+			cfg:         cfg,
+			Logger:      suite.logger,
+			Measurement: fakeMeasurement{},
+			publishes:   newPublishTracker(),
+			joins:       joinStore,
+		},
+	}
+}
+
+func (suite *RunnerTestSuite) process(runner *Runner, requestMsg *KreNatsMessage) {
+	runner.processRequest(&nats.Msg{Subject: "input"}, requestMsg, time.Now())
+}
+
+func (suite *RunnerTestSuite) part(index, count int32, value string) *KreNatsMessage {
+	payload, err := anypb.New(wrapperspb.String(value))
+	suite.Require().NoError(err)
+
+	return &KreNatsMessage{
+		RequestId: "request",
+		FromNode:  "nodeA",
+		Payload:   payload,
+		PartIndex: index,
+		PartCount: count,
+	}
+}
+
+func (suite *RunnerTestSuite) TestScatterGatherWithIdempotency() {
+	// GIVEN a gather of the parts scattered by nodeA, with the idempotency store enabled
+	var gathered [][]*anypb.Any
+	gather := NewGather(func(ctx *HandlerContext, parts []*anypb.Any) error {
+		gathered = append(gathered, parts)
+		return nil
+	}, 0)
+	runner := suite.newRunner(map[string]Handler{"nodeA": gather.Handler()})
+
+	// WHEN the parts of a request arrive, the first one being redelivered once processed
+	suite.process(runner, suite.part(0, 3, "a"))
+	suite.process(runner, suite.part(0, 3, "a"))
+	suite.process(runner, suite.part(2, 3, "c"))
+	suite.process(runner, suite.part(1, 3, "b"))
+
+	// THEN every part is gathered once, and the gather handler called once
+	suite.Require().Len(gathered, 1)
+	suite.Require().Len(gathered[0], 3)
+
+	for i, expected := range []string{"a", "b", "c"} {
+		value := &wrapperspb.StringValue{}
+		suite.Require().NoError(gathered[0][i].UnmarshalTo(value))
+		suite.Equal(expected, value.Value)
+	}
+}
+
+func (suite *RunnerTestSuite) TestPartsOutputsHaveDifferentMsgIDs() {
+	// GIVEN two parts of the same request
+	first := suite.part(0, 2, "a")
+	second := suite.part(1, 2, "b")
+
+	// WHEN the IDs of their first output are generated
+	firstID := newPublishTracker().nextMsgID(first, "nodeB")
+	secondID := newPublishTracker().nextMsgID(second, "nodeB")
+
+	// THEN they differ, so JetStream doesn't discard one of them as duplicated
+	suite.NotEqual(firstID, secondID)
+}
+
+func (suite *RunnerTestSuite) natsMsg(requestMsg *KreNatsMessage) *nats.Msg {
+	data, err := proto.Marshal(requestMsg)
+	suite.Require().NoError(err)
+
+	return &nats.Msg{Subject: "input", Data: data}
+}
+
+func (suite *RunnerTestSuite) TestOnlyLimitedNodesWaitForTheLimiter() {
+	// GIVEN a runner limiting the messages from nodeA only
+	var handled []string
+	handler := func(ctx *HandlerContext, data *anypb.Any) error {
+		handled = append(handled, ctx.reqMsg.FromNode)
+		return nil
+	}
+	runner := suite.newRunner(map[string]Handler{"nodeA": handler, "nodeC": handler})
+	runner.limiter = newLimiter(config.Limits{NodeMaxConcurrency: map[string]int{"nodeA": 1}})
+
+	// WHEN a message from the unlimited node arrives
+	msg := suite.part(0, 0, "c")
+	msg.FromNode = "nodeC"
+	runner.ProcessMessage(suite.natsMsg(msg))
+
+	// THEN it is handled right away, in the subscription goroutine
+	suite.Equal([]string{"nodeC"}, handled)
+}
+
+func (suite *RunnerTestSuite) TestShutdownWaitsForMessagesInFlight() {
+	// GIVEN a limited message being handled
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handled := 0
+	runner := suite.newRunner(map[string]Handler{"nodeA": func(ctx *HandlerContext, data *anypb.Any) error {
+		handled++
+		close(started)
+		<-release
+		return nil
+	}})
+	runner.limiter = newLimiter(config.Limits{MaxConcurrency: 1})
+	db := &fakeDatabase{}
+	runner.handlerContext.DB = db
+
+	runner.ProcessMessage(suite.natsMsg(suite.part(0, 0, "a")))
+	<-started
+
+	// WHEN the runner shuts down
+	done := make(chan struct{})
+	go func() {
+		runner.Shutdown()
+		close(done)
+	}()
+
+	// THEN it waits for the handler before flushing the queued documents
+	suite.Never(func() bool {
+		select {
+		case <-done:
+			return true
+		default:
+			return false
+		}
+	}, 100*time.Millisecond, 10*time.Millisecond)
+
+	close(release)
+	<-done
+	suite.True(db.flushed)
+
+	// THEN messages received afterwards are not handled
+	runner.ProcessMessage(suite.natsMsg(suite.part(0, 0, "b")))
+	suite.Equal(1, handled)
+}
+
+func (suite *RunnerTestSuite) TestShutdownStopsTheJoinsSweeper() {
+	// GIVEN a runner sweeping the join timeouts
+	runner := suite.newRunner(nil)
+	runner.handlerContext.DB = &fakeDatabase{}
+	runner.joinStore.register(NewJoin(nil, 0, "nodeA", "nodeB"))
+	runner.stopSweep = make(chan struct{})
+	runner.sweepDone = make(chan struct{})
+	go runner.sweepJoins()
+
+	// WHEN the runner shuts down
+	runner.Shutdown()
+
+	// THEN the sweeper is stopped, and no more timeouts can be handled
+	_, open := <-runner.sweepDone
+	suite.False(open)
+	suite.False(runner.startWork())
+}
+
+func (suite *RunnerTestSuite) TestJoinsSweepInterval() {
+	suite.Equal(joinSweepInterval, sweepInterval(nil))
+	suite.Equal(joinSweepInterval, sweepInterval([]bufferedHandler{NewJoin(nil, 0, "nodeA")}))
+	suite.Equal(6*time.Second, sweepInterval([]bufferedHandler{
+		NewJoin(nil, time.Hour, "nodeA"),
+		NewJoin(nil, time.Minute, "nodeB"),
+	}))
+}
+
+func (suite *RunnerTestSuite) TestErrorMsgIDsIdentifyTheScatterPart() {
+	first := errorMsgID(suite.part(0, 2, "a"), "nodeB")
+
+	suite.Equal("request:nodeA:0:nodeB:error", first)
+	suite.NotEqual(first, errorMsgID(suite.part(1, 2, "b"), "nodeB"))
+}
+
+func (suite *RunnerTestSuite) TestSkipsProcessedRequests() {
+	// GIVEN a request already processed by the node
+	handled := 0
+	runner := suite.newRunner(map[string]Handler{"nodeA": func(ctx *HandlerContext, data *anypb.Any) error {
+		handled++
+		return nil
+	}})
+
+	err := runner.idempotencyStore.MarkProcessed("request", "nodeA", 0)
+	suite.Require().NoError(err)
+
+	// WHEN it is redelivered
+	suite.process(runner, suite.part(0, 0, "a"))
+
+	// THEN the handler is not executed
+	suite.Zero(handled)
+}
+
+func (suite *RunnerTestSuite) TestProcessesRequestsWhenTheStoreFails() {
+	// GIVEN an unavailable idempotency store
+	handled := 0
+	runner := suite.newRunner(map[string]Handler{"nodeA": func(ctx *HandlerContext, data *anypb.Any) error {
+		handled++
+		return nil
+	}})
+	suite.idempotency.err = errors.New("timeout")
+
+	// WHEN a request arrives
+	suite.process(runner, suite.part(0, 0, "a"))
+
+	// THEN it is processed anyway, as losing it is worse than processing it twice
+	suite.Equal(1, handled)
+}
+
+func (suite *RunnerTestSuite) TestMarksHandledRequests() {
+	// GIVEN a handler failing for one of the requests
+	runner := suite.newRunner(map[string]Handler{"nodeA": func(ctx *HandlerContext, data *anypb.Any) error {
+		if ctx.GetRequestID() == "failing" {
+			return errors.New("handler error")
+		}
+		return nil
+	}})
+
+	// WHEN the requests are processed
+	succeeding := suite.part(0, 0, "a")
+	failing := suite.part(0, 0, "b")
+	failing.RequestId = "failing"
+	missingHandler := suite.part(0, 0, "c")
+	missingHandler.FromNode = "nodeC"
+
+	suite.process(runner, succeeding)
+	suite.process(runner, failing)
+	suite.process(runner, missingHandler)
+
+	// THEN every request is marked as processed, as failures are published instead of retried
+	for _, requestMsg := range []*KreNatsMessage{succeeding, failing, missingHandler} {
+		processed, err := runner.idempotencyStore.IsProcessed(requestMsg.RequestId, requestMsg.FromNode, 0)
+		suite.Require().NoError(err)
+		suite.True(processed, requestMsg.RequestId)
+	}
+}
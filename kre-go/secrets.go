@@ -0,0 +1,140 @@
+package kre
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/konstellation-io/kre-runners/kre-go/v4/config"
+	utilErrors "github.com/konstellation-io/kre-runners/kre-go/v4/internal/errors"
+)
+
+// secretPrefix marks the configuration values encrypted with SetSecret.
+const secretPrefix = "krt-secret:v1:"
+
+const redactedSecret = "[REDACTED]"
+
+// Secret is a decrypted configuration value that is redacted when formatted, so it isn't
+// leaked by logging it.
+type Secret string
+
+func (s Secret) String() string {
+	return redactedSecret
+}
+
+func (s Secret) GoString() string {
+	return redactedSecret
+}
+
+// Reveal returns the secret value.
+func (s Secret) Reveal() string {
+	return string(s)
+}
+
+// secretCipher encrypts the secret configuration values with AES-256-GCM.
+type secretCipher struct {
+	aead cipher.AEAD
+}
+
+// newSecretCipher reads the base64 encoded 32 bytes key from the config, or from the key file.
+// It returns nil when no key is configured.
+func newSecretCipher(cfg config.Secrets) (*secretCipher, error) {
+	encodedKey := cfg.Key
+
+	if encodedKey == "" && cfg.KeyFile != "" {
+		content, err := os.ReadFile(cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading secret key file: %w", err)
+		}
+		encodedKey = strings.TrimSpace(string(content))
+	}
+
+	if encodedKey == "" {
+		return nil, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding secret key: %w", err)
+	}
+
+	if len(key) != 32 {
+		return nil, fmt.Errorf("the secret key must be 32 bytes long, got %d", len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &secretCipher{aead: aead}, nil
+}
+
+func isSecretValue(value string) bool {
+	return strings.HasPrefix(value, secretPrefix)
+}
+
+// secretAdditionalData binds an encrypted value to its scope and key, so it can't be decrypted
+// once copied to another key or scope.
+func secretAdditionalData(scope Scope, key string) []byte {
+	return []byte(string(scope) + ":" + key)
+}
+
+func (s *secretCipher) encrypt(plaintext string, scope Scope, key string) (string, error) {
+	if s == nil {
+		return "", utilErrors.ErrUndefinedSecretKey
+	}
+
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", fmt.Errorf("error generating nonce: %w", err)
+	}
+
+	sealed := s.aead.Seal(nonce, nonce, []byte(plaintext), secretAdditionalData(scope, key))
+
+	return secretPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (s *secretCipher) decrypt(value string, scope Scope, key string) (string, error) {
+	if s == nil {
+		return "", utilErrors.ErrUndefinedSecretKey
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, secretPrefix))
+	if err != nil {
+		return "", fmt.Errorf("error decoding secret: %w", err)
+	}
+
+	nonceSize := s.aead.NonceSize()
+	if len(sealed) < nonceSize {
+		return "", fmt.Errorf("error decrypting secret: value too short")
+	}
+
+	plaintext, err := s.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], secretAdditionalData(scope, key))
+	if err != nil {
+		return "", fmt.Errorf("error decrypting secret: %w", err)
+	}
+
+	return string(plaintext), nil
+}
+
+// decode returns the value of the key as stored by Set, decrypting it when it is a secret.
+func (s *secretCipher) decode(value string, scope Scope, key string) (string, bool, error) {
+	if !isSecretValue(value) {
+		return value, false, nil
+	}
+
+	plaintext, err := s.decrypt(value, scope, key)
+
+	return plaintext, true, err
+}
@@ -0,0 +1,94 @@
+//go:build unit
+
+package kre
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/konstellation-io/kre-runners/kre-go/v4/config"
+	"github.com/konstellation-io/kre-runners/kre-go/v4/internal/errors"
+)
+
+type SecretsTestSuite struct {
+	suite.Suite
+	key string
+}
+
+func TestSecretsTestSuite(t *testing.T) {
+	suite.Run(t, new(SecretsTestSuite))
+}
+
+func (suite *SecretsTestSuite) SetupTest() {
+	suite.key = base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32)))
+}
+
+func (suite *SecretsTestSuite) TestEncryptAndDecode() {
+	secrets, err := newSecretCipher(config.Secrets{Key: suite.key})
+	suite.Require().NoError(err)
+
+	encrypted, err := secrets.encrypt("api-key", NodeScope, "token")
+	suite.Require().NoError(err)
+	suite.True(isSecretValue(encrypted))
+	suite.NotContains(encrypted, "api-key")
+
+	value, secret, err := secrets.decode(encrypted, NodeScope, "token")
+	suite.Require().NoError(err)
+	suite.True(secret)
+	suite.Equal("api-key", value)
+
+	value, secret, err = secrets.decode("plain", NodeScope, "token")
+	suite.Require().NoError(err)
+	suite.False(secret)
+	suite.Equal("plain", value)
+}
+
+func (suite *SecretsTestSuite) TestSecretsAreBoundToTheirScopeAndKey() {
+	secrets, err := newSecretCipher(config.Secrets{Key: suite.key})
+	suite.Require().NoError(err)
+
+	encrypted, err := secrets.encrypt("api-key", NodeScope, "token")
+	suite.Require().NoError(err)
+
+	_, _, err = secrets.decode(encrypted, NodeScope, "other")
+	suite.Error(err)
+
+	_, _, err = secrets.decode(encrypted, ProjectScope, "token")
+	suite.Error(err)
+}
+
+func (suite *SecretsTestSuite) TestKeyFromFile() {
+	keyFile := filepath.Join(suite.T().TempDir(), "secret.key")
+	suite.Require().NoError(os.WriteFile(keyFile, []byte(suite.key+"\n"), 0o600))
+
+	secrets, err := newSecretCipher(config.Secrets{KeyFile: keyFile})
+	suite.Require().NoError(err)
+	suite.NotNil(secrets)
+}
+
+func (suite *SecretsTestSuite) TestWithoutKey() {
+	secrets, err := newSecretCipher(config.Secrets{})
+	suite.Require().NoError(err)
+	suite.Nil(secrets)
+
+	_, err = secrets.encrypt("api-key", NodeScope, "token")
+	suite.ErrorIs(err, errors.ErrUndefinedSecretKey)
+
+	_, _, err = secrets.decode(secretPrefix+"AAAA", NodeScope, "token")
+	suite.ErrorIs(err, errors.ErrUndefinedSecretKey)
+}
+
+func (suite *SecretsTestSuite) TestSecretIsRedacted() {
+	secret := Secret("api-key")
+
+	suite.Equal(redactedSecret, secret.String())
+	suite.NotContains(fmt.Sprintf("%s %v %#v", secret, secret, secret), "api-key")
+	suite.NotContains(ConfigurationUpdate{Key: "token", Value: "api-key", Secret: true}.String(), "api-key")
+	suite.Equal("api-key", secret.Reveal())
+}
@@ -0,0 +1,174 @@
+package kre
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/konstellation-io/kre/libs/simplelogger"
+	"github.com/nats-io/nats.go"
+
+	"github.com/konstellation-io/kre-runners/kre-go/v4/config"
+)
+
+const (
+	PushSubscriptionMode = "push"
+	PullSubscriptionMode = "pull"
+
+	DeliverNewPolicy         = "new"
+	DeliverAllPolicy         = "all"
+	DeliverByStartTimePolicy = "by_start_time"
+)
+
+// subscribe creates a durable consumer for each input subject, shared by all the node's
+// replicas, and delivers its messages to the given handler.
+func subscribe(
+	cfg config.Config,
+	logger *simplelogger.SimpleLogger,
+	js nats.JetStreamContext,
+	processMessage nats.MsgHandler,
+) ([]*nats.Subscription, error) {
+	deliverPolicy, err := deliverPolicyOpt(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// the consumer is shared by every replica, so the node's limits are applied by each replica instead
+	ackPending := cfg.NATS.MaxPendingAck
+
+	if cfg.NATS.ReconcileConsumers {
+		err = reconcileConsumers(cfg, logger, js, ackPending)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	subscriptions := make([]*nats.Subscription, 0, len(cfg.NATS.InputSubjects))
+
+	for _, subject := range cfg.NATS.InputSubjects {
+		consumerName := getConsumerName(subject, cfg.NodeName)
+
+		ackWait, consumerAckPending, err := consumerAckSettings(cfg, logger, js, consumerName, ackPending)
+		if err != nil {
+			return nil, err
+		}
+
+		opts := []nats.SubOpt{
+			deliverPolicy,
+			nats.ManualAck(),
+			nats.AckWait(ackWait),
+			nats.MaxAckPending(consumerAckPending),
+		}
+
+		var s *nats.Subscription
+
+		queue := newDeliveryQueue(processMessage, cfg.NATS.InProgressInterval, logger)
+
+		switch cfg.NATS.SubscriptionMode {
+		case PullSubscriptionMode:
+			opts = append(opts, nats.PullMaxWaiting(cfg.NATS.PullMaxWaiting))
+
+			s, err = js.PullSubscribe(subject, consumerName, opts...)
+			if err == nil {
+				go fetchMessages(cfg, logger, s, queue, fetchBatchSize(cfg, consumerAckPending))
+				logger.Infof("Fetching from '%s' subject with pull consumer %s", subject, consumerName)
+			}
+		default:
+			opts = append(opts, nats.Durable(consumerName))
+
+			s, err = js.QueueSubscribe(subject, consumerName, func(msg *nats.Msg) { queue.deliver(msg) }, opts...)
+			if err == nil {
+				logger.Infof("Listening to '%s' subject with queue group %s", subject, consumerName)
+			}
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("error subscribing to NATS subject %s: %w", subject, err)
+		}
+
+		subscriptions = append(subscriptions, s)
+	}
+
+	return subscriptions, nil
+}
+
+// fetchMessages pulls messages in batches until the subscription is closed, fetching the next
+// batch once the messages of the previous one are handled.
+func fetchMessages(
+	cfg config.Config,
+	logger *simplelogger.SimpleLogger,
+	s *nats.Subscription,
+	queue *deliveryQueue,
+	batchSize int,
+) {
+	for {
+		msgs, err := s.Fetch(batchSize, nats.MaxWait(cfg.NATS.PullFetchMaxWait))
+
+		switch {
+		case errors.Is(err, nats.ErrTimeout):
+			continue
+		case errors.Is(err, nats.ErrBadSubscription), errors.Is(err, nats.ErrConnectionClosed):
+			logger.Infof("Stopped fetching from '%s' subject", s.Subject)
+			return
+		case err != nil:
+			logger.Errorf("Error fetching messages from '%s' subject: %s", s.Subject, err)
+			time.Sleep(cfg.NATS.PullFetchMaxWait)
+			continue
+		}
+
+		queue.deliver(msgs...)
+		queue.wait()
+	}
+}
+
+// fetchBatchSize avoids fetching more messages than the consumer allows to have pending.
+func fetchBatchSize(cfg config.Config, ackPending int) int {
+	batchSize := cfg.NATS.PullBatchSize
+	if ackPending > 0 && ackPending < batchSize {
+		batchSize = ackPending
+	}
+
+	if batchSize < 1 {
+		return 1
+	}
+
+	return batchSize
+}
+
+func deliverPolicyOpt(cfg config.Config) (nats.SubOpt, error) {
+	policy, startTime, err := consumerDeliverPolicy(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	switch policy {
+	case nats.DeliverAllPolicy:
+		return nats.DeliverAll(), nil
+	case nats.DeliverByStartTimePolicy:
+		return nats.StartTime(*startTime), nil
+	}
+
+	return nats.DeliverNew(), nil
+}
+
+func consumerDeliverPolicy(cfg config.Config) (nats.DeliverPolicy, *time.Time, error) {
+	switch cfg.NATS.DeliverPolicy {
+	case DeliverNewPolicy, "":
+		return nats.DeliverNewPolicy, nil, nil
+	case DeliverAllPolicy:
+		return nats.DeliverAllPolicy, nil, nil
+	case DeliverByStartTimePolicy:
+		if cfg.NATS.DeliverStartTime.IsZero() {
+			return 0, nil, fmt.Errorf("deliver policy %q requires a start time", cfg.NATS.DeliverPolicy)
+		}
+		startTime := cfg.NATS.DeliverStartTime
+		return nats.DeliverByStartTimePolicy, &startTime, nil
+	}
+
+	return 0, nil, fmt.Errorf("invalid deliver policy %q", cfg.NATS.DeliverPolicy)
+}
+
+func getConsumerName(subject, nodeName string) string {
+	return fmt.Sprintf("%s-%s", strings.ReplaceAll(subject, ".", "-"), nodeName)
+}
@@ -0,0 +1,52 @@
+//go:build unit
+
+package kre
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/konstellation-io/kre-runners/kre-go/v4/config"
+)
+
+type SubscriberTestSuite struct {
+	suite.Suite
+}
+
+func TestSubscriberTestSuite(t *testing.T) {
+	suite.Run(t, new(SubscriberTestSuite))
+}
+
+func (suite *SubscriberTestSuite) TestDeliverPolicyOpt() {
+	cfg := config.Config{}
+
+	for _, policy := range []string{"", DeliverNewPolicy, DeliverAllPolicy} {
+		cfg.NATS.DeliverPolicy = policy
+		_, err := deliverPolicyOpt(cfg)
+		suite.NoError(err, policy)
+	}
+
+	cfg.NATS.DeliverPolicy = DeliverByStartTimePolicy
+	_, err := deliverPolicyOpt(cfg)
+	suite.Error(err)
+
+	cfg.NATS.DeliverStartTime = time.Now()
+	_, err = deliverPolicyOpt(cfg)
+	suite.NoError(err)
+
+	cfg.NATS.DeliverPolicy = "last"
+	_, err = deliverPolicyOpt(cfg)
+	suite.Error(err)
+}
+
+func (suite *SubscriberTestSuite) TestFetchBatchSize() {
+	cfg := config.Config{}
+	suite.Equal(1, fetchBatchSize(cfg, -1))
+
+	cfg.NATS.PullBatchSize = 10
+	suite.Equal(10, fetchBatchSize(cfg, -1))
+	suite.Equal(10, fetchBatchSize(cfg, 100))
+	suite.Equal(8, fetchBatchSize(cfg, 8))
+}